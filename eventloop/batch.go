@@ -0,0 +1,46 @@
+package eventloop
+
+import "fmt"
+
+// MARK: - Batches
+
+// batchCommand queues the commands of a batch ... endbatch block as a unit:
+// they are appended to the queue one after another under a single lock, so no
+// command posted concurrently, by another producer or worker, lands between
+// them. They run after the commands queued before the batch executed. With
+// several workers, commands of the batch may still run alongside each other,
+// like any queued commands; put a barrier in the batch to order them.
+type batchCommand struct {
+	cmds []Command
+}
+
+func (b *batchCommand) attrs() []any {
+	return []any{"commands", len(b.cmds)}
+}
+
+func (b *batchCommand) Execute(handler Handler) {
+	h, ok := findHandler[workerHandler](handler)
+	if !ok {
+		for _, cmd := range b.cmds {
+			handler.Post(cmd)
+		}
+		return
+	}
+	cmds := make([]Command, 0, len(b.cmds))
+	for _, cmd := range b.cmds {
+		if !h.replayed(cmd) {
+			h.logReceived(cmd)
+			cmds = append(cmds, cmd)
+		}
+	}
+	h.queue.pushAll(cmds)
+}
+
+func parseBatch(args []string) (func(body []Command) Command, error) {
+	if len(args) != 0 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "batch")
+	}
+	return func(body []Command) Command {
+		return &batchCommand{cmds: body}
+	}, nil
+}
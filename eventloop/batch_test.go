@@ -0,0 +1,59 @@
+package eventloop
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestBatch(t *testing.T) {
+	checkOutput(t, "print a\nbatch\nprint b\nadd 1 2\nendbatch\nprint c", "a\nc\nb\n3\n", "")
+}
+
+func TestBatchContiguous(t *testing.T) {
+	const producers, posts, batches, batchSize = 4, 200, 20, 10
+
+	var out, errs syncBuffer
+	var log markLog
+	l := newTestLoop(&out, &errs)
+	l.Start()
+
+	var wg sync.WaitGroup
+	wg.Add(producers + 1)
+	for p := range producers {
+		go func() {
+			defer wg.Done()
+			for range posts {
+				l.Post(markCommand{name: fmt.Sprintf("p%d", p), log: &log})
+			}
+		}()
+	}
+	go func() {
+		defer wg.Done()
+		for b := range batches {
+			cmds := make([]Command, batchSize)
+			for i := range cmds {
+				cmds[i] = markCommand{name: fmt.Sprintf("b%d", b), log: &log}
+			}
+			l.Post(&batchCommand{cmds: cmds})
+		}
+	}()
+	wg.Wait()
+	l.AwaitFinish()
+
+	if n := len(log.names); n != producers*posts+batches*batchSize {
+		t.Fatalf("executed %d commands, want %d", n, producers*posts+batches*batchSize)
+	}
+	// Each batch's commands run in one stretch.
+	seen := make(map[string]bool)
+	for i, name := range log.names {
+		if !strings.HasPrefix(name, "b") || (i > 0 && log.names[i-1] == name) {
+			continue
+		}
+		if seen[name] {
+			t.Fatalf("batch %s was interleaved with other commands: %v", name, log.names)
+		}
+		seen[name] = true
+	}
+}
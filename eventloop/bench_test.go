@@ -0,0 +1,57 @@
+package eventloop
+
+import (
+	"io"
+	"runtime"
+	"testing"
+)
+
+// doneCommand signals that the commands posted before it have executed.
+type doneCommand chan struct{}
+
+func (d doneCommand) Execute(handler Handler) {
+	d <- struct{}{}
+}
+
+// benchmarkLoop runs a loop writing to io.Discard for the duration of b,
+// checking that it leaves no goroutines behind once it has finished.
+func benchmarkLoop(b *testing.B, bench func(l *EventLoop)) {
+	before := runtime.NumGoroutine()
+	l := NewEventLoop(WithOutput(io.Discard))
+	l.Start()
+	b.ReportAllocs()
+	b.ResetTimer()
+	bench(l)
+	l.AwaitFinish()
+	b.StopTimer()
+	if after := runtime.NumGoroutine(); after > before {
+		b.Fatalf("%d goroutines running after the loop finished, %d before", after, before)
+	}
+}
+
+// BenchmarkPrintLatency measures the time from posting a print to it having
+// been executed.
+func BenchmarkPrintLatency(b *testing.B) {
+	benchmarkLoop(b, func(l *EventLoop) {
+		done := make(doneCommand)
+		for i := 0; i < b.N; i++ {
+			l.Post(&printCommand{arg: "line"})
+			l.Post(done)
+			<-done
+		}
+	})
+}
+
+// BenchmarkAdd measures the throughput of add commands, including the
+// prints of their sums.
+func BenchmarkAdd(b *testing.B) {
+	cmd, err := Parse("add 1 2")
+	if err != nil {
+		b.Fatal(err)
+	}
+	benchmarkLoop(b, func(l *EventLoop) {
+		for i := 0; i < b.N; i++ {
+			l.Post(cmd)
+		}
+	})
+}
@@ -0,0 +1,151 @@
+package eventloop
+
+import "fmt"
+
+const UnterminatedBlockError string = "SYNTAX ERROR: '%v' on line %v is missing '%v'"
+const UnexpectedBlockEndError string = "SYNTAX ERROR: '%v' without a matching block"
+const BlockNotOnOwnLineError string = "SYNTAX ERROR: block '%v' must start a line of its own"
+
+// MARK: - Blocks
+
+// blockFunc parses the first line of a block and returns the function that
+// builds its command from the commands of the lines up to its end.
+type blockFunc func(args []string) (func(body []Command) Command, error)
+
+type blockSpec struct {
+	end   string
+	parse blockFunc
+}
+
+// LineParser parses instructions one line at a time like Registry.Parse, and
+// also understands blocks spanning several lines, such as def ... enddef.
+// The lines of a block yield nil commands until its last one, which yields
+// the command for the whole block. A LineParser is not safe for concurrent
+// use.
+type LineParser struct {
+	registry *Registry
+	split    func(line string) (fields []string, seps []int, err error)
+	open     []*openBlock
+	lineNo   int
+	start    int
+}
+
+// openBlock is a block whose end hasn't been reached yet. build is nil if its
+// first line was rejected; its body is then parsed but discarded.
+type openBlock struct {
+	name, end string
+	lineNo    int
+	build     func(body []Command) Command
+	body      []Command
+}
+
+// LineParser returns a parser for instructions in the text format.
+func (r *Registry) LineParser() *LineParser {
+	return &LineParser{registry: r.scope(), split: tokenizeInstruction}
+}
+
+// JSONLineParser returns a parser for instructions in the JSON format of
+// ParseJSON.
+func (r *Registry) JSONLineParser() *LineParser {
+	return &LineParser{registry: r.scope(), split: jsonInstructionFields}
+}
+
+// NewLineParser returns a text parser using the built-in commands only.
+func NewLineParser() *LineParser {
+	return builtins.LineParser()
+}
+
+// NewJSONLineParser returns a JSON parser using the built-in commands only.
+func NewJSONLineParser() *LineParser {
+	return builtins.JSONLineParser()
+}
+
+// Parse parses the next line. Blank lines and lines inside a block yield a nil
+// command and a nil error.
+func (p *LineParser) Parse(line string) (Command, error) {
+	p.lineNo++
+	return p.parse(line)
+}
+
+// Continue parses a further instruction on the line given to Parse last, such
+// as one following a separator.
+func (p *LineParser) Continue(instruction string) (Command, error) {
+	return p.parse(instruction)
+}
+
+// Line returns the number of the line the last command returned started on,
+// counting the lines given to Parse from 1.
+func (p *LineParser) Line() int {
+	return p.start
+}
+
+func (p *LineParser) parse(line string) (Command, error) {
+	parts, seps, err := p.split(line)
+	if err != nil || len(parts) == 0 {
+		return nil, err
+	}
+	name, args := parts[0], parts[1:]
+
+	if spec, ok := p.registry.lookupBlock(name); ok && !p.inline(name, args) {
+		build, err := spec.parse(args)
+		p.open = append(p.open, &openBlock{name: name, end: spec.end, lineNo: p.lineNo, build: build})
+		return nil, err
+	}
+	if n := len(p.open); n > 0 && name == p.open[n-1].end {
+		if len(args) != 0 {
+			return nil, fmt.Errorf(AmbiguousArgsNumberError, name)
+		}
+		b := p.open[n-1]
+		p.open = p.open[:n-1]
+		if b.build == nil {
+			return nil, nil
+		}
+		return p.add(b.build(b.body), b.lineNo)
+	}
+	if p.registry.isBlockEnd(name) {
+		return nil, fmt.Errorf(UnexpectedBlockEndError, name)
+	}
+	cmd, err := p.registry.parseInstruction(parts, seps)
+	if err != nil {
+		return nil, err
+	}
+	return p.add(cmd, p.lineNo)
+}
+
+// inline reports whether the block name is given on one line, as its
+// arguments, which only a block that is also a command takes, like parallel.
+func (p *LineParser) inline(name string, args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	_, ok := p.registry.lookup(name)
+	return ok
+}
+
+// add returns cmd, which started on line, or appends it to the innermost open
+// block.
+func (p *LineParser) add(cmd Command, line int) (Command, error) {
+	if len(p.open) == 0 {
+		p.start = line
+		return cmd, nil
+	}
+	if b := p.open[len(p.open)-1]; cmd != nil {
+		b.body = append(b.body, cmd)
+	}
+	return nil, nil
+}
+
+// Pending reports whether a block is open, waiting for more lines.
+func (p *LineParser) Pending() bool {
+	return len(p.open) != 0
+}
+
+// Close reports a block left open at the end of the input, and discards it.
+func (p *LineParser) Close() error {
+	if len(p.open) == 0 {
+		return nil
+	}
+	b := p.open[len(p.open)-1]
+	p.open = nil
+	return fmt.Errorf(UnterminatedBlockError, b.name, b.lineNo, b.end)
+}
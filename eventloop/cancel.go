@@ -0,0 +1,79 @@
+package eventloop
+
+import (
+	"fmt"
+	"strconv"
+)
+
+const InvalidPostIDError string = "SYNTAX ERROR: cancel '%v' must be the id of a posted command"
+const NotQueuedError string = "error: no queued command with id %v"
+
+// MARK: - Cancel
+
+// postedCommand is a command posted by PostWithID, which CancelPosted can
+// take out of the queue by its id until a worker pulls it.
+type postedCommand struct {
+	id  uint64
+	cmd Command
+}
+
+func (p *postedCommand) attrs() []any {
+	return []any{"id", p.id}
+}
+
+func (p *postedCommand) Execute(handler Handler) {
+	p.cmd.Execute(handler)
+}
+
+// PostWithID is like Post, but returns an id for cmd that CancelPosted takes.
+// Ids start at 1 and are never reused by the loop; a command rejected by the
+// cap of WithMaxDepth gets 0.
+func (l *EventLoop) PostWithID(cmd Command) uint64 {
+	id := l.postIDs.Add(1)
+	if !l.post(&postedCommand{id: id, cmd: cmd}) {
+		return 0
+	}
+	return id
+}
+
+// CancelPosted removes the command posted by PostWithID with id from the
+// queue and reports whether it did. It returns false for an unknown id and
+// for a command that a worker has already pulled, whether or not it has
+// finished executing.
+func (l *EventLoop) CancelPosted(id uint64) bool {
+	return l.queue.remove(func(cmd Command) bool {
+		p, ok := cmd.(*postedCommand)
+		return ok && p.id == id
+	})
+}
+
+// cancelCommand cancels the command posted with an id, like CancelPosted.
+// Being queued itself, it only reaches commands still queued when it runs,
+// such as those behind a long sleep or a paused loop, or those of a lower
+// priority when it is queued with priority.
+type cancelCommand struct {
+	id uint64
+}
+
+func (c *cancelCommand) Execute(handler Handler) {
+	h, ok := findHandler[workerHandler](handler)
+	if !ok {
+		return
+	}
+	cancelled := h.CancelPosted(c.id)
+	returnResult(handler, cancelled)
+	if !cancelled {
+		handler.Post(&errorCommand{msg: fmt.Sprintf(NotQueuedError, c.id)})
+	}
+}
+
+func parseCancel(args []string) (Command, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "cancel")
+	}
+	id, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil || id == 0 {
+		return nil, fmt.Errorf(InvalidPostIDError, args[0])
+	}
+	return &cancelCommand{id: id}, nil
+}
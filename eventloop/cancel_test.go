@@ -0,0 +1,85 @@
+package eventloop
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestCancelPosted(t *testing.T) {
+	var out, errs syncBuffer
+	l := newTestLoop(&out, &errs)
+	a := l.PostWithID(mustParse(t, "print a"))
+	b := l.PostWithID(mustParse(t, "print b"))
+	c := l.PostWithID(mustParse(t, "print c"))
+	if a == 0 || b == 0 || c == 0 || a == b || b == c {
+		t.Fatalf("ids %d, %d, %d, want distinct non-zero ones", a, b, c)
+	}
+	if !l.CancelPosted(b) {
+		t.Error("CancelPosted of a queued command = false")
+	}
+	if l.CancelPosted(b) {
+		t.Error("CancelPosted of a cancelled command = true")
+	}
+	if l.CancelPosted(c + 100) {
+		t.Error("CancelPosted of an unknown id = true")
+	}
+	l.Start()
+	l.AwaitFinish()
+	if got, want := out.String(), "a\nc\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+	if l.CancelPosted(a) {
+		t.Error("CancelPosted of an executed command = true")
+	}
+}
+
+func TestCancelCommand(t *testing.T) {
+	var out, errs syncBuffer
+	l := newTestLoop(&out, &errs)
+	l.Post(mustParse(t, "print first"))
+	id := l.PostWithID(mustParse(t, "print cancelled"))
+	l.Post(&priorityCommand{n: 1, cmd: &cancelCommand{id: id}})
+	l.Post(&cancelCommand{id: id})
+	l.Start()
+	l.AwaitFinish()
+	if got, want := out.String(), "first\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+	if want := fmt.Sprintf(NotQueuedError, id) + "\n"; errs.String() != want {
+		t.Errorf("errors = %q, want the second cancel to fail with %q", errs.String(), want)
+	}
+}
+
+func TestPostWithIDConcurrent(t *testing.T) {
+	var out, errs syncBuffer
+	l := newTestLoop(&out, &errs)
+	ids := make(chan uint64, 400)
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				ids <- l.PostWithID(&nopCommand{})
+			}
+		}()
+	}
+	wg.Wait()
+	close(ids)
+	seen := make(map[uint64]bool)
+	for id := range ids {
+		if seen[id] {
+			t.Fatalf("id %d handed out twice", id)
+		}
+		seen[id] = true
+	}
+	for id := range seen {
+		if !l.CancelPosted(id) {
+			t.Fatalf("CancelPosted(%d) = false", id)
+		}
+	}
+	if n := l.QueueLen(); n != 0 {
+		t.Errorf("QueueLen() = %d after cancelling everything, want 0", n)
+	}
+}
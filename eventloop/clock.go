@@ -0,0 +1,137 @@
+package eventloop
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const UnknownTimeFormatError string = "SYNTAX ERROR: unknown time format '%v'"
+const UnmatchedTocError string = "error: toc %v without a matching tic"
+
+// MARK: - Time
+
+// timeFormats are the formats of the now command. The Unix ones store
+// integers, the others strings.
+var timeFormats = map[string]func(t time.Time) Value{
+	"unix":        func(t time.Time) Value { return IntValue(t.Unix()) },
+	"unixmilli":   func(t time.Time) Value { return IntValue(t.UnixMilli()) },
+	"unixnano":    func(t time.Time) Value { return IntValue(t.UnixNano()) },
+	"rfc3339":     func(t time.Time) Value { return StringValue(t.Format(time.RFC3339)) },
+	"rfc3339nano": func(t time.Time) Value { return StringValue(t.Format(time.RFC3339Nano)) },
+}
+
+// nowCommand stores the time of the loop's clock, set with WithClock, in a
+// variable.
+type nowCommand struct {
+	name   string
+	format string
+}
+
+func (n *nowCommand) attrs() []any {
+	return []any{"var", n.name, "format", n.format}
+}
+
+func (n *nowCommand) Execute(handler Handler) {
+	val := timeFormats[n.format](loopClock(handler)())
+	handler.Vars().Set(n.name, val)
+	returnResult(handler, val.native())
+}
+
+// loopClock returns the clock of the loop executing a command.
+func loopClock(handler Handler) func() time.Time {
+	if h, ok := findHandler[workerHandler](handler); ok {
+		return h.clock
+	}
+	return time.Now
+}
+
+// tics holds the times at which each label was last started by tic.
+type tics struct {
+	start map[string]time.Time
+	mu    sync.Mutex
+}
+
+func newTics() *tics {
+	return &tics{start: make(map[string]time.Time)}
+}
+
+func (t *tics) set(label string, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.start[label] = now
+}
+
+func (t *tics) get(label string) (time.Time, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	start, ok := t.start[label]
+	return start, ok
+}
+
+// ticCommand starts, or restarts, timing label on the loop's clock.
+type ticCommand struct {
+	label string
+}
+
+func (tic *ticCommand) attrs() []any {
+	return []any{"label", tic.label}
+}
+
+func (tic *ticCommand) Execute(handler Handler) {
+	if h, ok := findHandler[workerHandler](handler); ok {
+		h.tics.set(tic.label, h.clock())
+	}
+}
+
+// tocCommand prints the time elapsed since the tic of label, as in
+// "load: 1.5s". The tic stays, so that several tocs measure laps from the
+// same start.
+type tocCommand struct {
+	label string
+}
+
+func (toc *tocCommand) attrs() []any {
+	return []any{"label", toc.label}
+}
+
+func (toc *tocCommand) Execute(handler Handler) {
+	h, ok := findHandler[workerHandler](handler)
+	var start time.Time
+	if ok {
+		start, ok = h.tics.get(toc.label)
+	}
+	if !ok {
+		handler.Post(&errorCommand{msg: fmt.Sprintf(UnmatchedTocError, toc.label)})
+		return
+	}
+	elapsed := h.clock().Sub(start)
+	returnResult(handler, elapsed)
+	handler.Post(&printCommand{arg: fmt.Sprintf("%v: %v", toc.label, elapsed)})
+}
+
+func parseTic(command string, build func(label string) Command) ParseFunc {
+	return func(args []string) (Command, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf(AmbiguousArgsNumberError, command)
+		}
+		return build(args[0]), nil
+	}
+}
+
+// parseNow accepts "now <var> [format]"; the format defaults to unix.
+func parseNow(args []string) (Command, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "now")
+	}
+	format := "unix"
+	if len(args) == 2 {
+		format = args[1]
+	}
+	if _, ok := timeFormats[format]; !ok {
+		return nil, fmt.Errorf(UnknownTimeFormatError, format)
+	}
+	return &nowCommand{name: args[0], format: format}, nil
+}
@@ -0,0 +1,64 @@
+package eventloop
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNow(t *testing.T) {
+	at := time.Date(2024, time.March, 1, 12, 30, 0, 500, time.UTC)
+	clock := WithClock(func() time.Time { return at })
+
+	for _, c := range []struct {
+		format string
+		want   string
+	}{
+		{"", fmt.Sprint(at.Unix())},
+		{"unix", fmt.Sprint(at.Unix())},
+		{"unixmilli", fmt.Sprint(at.UnixMilli())},
+		{"unixnano", fmt.Sprint(at.UnixNano())},
+		{"rfc3339", "2024-03-01T12:30:00Z"},
+		{"rfc3339nano", "2024-03-01T12:30:00.0000005Z"},
+	} {
+		checkOutput(t, "now ts "+c.format+"\nget ts", c.want+"\n", "", clock)
+	}
+	// The Unix formats store integers.
+	checkOutput(t, "now ts\nadd ts 1", fmt.Sprint(at.Unix()+1)+"\n", "", clock)
+}
+
+func TestNowErrors(t *testing.T) {
+	for _, line := range []string{"now", "now ts unix extra"} {
+		if _, err := Parse(line); err == nil {
+			t.Errorf("Parse(%q) succeeded, want an error", line)
+		}
+	}
+	if _, err := Parse("now ts weekday"); err == nil || err.Error() != fmt.Sprintf(UnknownTimeFormatError, "weekday") {
+		t.Errorf("Parse of an unknown format = %v, want %q", err, fmt.Sprintf(UnknownTimeFormatError, "weekday"))
+	}
+}
+
+// steppingClock returns a clock that advances by step every time it is read.
+func steppingClock(step time.Duration) func() time.Time {
+	var mu sync.Mutex
+	now := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	return func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+
+		now = now.Add(step)
+		return now
+	}
+}
+
+func TestTicToc(t *testing.T) {
+	clock := WithClock(steppingClock(1500 * time.Millisecond))
+	checkOutput(t, "tic load\ntoc load\ntoc load", "load: 1.5s\nload: 3s\n", "", clock)
+	// Labels are timed apart, and a second tic restarts its label.
+	checkOutput(t, "tic a\ntic b\ntoc a\ntic a\ntoc b\ntoc a", "a: 3s\nb: 4.5s\na: 3s\n", "", clock)
+}
+
+func TestTocWithoutTic(t *testing.T) {
+	checkOutput(t, "tic a\ntoc b", "", "line 2: "+fmt.Sprintf(UnmatchedTocError, "b")+"\n")
+}
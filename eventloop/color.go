@@ -0,0 +1,29 @@
+package eventloop
+
+import "strings"
+
+// MARK: - Colors
+
+const (
+	ansiRed   = "\x1b[31m"
+	ansiReset = "\x1b[0m"
+)
+
+// WithColor makes the loop write the errors it reports in red using ANSI
+// escape codes. The output of print commands is unchanged.
+func WithColor(color bool) Option {
+	return func(l *EventLoop) {
+		l.color = color
+	}
+}
+
+// ColorError wraps the text of an error message in the escape codes for red,
+// keeping a trailing newline outside of them.
+func ColorError(s string) string {
+	text, found := strings.CutSuffix(s, "\n")
+	s = ansiRed + text + ansiReset
+	if found {
+		s += "\n"
+	}
+	return s
+}
@@ -0,0 +1,19 @@
+package eventloop
+
+import "testing"
+
+func TestColorError(t *testing.T) {
+	for _, c := range []struct{ in, want string }{
+		{"error: boom\n", "\x1b[31merror: boom\x1b[0m\n"},
+		{"error: boom", "\x1b[31merror: boom\x1b[0m"},
+	} {
+		if got := ColorError(c.in); got != c.want {
+			t.Errorf("ColorError(%q) = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestWithColor(t *testing.T) {
+	checkOutput(t, "print hi\ndiv 1 0", "hi\n", ColorError("line 2: "+DivisionByZeroError+"\n"), WithColor(true))
+	checkOutput(t, "print hi\ndiv 1 0", "hi\n", "line 2: "+DivisionByZeroError+"\n", WithColor(false))
+}
@@ -0,0 +1,1018 @@
+package eventloop
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const DivisionByZeroError string = "error: division by zero"
+const UndefinedVariableError string = "error: undefined variable %v"
+const IntegerOverflowError string = "error: integer overflow"
+const NegativeExponentError string = "error: negative exponent %v"
+const AssertionFailedError string = "error: assertion failed: %v %v %v (%v is %v)"
+const QueueNotEmptyError string = "error: assertion failed: queue not empty (%v queued)"
+const RequirementMissingError string = "error: requirement failed: %v:%v is undefined"
+const RequirementTypeError string = "error: requirement failed: %v:%v is %v (%v)"
+
+// MARK: - Commands
+
+// stopCommand ends a drain. Before stopping it waits for scheduled commands
+// and for the other workers to go idle and, if any commands were posted
+// meanwhile, goes back to the tail to run them first.
+type stopCommand struct {
+	loop *EventLoop
+}
+
+func (s *stopCommand) Execute(handler Handler) {
+	s.loop.timers.wait()
+	if s.loop.queue.settle() > 0 {
+		handler.Post(s)
+		return
+	}
+	handler.Stop()
+}
+
+// waitCommand re-posts itself until it is the last pending command.
+type waitCommand struct {
+	loop *EventLoop
+	done chan struct{}
+}
+
+func (w *waitCommand) Execute(handler Handler) {
+	if w.loop.queue.settle() > 0 {
+		handler.Post(w)
+		return
+	}
+	w.loop.flush()
+	close(w.done)
+}
+
+// sameCommand reports whether a and b are of the same type and hold equal
+// arguments. Internal commands are never the same as another command, and
+// neither are commands holding functions or channels, which only compare
+// equal when nil. The lines instructions were read from don't matter.
+func sameCommand(a, b Command) bool {
+	if isInternal(a) || isInternal(b) {
+		return false
+	}
+	fa, okA := a.(*fileCommand)
+	fb, okB := b.(*fileCommand)
+	if okA && okB {
+		return reflect.DeepEqual(fa.file, fb.file) && sameCommand(fa.cmd, fb.cmd)
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// A wrapping handler decorates the handler of the command it executes so
+// that nested commands can reach extra context, like the result channel of
+// PostWithResult or the program being stepped through.
+type wrappingHandler interface {
+	unwrap() Handler
+}
+
+// findHandler looks for a handler of type T among handler and the handlers
+// it wraps.
+func findHandler[T Handler](handler Handler) (T, bool) {
+	for {
+		if h, ok := handler.(T); ok {
+			return h, true
+		}
+		w, ok := handler.(wrappingHandler)
+		if !ok {
+			var zero T
+			return zero, false
+		}
+		handler = w.unwrap()
+	}
+}
+
+// resultCommand executes cmd with a handler that captures its result.
+type resultCommand struct {
+	cmd     Command
+	results chan any
+}
+
+func (r *resultCommand) Execute(handler Handler) {
+	r.cmd.Execute(&resultHandler{Handler: handler, results: r.results})
+	close(r.results)
+}
+
+type resultHandler struct {
+	Handler
+	results chan any
+}
+
+func (h *resultHandler) unwrap() Handler {
+	return h.Handler
+}
+
+func (h *resultHandler) result(val any) {
+	select {
+	case h.results <- val:
+	default:
+	}
+}
+
+// returnResult hands val to PostWithResult callers, if there are any.
+func returnResult(handler Handler, val any) {
+	if h, ok := findHandler[*resultHandler](handler); ok {
+		h.result(val)
+	}
+}
+
+// printCommand writes arg on a line of its own. Prints parsed from
+// instructions set expand, so that $name references are interpolated when
+// the print executes; see interpolate. The others carry the results the
+// loop's commands print.
+type printCommand struct {
+	arg    string
+	expand bool
+}
+
+func (p *printCommand) Execute(handler Handler) {
+	arg := p.arg
+	if p.expand {
+		var ok bool
+		if arg, ok = interpolate(handler, arg); !ok {
+			return
+		}
+	}
+	fmt.Fprintln(handler.Output(), arg)
+}
+
+// interpolate replaces every $name in s with the text of variable name and
+// every $$ with a single $. A $ not followed by a name is kept as is. If a
+// referenced variable is undefined the error is reported and the second
+// result is false.
+func interpolate(handler Handler, s string) (string, bool) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+1 < len(s) && s[i+1] == '$' {
+			b.WriteByte('$')
+			i++
+			continue
+		}
+		end := i + 1 + strings.IndexFunc(s[i+1:], func(r rune) bool {
+			return r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		if end == i {
+			end = len(s)
+		}
+		name := s[i+1 : end]
+		if !isIdentifier(name) {
+			b.WriteByte('$')
+			continue
+		}
+		val, ok := lookupVar(handler, name)
+		if !ok {
+			return "", false
+		}
+		b.WriteString(val.String())
+		i = end - 1
+	}
+	return b.String(), true
+}
+
+// Arithmetic commands operate on int64. A result that doesn't fit prints
+// IntegerOverflowError instead.
+
+// addCommand prints the total of two or more operands.
+type addCommand struct {
+	args []operand
+}
+
+func (add *addCommand) attrs() []any {
+	if len(add.args) == 2 {
+		return []any{"arg1", add.args[0], "arg2", add.args[1]}
+	}
+	return []any{"args", add.args}
+}
+
+func (add *addCommand) Execute(handler Handler) {
+	res, ok := sumOperands(handler, add.args)
+	if !ok {
+		return
+	}
+	returnResult(handler, res)
+	handler.Post(&printCommand{arg: strconv.FormatInt(res, 10)})
+}
+
+type subCommand struct {
+	arg1, arg2 operand
+}
+
+func (sub *subCommand) attrs() []any {
+	return []any{"arg1", sub.arg1, "arg2", sub.arg2}
+}
+
+func (sub *subCommand) Execute(handler Handler) {
+	arg1, arg2, ok := resolveOperands(handler, sub.arg1, sub.arg2)
+	if !ok {
+		return
+	}
+	res, ok := checkedSub(arg1, arg2)
+	if !ok {
+		handler.Post(&errorCommand{msg: IntegerOverflowError})
+		return
+	}
+	returnResult(handler, res)
+	handler.Post(&printCommand{arg: strconv.FormatInt(res, 10)})
+}
+
+type mulCommand struct {
+	arg1, arg2 operand
+}
+
+func (mul *mulCommand) attrs() []any {
+	return []any{"arg1", mul.arg1, "arg2", mul.arg2}
+}
+
+func (mul *mulCommand) Execute(handler Handler) {
+	arg1, arg2, ok := resolveOperands(handler, mul.arg1, mul.arg2)
+	if !ok {
+		return
+	}
+	res, ok := checkedMul(arg1, arg2)
+	if !ok {
+		handler.Post(&errorCommand{msg: IntegerOverflowError})
+		return
+	}
+	returnResult(handler, res)
+	handler.Post(&printCommand{arg: strconv.FormatInt(res, 10)})
+}
+
+// divCommand performs integer division, truncating the quotient towards zero
+// (7/2 is 3, -7/2 is -3). A zero divisor prints DivisionByZeroError, and
+// MinInt64 / -1 prints IntegerOverflowError.
+type divCommand struct {
+	arg1, arg2 operand
+}
+
+func (div *divCommand) attrs() []any {
+	return []any{"arg1", div.arg1, "arg2", div.arg2}
+}
+
+func (div *divCommand) Execute(handler Handler) {
+	arg1, arg2, ok := resolveOperands(handler, div.arg1, div.arg2)
+	if !ok {
+		return
+	}
+	if arg2 == 0 {
+		handler.Post(&errorCommand{msg: DivisionByZeroError})
+		return
+	}
+	res, ok := checkedDiv(arg1, arg2)
+	if !ok {
+		handler.Post(&errorCommand{msg: IntegerOverflowError})
+		return
+	}
+	returnResult(handler, res)
+	handler.Post(&printCommand{arg: strconv.FormatInt(res, 10)})
+}
+
+// modCommand computes the remainder of truncated division, so the result has
+// the sign of the dividend: 7 mod 3 is 1, -7 mod 3 is -1 and 7 mod -3 is 1. A
+// zero divisor prints DivisionByZeroError.
+type modCommand struct {
+	arg1, arg2 operand
+}
+
+func (mod *modCommand) attrs() []any {
+	return []any{"arg1", mod.arg1, "arg2", mod.arg2}
+}
+
+func (mod *modCommand) Execute(handler Handler) {
+	arg1, arg2, ok := resolveOperands(handler, mod.arg1, mod.arg2)
+	if !ok {
+		return
+	}
+	if arg2 == 0 {
+		handler.Post(&errorCommand{msg: DivisionByZeroError})
+		return
+	}
+	res := arg1 % arg2
+	returnResult(handler, res)
+	handler.Post(&printCommand{arg: strconv.FormatInt(res, 10)})
+}
+
+// powCommand raises arg1 to the non-negative power arg2. A negative exponent
+// prints NegativeExponentError and a result that doesn't fit in int64 prints
+// IntegerOverflowError.
+type powCommand struct {
+	arg1, arg2 operand
+}
+
+func (pow *powCommand) attrs() []any {
+	return []any{"arg1", pow.arg1, "arg2", pow.arg2}
+}
+
+func (pow *powCommand) Execute(handler Handler) {
+	base, exp, ok := resolveOperands(handler, pow.arg1, pow.arg2)
+	if !ok {
+		return
+	}
+	if exp < 0 {
+		handler.Post(&errorCommand{msg: fmt.Sprintf(NegativeExponentError, exp)})
+		return
+	}
+	res, ok := checkedPow(base, exp)
+	if !ok {
+		handler.Post(&errorCommand{msg: IntegerOverflowError})
+		return
+	}
+	returnResult(handler, res)
+	handler.Post(&printCommand{arg: strconv.FormatInt(res, 10)})
+}
+
+// negCommand prints -arg. Negating MinInt64 prints IntegerOverflowError.
+type negCommand struct {
+	arg operand
+}
+
+func (neg *negCommand) attrs() []any {
+	return []any{"arg", neg.arg}
+}
+
+func (neg *negCommand) Execute(handler Handler) {
+	arg, ok := neg.arg.resolve(handler)
+	if !ok {
+		return
+	}
+	res, ok := checkedSub(0, arg)
+	if !ok {
+		handler.Post(&errorCommand{msg: IntegerOverflowError})
+		return
+	}
+	returnResult(handler, res)
+	handler.Post(&printCommand{arg: strconv.FormatInt(res, 10)})
+}
+
+// minCommand stores the smaller of two operands in a variable.
+type minCommand struct {
+	dest       string
+	arg1, arg2 operand
+}
+
+func (m *minCommand) attrs() []any {
+	return []any{"var", m.dest, "arg1", m.arg1, "arg2", m.arg2}
+}
+
+func (m *minCommand) Execute(handler Handler) {
+	arg1, arg2, ok := resolveOperands(handler, m.arg1, m.arg2)
+	if !ok {
+		return
+	}
+	res := min(arg1, arg2)
+	handler.Vars().Set(m.dest, IntValue(res))
+	returnResult(handler, res)
+}
+
+// maxCommand stores the larger of two operands in a variable.
+type maxCommand struct {
+	dest       string
+	arg1, arg2 operand
+}
+
+func (m *maxCommand) attrs() []any {
+	return []any{"var", m.dest, "arg1", m.arg1, "arg2", m.arg2}
+}
+
+func (m *maxCommand) Execute(handler Handler) {
+	arg1, arg2, ok := resolveOperands(handler, m.arg1, m.arg2)
+	if !ok {
+		return
+	}
+	res := max(arg1, arg2)
+	handler.Vars().Set(m.dest, IntValue(res))
+	returnResult(handler, res)
+}
+
+// sumCommand stores the total of any number of operands in a variable. The
+// sum of no operands is zero.
+type sumCommand struct {
+	dest string
+	args []operand
+}
+
+func (sum *sumCommand) attrs() []any {
+	return []any{"var", sum.dest, "args", sum.args}
+}
+
+func (sum *sumCommand) Execute(handler Handler) {
+	res, ok := sumOperands(handler, sum.args)
+	if !ok {
+		return
+	}
+	handler.Vars().Set(sum.dest, IntValue(res))
+	returnResult(handler, res)
+}
+
+// sumOperands adds up the resolved operands, reporting an overflow.
+func sumOperands(handler Handler, args []operand) (int64, bool) {
+	var res int64
+	for _, o := range args {
+		arg, ok := o.resolve(handler)
+		if !ok {
+			return 0, false
+		}
+		if res, ok = checkedAdd(res, arg); !ok {
+			handler.Post(&errorCommand{msg: IntegerOverflowError})
+			return 0, false
+		}
+	}
+	return res, true
+}
+
+// absCommand stores the absolute value of an operand in a variable. The
+// absolute value of math.MinInt64 doesn't fit in int64 and is an overflow.
+type absCommand struct {
+	dest string
+	arg  operand
+}
+
+func (a *absCommand) attrs() []any {
+	return []any{"var", a.dest, "arg", a.arg}
+}
+
+func (a *absCommand) Execute(handler Handler) {
+	res, ok := a.arg.resolve(handler)
+	if !ok {
+		return
+	}
+	if res < 0 {
+		if res, ok = checkedSub(0, res); !ok {
+			handler.Post(&errorCommand{msg: IntegerOverflowError})
+			return
+		}
+	}
+	handler.Vars().Set(a.dest, IntValue(res))
+	returnResult(handler, res)
+}
+
+// checkedAdd, checkedSub and checkedMul report false instead of wrapping
+// around when the result overflows int64.
+
+func checkedAdd(a, b int64) (int64, bool) {
+	res := a + b
+	return res, (res > a) == (b > 0)
+}
+
+func checkedSub(a, b int64) (int64, bool) {
+	res := a - b
+	return res, (res < a) == (b > 0)
+}
+
+func checkedMul(a, b int64) (int64, bool) {
+	if a == 0 || b == 0 {
+		return 0, true
+	}
+	res := a * b
+	// MinInt64 / -1 wraps around to MinInt64, hiding that overflow.
+	return res, res/b == a && !(b == -1 && a == math.MinInt64)
+}
+
+// checkedDiv divides a non-zero b into a, reporting false for MinInt64 / -1.
+func checkedDiv(a, b int64) (int64, bool) {
+	if a == math.MinInt64 && b == -1 {
+		return 0, false
+	}
+	return a / b, true
+}
+
+// checkedPow computes base**exp by repeated squaring, reporting false as soon
+// as an intermediate product overflows. Squares are only taken while there
+// are exponent bits left they contribute to, so a square that overflows
+// always means the result does too.
+func checkedPow(base, exp int64) (int64, bool) {
+	res := int64(1)
+	for ok := true; exp > 0; {
+		if exp&1 == 1 {
+			if res, ok = checkedMul(res, base); !ok {
+				return 0, false
+			}
+		}
+		exp >>= 1
+		if exp > 0 {
+			if base, ok = checkedMul(base, base); !ok {
+				return 0, false
+			}
+		}
+	}
+	return res, true
+}
+
+// sleepCommand blocks the worker for d. Since the loop executes one command
+// at a time, every command queued behind it waits as well.
+type sleepCommand struct {
+	d time.Duration
+}
+
+func (s *sleepCommand) Execute(handler Handler) {
+	flushOutput(handler)
+	time.Sleep(s.d)
+}
+
+// afterCommand schedules cmd to be posted after d; it doesn't block the loop.
+type afterCommand struct {
+	d   time.Duration
+	cmd Command
+}
+
+func (a *afterCommand) Execute(handler Handler) {
+	handler.Schedule(a.d, a.cmd)
+}
+
+// repeatCommand executes cmd n times in place, so the repetitions run before
+// anything queued behind the repeat.
+type repeatCommand struct {
+	n   int64
+	cmd Command
+}
+
+func (r *repeatCommand) Execute(handler Handler) {
+	for i := int64(0); i < r.n; i++ {
+		r.cmd.Execute(handler)
+	}
+}
+
+// foreachCommand executes cmd in place once for every integer from start to
+// end, both included, with the variable name set to it. The range counts down
+// when start is above end, so it is never empty. Afterwards name holds end.
+type foreachCommand struct {
+	name       string
+	start, end int64
+	cmd        Command
+}
+
+func (f *foreachCommand) attrs() []any {
+	return []any{"var", f.name, "start", f.start, "end", f.end}
+}
+
+func (f *foreachCommand) Execute(handler Handler) {
+	step := int64(1)
+	if f.start > f.end {
+		step = -1
+	}
+	for i := f.start; ; i += step {
+		handler.Vars().Set(f.name, IntValue(i))
+		f.cmd.Execute(handler)
+		if i == f.end {
+			return
+		}
+	}
+}
+
+// ifCommand executes cmd in place when the condition holds.
+type ifCommand struct {
+	cond *condition
+	cmd  Command
+}
+
+func (i *ifCommand) Execute(handler Handler) {
+	if ok, _ := i.cond.eval(handler); ok {
+		i.cmd.Execute(handler)
+	}
+}
+
+// stopifCommand stops the loop like exit, abandoning anything still queued,
+// if its condition holds, and does nothing otherwise. It leaves the exit
+// status as it is.
+type stopifCommand struct {
+	cond *condition
+}
+
+func (s *stopifCommand) Execute(handler Handler) {
+	if ok, _ := s.cond.eval(handler); ok {
+		handler.Stop()
+	}
+}
+
+// assertCommand reports a failed condition and makes the program exit with
+// status 1, unless an exit command requests another status. Execution goes on
+// so that every failing assert is reported, except on a fail-fast loop, which
+// stops at the first failure.
+type assertCommand struct {
+	cond *condition
+}
+
+func (a *assertCommand) Execute(handler Handler) {
+	c := a.cond
+	arg1, arg2, ok := resolveOperands(handler, operand{name: c.name}, c.value)
+	if ok && c.compare(arg1, arg2) {
+		return
+	}
+	msg := ""
+	if ok {
+		msg = fmt.Sprintf(AssertionFailedError, c.name, c.op, c.value, c.name, arg1)
+	}
+	failAssert(handler, msg)
+}
+
+// failAssert reports msg, unless it is empty, and sets the exit status of a
+// failed assert, stopping a fail-fast loop.
+func failAssert(handler Handler, msg string) {
+	h, found := findHandler[workerHandler](handler)
+	if msg != "" {
+		e := &errorCommand{msg: msg}
+		if found && h.failFast {
+			// Posting it would be abandoned by the Stop below, and miss the
+			// line the posting would add.
+			e.severity = SeverityFatal
+			if fh, ok := findHandler[*fileHandler](handler); ok {
+				e.line = fh.line
+			}
+			e.Execute(handler)
+		} else {
+			handler.Post(e)
+		}
+	}
+	if found {
+		h.exitCode.CompareAndSwap(0, 1)
+		if h.failFast {
+			handler.Stop()
+		}
+	}
+}
+
+// assertemptyCommand fails like an assert if any command is queued behind
+// it, checking that the commands before it have settled. Commands like add
+// post the print of their result when they execute, so the print of an add
+// right before it is still queued, and fails it. The loop's bookkeeping, the
+// marker of a pending drain and those of Wait, doesn't count.
+type assertemptyCommand struct{}
+
+func (a *assertemptyCommand) Execute(handler Handler) {
+	h, ok := findHandler[workerHandler](handler)
+	if !ok {
+		return
+	}
+	n := 0
+	for _, cmd := range h.queue.snapshot() {
+		if !isInternal(cmd) {
+			n += weight(cmd)
+		}
+	}
+	if ph, ok := findHandler[*programHandler](handler); ok {
+		n += ph.pending()
+	}
+	if n > 0 {
+		failAssert(handler, fmt.Sprintf(QueueNotEmptyError, n))
+	}
+}
+
+// requirement is a variable required by require, and its type.
+type requirement struct {
+	name, typ string
+}
+
+// requireCommand fails like an assert for every variable it requires that
+// is undefined or has another type, such as a string required as an int.
+// Unlike an integer operand, a float isn't taken for an int.
+type requireCommand struct {
+	reqs []requirement
+}
+
+func (r *requireCommand) attrs() []any {
+	return []any{"requirements", r.reqs}
+}
+
+func (r *requireCommand) Execute(handler Handler) {
+	h, found := findHandler[workerHandler](handler)
+	for _, req := range r.reqs {
+		if found && h.Stopped() {
+			return
+		}
+		val, ok := handler.Vars().Get(req.name)
+		switch {
+		case !ok:
+			failAssert(handler, fmt.Sprintf(RequirementMissingError, req.name, req.typ))
+		case val.Type() != req.typ:
+			failAssert(handler, fmt.Sprintf(RequirementTypeError, req.name, req.typ, val.Type(), val))
+		}
+	}
+}
+
+// clearCommand discards the commands queued behind it, the rest of the
+// program it is part of included.
+type clearCommand struct{}
+
+func (c *clearCommand) Execute(handler Handler) {
+	if ph, ok := findHandler[*programHandler](handler); ok {
+		ph.clear()
+	}
+	if h, ok := findHandler[workerHandler](handler); ok {
+		h.ClearQueue()
+	}
+}
+
+// cancelscheduledCommand cancels the commands scheduled by after, and by
+// Schedule, that haven't fired yet, like CancelScheduled.
+type cancelscheduledCommand struct{}
+
+func (c *cancelscheduledCommand) Execute(handler Handler) {
+	if h, ok := findHandler[workerHandler](handler); ok {
+		returnResult(handler, h.CancelScheduled())
+	}
+}
+
+// aliasCommand is what remains of an alias definition once it has been
+// parsed; executing it does nothing.
+type aliasCommand struct {
+	name, target string
+}
+
+func (a *aliasCommand) Execute(handler Handler) {}
+
+// nopCommand does nothing, but goes through the queue and is counted by the
+// metrics like any other command.
+type nopCommand struct{}
+
+func (n *nopCommand) Execute(handler Handler) {}
+
+// barrierCommand waits for the commands that started before it to finish,
+// and holds back those queued after it until then. A single worker executes
+// commands one at a time anyway, so there it does nothing; with WithWorkers
+// it orders the commands on either side of it, like Wait does for a caller.
+type barrierCommand struct{}
+
+func (b *barrierCommand) Execute(handler Handler) {
+	if h, ok := findHandler[workerHandler](handler); ok {
+		h.queue.barrier()
+	}
+}
+
+// flushCommand writes out the output buffered by WithBufferedOutput, so that
+// everything printed before it is visible before the commands after it run.
+type flushCommand struct{}
+
+func (f *flushCommand) Execute(handler Handler) {
+	flushOutput(handler)
+}
+
+// qdepthCommand prints how many commands are queued behind it, as reported
+// by QueueLen when it executes, counting the rest of the program it is part
+// of, if any.
+type qdepthCommand struct{}
+
+func (q *qdepthCommand) Execute(handler Handler) {
+	h, ok := findHandler[workerHandler](handler)
+	if !ok {
+		return
+	}
+	n := h.QueueLen()
+	if ph, ok := findHandler[*programHandler](handler); ok {
+		n += ph.pending()
+	}
+	returnResult(handler, n)
+	handler.Post(&printCommand{arg: strconv.Itoa(n)})
+}
+
+// exitCommand records the status the program should exit with and stops the
+// loop, abandoning anything still queued.
+type exitCommand struct {
+	code int
+}
+
+func (e *exitCommand) Execute(handler Handler) {
+	if h, ok := findHandler[workerHandler](handler); ok {
+		h.exitCode.Store(int32(e.code))
+	}
+	handler.Stop()
+}
+
+type setCommand struct {
+	name string
+	val  Value
+}
+
+func (set *setCommand) Execute(handler Handler) {
+	handler.Vars().Set(set.name, set.val)
+}
+
+// incCommand adds delta, 1 for inc and -1 for dec, to a variable. An
+// undefined variable starts at zero, so a counter needs no set beforehand.
+type incCommand struct {
+	name  string
+	delta int64
+}
+
+func (inc *incCommand) Execute(handler Handler) {
+	val, err := handler.Vars().Add(inc.name, inc.delta)
+	if err != nil {
+		handler.Post(&errorCommand{msg: err.Error()})
+		return
+	}
+	returnResult(handler, val)
+}
+
+// addtoCommand adds an amount to a variable in place, like inc by any
+// amount. The variable is read and written in a single step of the store, so
+// concurrent workers adding to it don't lose updates.
+type addtoCommand struct {
+	name   string
+	amount operand
+}
+
+func (a *addtoCommand) attrs() []any {
+	return []any{"var", a.name, "amount", a.amount}
+}
+
+func (a *addtoCommand) Execute(handler Handler) {
+	amount, ok := a.amount.resolve(handler)
+	if !ok {
+		return
+	}
+	val, err := handler.Vars().Add(a.name, amount)
+	if err != nil {
+		handler.Post(&errorCommand{msg: err.Error()})
+		return
+	}
+	returnResult(handler, val)
+}
+
+// concatCommand stores the concatenation of two strings in a variable. Both
+// are interpolated like the text of a print, so "$a" stands for the value of
+// a and anything else for itself.
+type concatCommand struct {
+	name       string
+	arg1, arg2 string
+}
+
+func (c *concatCommand) attrs() []any {
+	return []any{"var", c.name, "arg1", c.arg1, "arg2", c.arg2}
+}
+
+func (c *concatCommand) Execute(handler Handler) {
+	arg1, ok := interpolate(handler, c.arg1)
+	if !ok {
+		return
+	}
+	arg2, ok := interpolate(handler, c.arg2)
+	if !ok {
+		return
+	}
+	res := arg1 + arg2
+	handler.Vars().Set(c.name, StringValue(res))
+	returnResult(handler, res)
+}
+
+// lenCommand stores the length of a variable's text in characters, that is
+// Unicode code points rather than bytes, in another variable.
+type lenCommand struct {
+	dest, src string
+}
+
+func (l *lenCommand) attrs() []any {
+	return []any{"dest", l.dest, "src", l.src}
+}
+
+func (l *lenCommand) Execute(handler Handler) {
+	val, ok := lookupVar(handler, l.src)
+	if !ok {
+		return
+	}
+	res := int64(utf8.RuneCountInString(val.String()))
+	handler.Vars().Set(l.dest, IntValue(res))
+	returnResult(handler, res)
+}
+
+type getCommand struct {
+	name string
+}
+
+func (get *getCommand) Execute(handler Handler) {
+	val, ok := handler.Vars().Get(get.name)
+	if !ok {
+		handler.Post(&errorCommand{msg: fmt.Sprintf(UndefinedVariableError, get.name)})
+		return
+	}
+	returnResult(handler, val.native())
+	handler.Post(&printCommand{arg: val.String()})
+}
+
+// unsetCommand removes a variable, after which it reads as undefined.
+// Unsetting an undefined variable does nothing.
+type unsetCommand struct {
+	name string
+}
+
+func (u *unsetCommand) Execute(handler Handler) {
+	handler.Vars().Delete(u.name)
+}
+
+// dumpvarsCommand prints every variable as name=value, sorted by name.
+type dumpvarsCommand struct{}
+
+func (d *dumpvarsCommand) Execute(handler Handler) {
+	vars := handler.Vars().Snapshot()
+	if len(vars) == 0 {
+		return
+	}
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	lines := make([]string, len(names))
+	for i, name := range names {
+		lines[i] = name + "=" + vars[name].String()
+	}
+	handler.Post(&printCommand{arg: strings.Join(lines, "\n")})
+}
+
+// copyCommand sets a variable to the value of another, which cp leaves
+// alone and mv removes.
+type copyCommand struct {
+	dest, src string
+	move      bool
+}
+
+func (c *copyCommand) attrs() []any {
+	return []any{"dest", c.dest, "src", c.src, "move", c.move}
+}
+
+func (c *copyCommand) Execute(handler Handler) {
+	if err := handler.Vars().Copy(c.dest, c.src, c.move); err != nil {
+		handler.Post(&errorCommand{msg: err.Error()})
+	}
+}
+
+// swapCommand exchanges the values of two defined variables.
+type swapCommand struct {
+	a, b string
+}
+
+func (s *swapCommand) attrs() []any {
+	return []any{"a", s.a, "b", s.b}
+}
+
+func (s *swapCommand) Execute(handler Handler) {
+	if err := handler.Vars().Swap(s.a, s.b); err != nil {
+		handler.Post(&errorCommand{msg: err.Error()})
+	}
+}
+
+// MARK: - Operands
+
+// operand is either an integer literal or the name of a variable. Variables
+// are resolved when the owning command executes rather than when it is
+// parsed, so a set queued before the command is always observed.
+type operand struct {
+	val  int64
+	name string
+}
+
+func (o operand) String() string {
+	if o.name != "" {
+		return o.name
+	}
+	return strconv.FormatInt(o.val, 10)
+}
+
+func (o operand) resolve(handler Handler) (int64, bool) {
+	if o.name == "" {
+		return o.val, true
+	}
+	val, ok := lookupVar(handler, o.name)
+	if !ok {
+		return 0, false
+	}
+	n, err := val.toInt(o.name)
+	if err != nil {
+		handler.Post(&errorCommand{msg: err.Error()})
+	}
+	return n, err == nil
+}
+
+// lookupVar returns the value of the variable name, reporting it if it is
+// undefined.
+func lookupVar(handler Handler, name string) (Value, bool) {
+	val, ok := handler.Vars().Get(name)
+	if !ok {
+		handler.Post(&errorCommand{msg: fmt.Sprintf(UndefinedVariableError, name)})
+	}
+	return val, ok
+}
+
+func resolveOperands(handler Handler, o1, o2 operand) (int64, int64, bool) {
+	arg1, ok := o1.resolve(handler)
+	if !ok {
+		return 0, 0, false
+	}
+	arg2, ok := o2.resolve(handler)
+	if !ok {
+		return 0, 0, false
+	}
+	return arg1, arg2, true
+}
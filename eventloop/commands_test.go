@@ -0,0 +1,596 @@
+package eventloop
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// checkOutput runs script and compares what it printed and reported.
+func checkOutput(t *testing.T, script, wantOut, wantErrs string, opts ...Option) {
+	t.Helper()
+
+	out, errs := runScript(t, script, opts...)
+	if out != wantOut {
+		t.Errorf("output of %q = %q, want %q", script, out, wantOut)
+	}
+	if errs != wantErrs {
+		t.Errorf("errors of %q = %q, want %q", script, errs, wantErrs)
+	}
+}
+
+func TestSub(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   string
+	}{
+		{"positive", "sub 7 3", "4\n"},
+		{"negative", "sub 3 7", "-4\n"},
+		{"zero", "sub 5 5", "0\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkOutput(t, tt.script, tt.want, "")
+		})
+	}
+}
+
+func TestMul(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   string
+	}{
+		{"positive", "mul 6 7", "42\n"},
+		{"by zero", "mul 5 0", "0\n"},
+		{"by a negative", "mul 4 -3", "-12\n"},
+		{"two negatives", "mul -4 -3", "12\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkOutput(t, tt.script, tt.want, "")
+		})
+	}
+}
+
+func TestDiv(t *testing.T) {
+	tests := []struct {
+		name     string
+		script   string
+		want     string
+		wantErrs string
+	}{
+		{"exact", "div 8 2", "4\n", ""},
+		{"truncated", "div 7 2", "3\n", ""},
+		{"truncated towards zero", "div -7 2", "-3\n", ""},
+		{"by zero", "div 1 0", "", "line 1: error: division by zero\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkOutput(t, tt.script, tt.want, tt.wantErrs)
+		})
+	}
+}
+
+func TestSetGet(t *testing.T) {
+	tests := []struct {
+		name     string
+		script   string
+		want     string
+		wantErrs string
+	}{
+		{"set then get", "set x 5\nget x", "5\n", ""},
+		{"overwrite", "set x 5\nset x 6\nget x", "6\n", ""},
+		{"undefined", "get y", "", "line 1: error: undefined variable y\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkOutput(t, tt.script, tt.want, tt.wantErrs)
+		})
+	}
+}
+
+func TestArithmeticWithVariables(t *testing.T) {
+	checkOutput(t, "set x 5\nadd x 2", "7\n", "")
+	checkOutput(t, "set x 5\nset y 6\nadd x y", "11\n", "")
+	// Variables are read when the command executes, not when it is parsed.
+	checkOutput(t, "set x 1\nadd x 1\nset x 10\nadd x 1", "2\n11\n", "")
+	checkOutput(t, "add x 1", "", "line 1: error: undefined variable x\n")
+}
+
+func TestSleep(t *testing.T) {
+	start := time.Now()
+	checkOutput(t, "sleep 50\nprint done", "done\n", "")
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond || elapsed > time.Second {
+		t.Errorf("sleep 50 took %v, want about 50ms", elapsed)
+	}
+}
+
+func TestAfter(t *testing.T) {
+	start := time.Now()
+	checkOutput(t, "after 50 print later\nprint now\nadd 1 2", "now\n3\nlater\n", "")
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("the loop finished after %v, before the scheduled print was due", elapsed)
+	}
+}
+
+func TestRepeat(t *testing.T) {
+	tests := []struct {
+		n    string
+		want string
+	}{
+		{"0", "before\nafter\n"},
+		{"1", "before\nx\nafter\n"},
+		{"3", "before\nx\nx\nx\nafter\n"},
+	}
+	for _, tt := range tests {
+		t.Run("n="+tt.n, func(t *testing.T) {
+			checkOutput(t, "print before\nrepeat "+tt.n+" print x\nprint after", tt.want, "")
+		})
+	}
+}
+
+func TestIf(t *testing.T) {
+	tests := []struct {
+		op    string
+		holds string // compared with x = 5
+		fails string
+	}{
+		{"eq", "5", "6"},
+		{"ne", "6", "5"},
+		{"lt", "6", "5"},
+		{"le", "5", "4"},
+		{"gt", "4", "5"},
+		{"ge", "5", "6"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.op, func(t *testing.T) {
+			script := "set x 5\nif x " + tt.op + " " + tt.holds + " print yes\nif x " + tt.op + " " + tt.fails + " print no"
+			checkOutput(t, script, "yes\n", "")
+		})
+	}
+	t.Run("undefined", func(t *testing.T) {
+		checkOutput(t, "if y eq 1 print yes\nprint after", "after\n", "line 1: error: undefined variable y\n")
+	})
+}
+
+func TestPrintArguments(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   string
+	}{
+		{"no arguments", "print", "\n"},
+		{"one argument", "print a", "a\n"},
+		{"several arguments", "print a  b \"c  d\"", "a b c  d\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkOutput(t, tt.script, tt.want, "")
+		})
+	}
+}
+
+func TestPrintInterpolation(t *testing.T) {
+	tests := []struct {
+		name     string
+		script   string
+		want     string
+		wantErrs string
+	}{
+		{"defined", "set x 5\nprint x=$x", "x=5\n", ""},
+		{"undefined", "print $nope", "", "line 1: error: undefined variable nope\n"},
+		{"escaped dollar", "set x 5\nprint $$x costs $$5", "$x costs $5\n", ""},
+		{"lone dollar", "print 5 $", "5 $\n", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkOutput(t, tt.script, tt.want, tt.wantErrs)
+		})
+	}
+}
+
+func TestExit(t *testing.T) {
+	var out, errs syncBuffer
+	l := newTestLoop(&out, &errs)
+	l.Start()
+	postScript(t, l, "print a\nexit 3\nprint b")
+	l.AwaitFinish()
+
+	if code := l.ExitCode(); code != 3 {
+		t.Errorf("ExitCode() = %d, want 3", code)
+	}
+	if got := out.String(); got != "a\n" {
+		t.Errorf("output = %q, want nothing after the exit", got)
+	}
+}
+
+func TestAssert(t *testing.T) {
+	tests := []struct {
+		name     string
+		script   string
+		opts     []Option
+		want     string
+		wantErrs string
+		wantCode int
+	}{
+		{"passing", "set x 5\nassert x eq 5\nprint after", nil, "after\n", "", 0},
+		{"failing", "set x 5\nassert x gt 6\nprint after", nil, "after\n", "line 2: error: assertion failed: x gt 6 (x is 5)\n", 1},
+		{"failing fast", "set x 5\nassert x gt 6\nprint after", []Option{WithFailFast(true)}, "", "line 2: error: assertion failed: x gt 6 (x is 5)\n", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out, errs syncBuffer
+			l := newTestLoop(&out, &errs, tt.opts...)
+			l.Start()
+			postScript(t, l, tt.script)
+			l.AwaitFinish()
+			if got := out.String(); got != tt.want {
+				t.Errorf("output = %q, want %q", got, tt.want)
+			}
+			if got := errs.String(); got != tt.wantErrs {
+				t.Errorf("errors = %q, want %q", got, tt.wantErrs)
+			}
+			if code := l.ExitCode(); code != tt.wantCode {
+				t.Errorf("ExitCode() = %d, want %d", code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestIntegerOverflow(t *testing.T) {
+	overflow := "line 1: " + IntegerOverflowError + "\n"
+	tests := []struct {
+		name     string
+		script   string
+		want     string
+		wantErrs string
+	}{
+		{"MaxInt64 + 1", "add 9223372036854775807 1", "", overflow},
+		{"MinInt64 - 1", "sub -9223372036854775808 1", "", overflow},
+		{"MaxInt64 * 2", "mul 9223372036854775807 2", "", overflow},
+		{"up to MaxInt64", "add 9223372036854775806 1", "9223372036854775807\n", ""},
+		{"down to MinInt64", "sub -9223372036854775807 1", "-9223372036854775808\n", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkOutput(t, tt.script, tt.want, tt.wantErrs)
+		})
+	}
+}
+
+func TestClear(t *testing.T) {
+	var out, errs syncBuffer
+	l := newTestLoop(&out, &errs)
+	postScript(t, l, "print a\nclear\nprint b\nprint c")
+	l.StopAndDrain()
+	l.Start()
+	if err := l.AwaitFinishTimeout(time.Second); err != nil {
+		t.Fatalf("the drain didn't finish after clear: %v", err)
+	}
+	if got := out.String(); got != "a\n" {
+		t.Errorf("output = %q, want the commands queued behind clear dropped", got)
+	}
+}
+
+func TestIncDec(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   string
+	}{
+		{"defined", "set x 5\ninc x\nget x", "6\n"},
+		{"undefined", "inc y\nget y", "1\n"},
+		{"mixed", "inc z\ninc z\ndec z\ninc z\ndec z\ndec z\ndec z\nget z", "-1\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkOutput(t, tt.script, tt.want, "")
+		})
+	}
+}
+
+func TestMod(t *testing.T) {
+	tests := []struct {
+		name     string
+		script   string
+		want     string
+		wantErrs string
+	}{
+		{"positive", "mod 7 3", "1\n", ""},
+		{"negative dividend", "mod -7 3", "-1\n", ""},
+		{"negative divisor", "mod 7 -3", "1\n", ""},
+		{"by zero", "mod 1 0", "", "line 1: error: division by zero\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkOutput(t, tt.script, tt.want, tt.wantErrs)
+		})
+	}
+}
+
+func TestPow(t *testing.T) {
+	tests := []struct {
+		name     string
+		script   string
+		want     string
+		wantErrs string
+	}{
+		{"2^10", "pow 2 10", "1024\n", ""},
+		{"5^0", "pow 5 0", "1\n", ""},
+		{"negative base", "pow -3 3", "-27\n", ""},
+		{"negative exponent", "pow 2 -1", "", "line 1: error: negative exponent -1\n"},
+		{"overflow", "pow 2 63", "", "line 1: " + IntegerOverflowError + "\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkOutput(t, tt.script, tt.want, tt.wantErrs)
+		})
+	}
+}
+
+func TestNeg(t *testing.T) {
+	tests := []struct {
+		name     string
+		script   string
+		want     string
+		wantErrs string
+	}{
+		{"positive", "neg 5", "-5\n", ""},
+		{"negative", "neg -5", "5\n", ""},
+		{"MinInt64", "neg -9223372036854775808", "", "line 1: " + IntegerOverflowError + "\n"},
+		{"MaxInt64", "neg 9223372036854775807", "-9223372036854775807\n", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkOutput(t, tt.script, tt.want, tt.wantErrs)
+		})
+	}
+}
+
+func TestQdepth(t *testing.T) {
+	// Counting what follows it in the program: two prints and the add.
+	checkOutput(t, "print a\nqdepth\nprint b\nprint c\nadd 1 2", "a\nb\nc\n3\n3\n", "")
+	checkOutput(t, "qdepth", "0\n", "")
+
+	// Posted before the loop starts, the commands are all queued at once.
+	var out, errs syncBuffer
+	l := newTestLoop(&out, &errs)
+	l.Post(&qdepthCommand{})
+	for range 5 {
+		l.Post(&printCommand{arg: "x"})
+	}
+	l.Start()
+	l.AwaitFinish()
+	if got, want := out.String(), "x\nx\nx\nx\nx\n5\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
+
+func TestMinMax(t *testing.T) {
+	for _, c := range []struct {
+		a, b     string
+		min, max string
+	}{
+		{"2", "7", "2", "7"},
+		{"7", "2", "2", "7"},
+		{"4", "4", "4", "4"},
+		{"-5", "x", "-5", "3"},
+		{"x", "-9223372036854775808", "-9223372036854775808", "3"},
+	} {
+		script := fmt.Sprintf("set x 3\nmin lo %s %s\nmax hi %s %s\nget lo\nget hi", c.a, c.b, c.a, c.b)
+		checkOutput(t, script, c.min+"\n"+c.max+"\n", "")
+	}
+	checkOutput(t, "min m a 1", "", "line 1: "+fmt.Sprintf(UndefinedVariableError, "a")+"\n")
+}
+
+func TestUnset(t *testing.T) {
+	undefined := "line 3: " + fmt.Sprintf(UndefinedVariableError, "a") + "\n"
+	checkOutput(t, "set a 1\nunset a\nget a", "", undefined)
+	checkOutput(t, "set a 1\nunset a\nadd a 1", "", undefined)
+	// Unsetting an undefined variable does nothing, and the name can be set again.
+	checkOutput(t, "unset nope\nset a 1\nunset a\nset a 2\nget a", "2\n", "")
+}
+
+func TestNop(t *testing.T) {
+	var out, errs syncBuffer
+	l := newTestLoop(&out, &errs)
+	l.Start()
+	postScript(t, l, "nop\nnop\nnop")
+	l.AwaitFinish()
+	if out.String() != "" || errs.String() != "" {
+		t.Errorf("nop printed %q and reported %q, want nothing", out.String(), errs.String())
+	}
+	stats := l.Stats()
+	if stats.Executed != 3 || stats.Commands["nop"].Executed != 3 {
+		t.Errorf("executed %d commands, %d of them nop, want 3 nops", stats.Executed, stats.Commands["nop"].Executed)
+	}
+	if _, err := Parse("nop 1"); err == nil {
+		t.Error("nop with an argument parsed")
+	}
+}
+
+func TestDumpvars(t *testing.T) {
+	checkOutput(t, "set zeta 3\nset alpha hello\nset mid 1.5\nset beta -2\ndumpvars",
+		"alpha=hello\nbeta=-2\nmid=1.5\nzeta=3\n", "")
+	checkOutput(t, "dumpvars", "", "")
+}
+
+func TestAbs(t *testing.T) {
+	checkOutput(t, "abs d 5\nget d", "5\n", "")
+	checkOutput(t, "abs d -5\nget d", "5\n", "")
+	checkOutput(t, "set x -9223372036854775807\nabs d x\nget d", "9223372036854775807\n", "")
+	checkOutput(t, "set d 1\nabs d -9223372036854775808\nget d", "1\n", "line 2: "+IntegerOverflowError+"\n")
+}
+
+func TestSum(t *testing.T) {
+	checkOutput(t, "sum d 1 2\nget d", "3\n", "")
+	checkOutput(t, "set x 10\nsum d x 1 2 3 -4\nget d", "12\n", "")
+	// The sum of no operands is zero.
+	checkOutput(t, "set d 5\nsum d\nget d", "0\n", "")
+
+	checkOutput(t, "sum d 9223372036854775807 1", "", "line 1: "+IntegerOverflowError+"\n")
+	checkOutput(t, "sum d 1 q", "", "line 1: "+fmt.Sprintf(UndefinedVariableError, "q")+"\n")
+}
+
+func TestAddVariadic(t *testing.T) {
+	checkOutput(t, "add 1 2", "3\n", "")
+	checkOutput(t, "add 1 2 3 4", "10\n", "")
+	checkOutput(t, "set x 5\nadd x -1 1 10\nget x", "15\n5\n", "")
+	checkOutput(t, "add 9223372036854775800 5 5", "", "line 1: "+IntegerOverflowError+"\n")
+
+	for _, line := range []string{"add", "add 1"} {
+		if _, err := Parse(line); err == nil || err.Error() != fmt.Sprintf(AmbiguousArgsNumberError, "add") {
+			t.Errorf("Parse(%q) = %v, want %q", line, err, fmt.Sprintf(AmbiguousArgsNumberError, "add"))
+		}
+	}
+}
+
+func TestStopif(t *testing.T) {
+	checkOutput(t, "set x 5\nprint before\nstopif x gt 3\nprint after", "before\n", "")
+	checkOutput(t, "set x 1\nstopif x gt 3\nprint after\nadd 1 2", "after\n3\n", "")
+	// A condition that can't be evaluated is reported, and the loop carries on.
+	checkOutput(t, "stopif q gt 3\nprint after", "after\n", "line 1: "+fmt.Sprintf(UndefinedVariableError, "q")+"\n")
+	checkOutput(t, "set s done\nstopif s eq 1\nprint after", "after\n",
+		"line 2: "+fmt.Sprintf(NotNumberValueError, "s", "done")+"\n")
+}
+
+func TestAssertempty(t *testing.T) {
+	notEmpty := func(line, n int) string {
+		return fmt.Sprintf("line %d: "+QueueNotEmptyError+"\n", line, n)
+	}
+	tests := []struct {
+		name     string
+		script   string
+		wantErrs string
+		wantCode int
+	}{
+		{"empty", "print a\nassertempty", "", 0},
+		{"commands behind it", "print a\nassertempty\nprint b\nprint c", notEmpty(2, 2), 1},
+		// The print of the sum is still queued when assertempty runs.
+		{"print of a result", "add 1 2\nassertempty", notEmpty(2, 1), 1},
+		{"settled by then", "add 1 2\nafter 20 assertempty", "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out, errs syncBuffer
+			l := newTestLoop(&out, &errs)
+			l.Start()
+			postScript(t, l, tt.script)
+			l.AwaitFinish()
+			if got := errs.String(); got != tt.wantErrs {
+				t.Errorf("errors = %q, want %q", got, tt.wantErrs)
+			}
+			if code := l.ExitCode(); code != tt.wantCode {
+				t.Errorf("ExitCode() = %d, want %d", code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestForeach(t *testing.T) {
+	checkOutput(t, "foreach i 1 3 print $i\nget i", "1\n2\n3\n3\n", "")
+	checkOutput(t, "foreach i 5 5 print $i", "5\n", "")
+	// A range counts down when start is above end.
+	checkOutput(t, "foreach i 3 1 print $i", "3\n2\n1\n", "")
+	checkOutput(t, "set s 0\nforeach i 1 4 add s i\nget s", "1\n2\n3\n4\n0\n", "")
+
+	for _, line := range []string{"foreach i 1 x print $i", "foreach i 1 3", "foreach i 1"} {
+		if _, err := Parse(line); err == nil {
+			t.Errorf("Parse(%q) succeeded, want a syntax error", line)
+		}
+	}
+}
+
+func TestAddto(t *testing.T) {
+	checkOutput(t, "set a 10\naddto a 5\naddto a -3\naddto a 1\nget a", "13\n", "")
+	// An undefined variable starts from zero.
+	checkOutput(t, "addto n 5\nget n", "5\n", "")
+	checkOutput(t, "set x 10\nforeach i 1 4 addto s x\nget s", "40\n", "")
+
+	checkOutput(t, "addto a q", "", "line 1: "+fmt.Sprintf(UndefinedVariableError, "q")+"\n")
+	checkOutput(t, "set f 1.5\naddto f 2\nget f", "1.5\n", "line 2: "+fmt.Sprintf(NotIntegerValueError, "f", 1.5)+"\n")
+	checkOutput(t, "set s hi\naddto s 1", "", "line 2: "+fmt.Sprintf(NotNumberValueError, "s", "hi")+"\n")
+}
+
+func TestReduce(t *testing.T) {
+	tests := []struct {
+		name, args string
+		want       string
+	}{
+		{"sum", "1 5 + 0", "15"},
+		{"product", "1 5 * 1", "120"},
+		{"min", "1 5 min 3", "1"},
+		{"max", "1 5 max 3", "5"},
+		{"sum from init", "-2 2 + 10", "10"},
+		{"single", "4 4 * 3", "12"},
+		{"empty range", "5 1 + 7", "7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkOutput(t, "reduce d "+tt.args+"\nget d", tt.want+"\n", "")
+		})
+	}
+
+	checkOutput(t, "reduce d 1 30 * 1\nget d", "", "line 1: "+IntegerOverflowError+"\n"+"line 2: "+fmt.Sprintf(UndefinedVariableError, "d")+"\n")
+	if _, err := Parse("reduce d 1 5 - 0"); err == nil || err.Error() != fmt.Sprintf(UnknownReduceOpError, "-", "+, *, min, max") {
+		t.Errorf("Parse of an unknown operator = %v, want %q", err, fmt.Sprintf(UnknownReduceOpError, "-", "+, *, min, max"))
+	}
+	// The range may hold as many integers as repeat may run.
+	if _, err := Parse(fmt.Sprintf("reduce d 1 %d + 0", MaxRepeat)); err != nil {
+		t.Errorf("Parse of a range of MaxRepeat: %v", err)
+	}
+	huge := fmt.Sprintf(InvalidReduceRangeError, 1, MaxRepeat+1, MaxRepeat)
+	if _, err := Parse(fmt.Sprintf("reduce d 1 %d + 0", MaxRepeat+1)); err == nil || err.Error() != huge {
+		t.Errorf("Parse of a range beyond MaxRepeat = %v, want %q", err, huge)
+	}
+}
+
+func TestRequire(t *testing.T) {
+	const vars = "set i 1\nset f 1.5\nset s hi\n"
+	tests := []struct {
+		name     string
+		script   string
+		opts     []Option
+		want     string
+		wantErrs string
+		wantCode int
+	}{
+		{"passing", vars + "require i:int f:float s:string\nprint after", nil, "after\n", "", 0},
+		{"missing", vars + "require i:int q:int\nprint after", nil, "after\n",
+			"line 4: " + fmt.Sprintf(RequirementMissingError, "q", "int") + "\n", 1},
+		{"mismatched", vars + "require s:int\nprint after", nil, "after\n",
+			"line 4: " + fmt.Sprintf(RequirementTypeError, "s", "int", "string", "hi") + "\n", 1},
+		// Every failed requirement is reported, not just the first.
+		{"several", vars + "require i:float q:string", nil, "",
+			"line 4: " + fmt.Sprintf(RequirementTypeError, "i", "float", "int", 1) + "\n" +
+				"line 4: " + fmt.Sprintf(RequirementMissingError, "q", "string") + "\n", 1},
+		{"failing fast", vars + "require q:int\nprint after", []Option{WithFailFast(true)}, "",
+			"line 4: " + fmt.Sprintf(RequirementMissingError, "q", "int") + "\n", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out, errs syncBuffer
+			l := newTestLoop(&out, &errs, tt.opts...)
+			l.Start()
+			postScript(t, l, tt.script)
+			l.AwaitFinish()
+			if got := out.String(); got != tt.want {
+				t.Errorf("output = %q, want %q", got, tt.want)
+			}
+			if got := errs.String(); got != tt.wantErrs {
+				t.Errorf("errors = %q, want %q", got, tt.wantErrs)
+			}
+			if code := l.ExitCode(); code != tt.wantCode {
+				t.Errorf("ExitCode() = %d, want %d", code, tt.wantCode)
+			}
+		})
+	}
+
+	for _, arg := range []string{"x", "x:bool", ":int"} {
+		if _, err := Parse("require " + arg); err == nil || err.Error() != fmt.Sprintf(InvalidRequirementError, arg) {
+			t.Errorf("Parse of requirement %q = %v, want %q", arg, err, fmt.Sprintf(InvalidRequirementError, arg))
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package eventloop
+
+import "fmt"
+
+const UnknownOperatorError string = "SYNTAX ERROR: unknown operator '%v'"
+
+// MARK: - Comparisons
+
+var comparators = map[string]func(a, b int64) bool{
+	"eq": func(a, b int64) bool { return a == b },
+	"ne": func(a, b int64) bool { return a != b },
+	"lt": func(a, b int64) bool { return a < b },
+	"le": func(a, b int64) bool { return a <= b },
+	"gt": func(a, b int64) bool { return a > b },
+	"ge": func(a, b int64) bool { return a >= b },
+}
+
+// condition compares a variable against an operand when it is evaluated.
+type condition struct {
+	name  string
+	op    string
+	value operand
+}
+
+func (c *condition) compare(a, b int64) bool {
+	return comparators[c.op](a, b)
+}
+
+// eval reports whether the condition holds. The second result is false if an
+// operand was undefined, in which case the error has already been reported.
+func (c *condition) eval(handler Handler) (bool, bool) {
+	arg1, arg2, ok := resolveOperands(handler, operand{name: c.name}, c.value)
+	if !ok {
+		return false, false
+	}
+	return c.compare(arg1, arg2), true
+}
+
+// parseCondition parses the "<var> <op> <value>" prefix shared by the
+// conditional commands.
+func parseCondition(command string, args []string) (*condition, error) {
+	if len(args) < 3 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, command)
+	}
+	if _, ok := comparators[args[1]]; !ok {
+		return nil, fmt.Errorf(UnknownOperatorError, args[1])
+	}
+	value, err := parseOperand(args[2])
+	if err != nil {
+		return nil, err
+	}
+	return &condition{name: args[0], op: args[1], value: value}, nil
+}
+
+// boolValue is the 1 or 0 stored for a true or false result.
+func boolValue(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// cmpCommand stores 1 in a variable if a comparison holds and 0 otherwise.
+type cmpCommand struct {
+	dest       string
+	arg1, arg2 operand
+	op         string
+}
+
+func (c *cmpCommand) attrs() []any {
+	return []any{"var", c.dest, "arg1", c.arg1, "op", c.op, "arg2", c.arg2}
+}
+
+func (c *cmpCommand) Execute(handler Handler) {
+	arg1, arg2, ok := resolveOperands(handler, c.arg1, c.arg2)
+	if !ok {
+		return
+	}
+	res := boolValue(comparators[c.op](arg1, arg2))
+	handler.Vars().Set(c.dest, IntValue(res))
+	returnResult(handler, res)
+}
+
+// parseCmp parses "<var> <a> <op> <b>".
+func parseCmp(args []string) (Command, error) {
+	if len(args) != 4 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "cmp")
+	}
+	if _, ok := comparators[args[2]]; !ok {
+		return nil, fmt.Errorf(UnknownOperatorError, args[2])
+	}
+	arg1, arg2, err := parseOperands("cmp", []string{args[1], args[3]})
+	if err != nil {
+		return nil, err
+	}
+	return &cmpCommand{dest: args[0], arg1: arg1, op: args[2], arg2: arg2}, nil
+}
+
+// MARK: - Logic
+
+// The logical commands take 0 as false and any other integer as true, and
+// store 1 for true and 0 for false, like cmp.
+
+var logicOps = map[string]func(a, b bool) bool{
+	"and": func(a, b bool) bool { return a && b },
+	"or":  func(a, b bool) bool { return a || b },
+}
+
+// logicCommand stores the and or the or of two operands in a variable.
+type logicCommand struct {
+	op         string
+	dest       string
+	arg1, arg2 operand
+}
+
+func (l *logicCommand) attrs() []any {
+	return []any{"var", l.dest, "arg1", l.arg1, "arg2", l.arg2}
+}
+
+func (l *logicCommand) Execute(handler Handler) {
+	arg1, arg2, ok := resolveOperands(handler, l.arg1, l.arg2)
+	if !ok {
+		return
+	}
+	res := boolValue(logicOps[l.op](arg1 != 0, arg2 != 0))
+	handler.Vars().Set(l.dest, IntValue(res))
+	returnResult(handler, res)
+}
+
+// notCommand stores 1 in a variable if its operand is 0, and 0 otherwise.
+type notCommand struct {
+	dest string
+	arg  operand
+}
+
+func (n *notCommand) attrs() []any {
+	return []any{"var", n.dest, "arg", n.arg}
+}
+
+func (n *notCommand) Execute(handler Handler) {
+	arg, ok := n.arg.resolve(handler)
+	if !ok {
+		return
+	}
+	res := boolValue(arg == 0)
+	handler.Vars().Set(n.dest, IntValue(res))
+	returnResult(handler, res)
+}
+
+func parseNot(args []string) (Command, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "not")
+	}
+	arg, err := parseOperand(args[1])
+	if err != nil {
+		return nil, err
+	}
+	return &notCommand{dest: args[0], arg: arg}, nil
+}
+
+// definedCommand stores 1 in a variable if the variable name is defined, and
+// 0 otherwise; an undefined name isn't an error.
+type definedCommand struct {
+	dest, name string
+}
+
+func (d *definedCommand) attrs() []any {
+	return []any{"var", d.dest, "name", d.name}
+}
+
+func (d *definedCommand) Execute(handler Handler) {
+	_, ok := handler.Vars().Get(d.name)
+	res := boolValue(ok)
+	handler.Vars().Set(d.dest, IntValue(res))
+	returnResult(handler, res)
+}
+
+func parseDefined(args []string) (Command, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "defined")
+	}
+	return &definedCommand{dest: args[0], name: args[1]}, nil
+}
+
+// selectCommand stores a in a variable if its condition is nonzero, and b
+// otherwise. All three operands are resolved, whichever is chosen.
+type selectCommand struct {
+	dest       string
+	cond, a, b operand
+}
+
+func (s *selectCommand) attrs() []any {
+	return []any{"var", s.dest, "cond", s.cond, "a", s.a, "b", s.b}
+}
+
+func (s *selectCommand) Execute(handler Handler) {
+	cond, ok := s.cond.resolve(handler)
+	if !ok {
+		return
+	}
+	a, b, ok := resolveOperands(handler, s.a, s.b)
+	if !ok {
+		return
+	}
+	res := b
+	if cond != 0 {
+		res = a
+	}
+	handler.Vars().Set(s.dest, IntValue(res))
+	returnResult(handler, res)
+}
+
+func parseSelect(args []string) (Command, error) {
+	if len(args) != 4 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "select")
+	}
+	ops, err := parseOperandList(args[1:])
+	if err != nil {
+		return nil, err
+	}
+	return &selectCommand{dest: args[0], cond: ops[0], a: ops[1], b: ops[2]}, nil
+}
@@ -0,0 +1,82 @@
+package eventloop
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestCmp(t *testing.T) {
+	tests := []struct {
+		a, op, b string
+		want     string
+	}{
+		{"3", "eq", "3", "1"}, {"3", "eq", "4", "0"},
+		{"3", "ne", "4", "1"}, {"3", "ne", "3", "0"},
+		{"3", "lt", "4", "1"}, {"4", "lt", "4", "0"},
+		{"4", "le", "4", "1"}, {"5", "le", "4", "0"},
+		{"5", "gt", "4", "1"}, {"4", "gt", "4", "0"},
+		{"4", "ge", "4", "1"}, {"3", "ge", "4", "0"},
+		// Variables on either side, or both.
+		{"x", "lt", "5", "1"}, {"5", "le", "x", "0"}, {"x", "eq", "y", "0"}, {"y", "gt", "x", "1"},
+	}
+	for _, tt := range tests {
+		script := fmt.Sprintf("set x 3\nset y 7\ncmp d %s %s %s\nget d", tt.a, tt.op, tt.b)
+		checkOutput(t, script, tt.want+"\n", "")
+	}
+
+	checkOutput(t, "cmp d q lt 1", "", "line 1: "+fmt.Sprintf(UndefinedVariableError, "q")+"\n")
+	if _, err := Parse("cmp d 1 zz 2"); err == nil || err.Error() != fmt.Sprintf(UnknownOperatorError, "zz") {
+		t.Errorf("Parse of an unknown operator = %v, want %q", err, fmt.Sprintf(UnknownOperatorError, "zz"))
+	}
+}
+
+func TestLogic(t *testing.T) {
+	// Any nonzero integer is true.
+	for _, a := range []string{"0", "1", "-3"} {
+		for _, b := range []string{"0", "1", "7"} {
+			ta, tb := a != "0", b != "0"
+			want := fmt.Sprintf("%d\n%d\n", boolValue(ta && tb), boolValue(ta || tb))
+			checkOutput(t, fmt.Sprintf("and d %s %s\nget d\nor d %s %s\nget d", a, b, a, b), want, "")
+		}
+	}
+	for _, c := range []struct{ a, want string }{{"0", "1"}, {"1", "0"}, {"-3", "0"}} {
+		checkOutput(t, "not d "+c.a+"\nget d", c.want+"\n", "")
+	}
+	// Results read back as truth values.
+	checkOutput(t, "set x 5\ncmp c x gt 3\nnot n c\nor d n c\nget d", "1\n", "")
+
+	checkOutput(t, "and d q 1", "", "line 1: "+fmt.Sprintf(UndefinedVariableError, "q")+"\n")
+}
+
+func TestSelect(t *testing.T) {
+	tests := []struct {
+		name, cond, a, b string
+		want             string
+	}{
+		{"true branch", "1", "5", "6", "5"},
+		{"negative is true", "-2", "5", "6", "5"},
+		{"false branch", "0", "5", "6", "6"},
+		{"variable operands", "c", "x", "y", "10"},
+		{"false variable", "z", "x", "y", "20"},
+		{"mixed operands", "c", "x", "7", "10"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script := fmt.Sprintf("set c 1\nset z 0\nset x 10\nset y 20\nselect d %s %s %s\nget d", tt.cond, tt.a, tt.b)
+			checkOutput(t, script, tt.want+"\n", "")
+		})
+	}
+
+	// Both operands are resolved, whichever is chosen.
+	checkOutput(t, "select d 1 5 q", "", "line 1: "+fmt.Sprintf(UndefinedVariableError, "q")+"\n")
+	checkOutput(t, "set s hi\nselect d s 1 2", "", "line 2: "+fmt.Sprintf(NotNumberValueError, "s", "hi")+"\n")
+}
+
+func TestDefined(t *testing.T) {
+	checkOutput(t, "set x 1\ndefined d x\nget d", "1\n", "")
+	checkOutput(t, "set s \"\"\ndefined d s\nget d", "1\n", "")
+	// An undefined name is no error, just false.
+	checkOutput(t, "defined d nope\nget d", "0\n", "")
+	checkOutput(t, "set x 1\nunset x\ndefined d x\nget d", "0\n", "")
+	checkOutput(t, "set x 1\ndefined c x\ndefined n nope\nand d c n\nget d", "0\n", "")
+}
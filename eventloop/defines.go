@@ -0,0 +1,48 @@
+package eventloop
+
+import (
+	"fmt"
+	"maps"
+)
+
+// MARK: - Defines
+
+// WithDefines gives the loop the defines whendef tests, such as those passed
+// on the command line, by name. The map is copied.
+func WithDefines(defines map[string]string) Option {
+	return func(l *EventLoop) {
+		l.defines = maps.Clone(defines)
+	}
+}
+
+// whendefCommand executes cmd in place if the loop was given a define named
+// name, whatever its value, and does nothing otherwise.
+type whendefCommand struct {
+	name string
+	cmd  Command
+}
+
+func (w *whendefCommand) attrs() []any {
+	return []any{"define", w.name}
+}
+
+func (w *whendefCommand) Execute(handler Handler) {
+	h, ok := findHandler[workerHandler](handler)
+	if !ok {
+		return
+	}
+	if _, defined := h.defines[w.name]; defined {
+		w.cmd.Execute(handler)
+	}
+}
+
+func (r *Registry) parseWhendef(args []string) (Command, error) {
+	if len(args) < 2 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "whendef")
+	}
+	cmd, err := r.parseFields(args[1:])
+	if err != nil {
+		return nil, err
+	}
+	return &whendefCommand{name: args[0], cmd: cmd}, nil
+}
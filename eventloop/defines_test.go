@@ -0,0 +1,22 @@
+package eventloop
+
+import "testing"
+
+func TestWhendef(t *testing.T) {
+	script := "whendef debug print debugging\nwhendef level add 1 2\nprint end"
+	defines := map[string]string{"debug": "", "level": "3"}
+
+	checkOutput(t, script, "debugging\nend\n3\n", "", WithDefines(defines))
+	// Without the defines the commands are skipped, without an error.
+	checkOutput(t, script, "end\n", "")
+	checkOutput(t, script, "end\n3\n", "", WithDefines(map[string]string{"level": "0"}))
+}
+
+func TestWithDefinesCopies(t *testing.T) {
+	defines := map[string]string{"debug": ""}
+	l := NewEventLoop(WithDefines(defines))
+	delete(defines, "debug")
+	if _, ok := l.defines["debug"]; !ok {
+		t.Error("changing the map given to WithDefines changed the loop's defines")
+	}
+}
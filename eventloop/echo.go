@@ -0,0 +1,52 @@
+package eventloop
+
+import (
+	"fmt"
+	"io"
+)
+
+// MARK: - Echo
+
+// WithEcho writes every instruction read from a line of a file to w right
+// before it executes, prefixed by the line number, as in "3: add x 2", the
+// way a shell traces commands with set -x. Commands posted one by one, and
+// those the loop posts itself like the prints of results, aren't echoed.
+func WithEcho(w io.Writer) Option {
+	return func(l *EventLoop) {
+		l.echo = w
+	}
+}
+
+// sourceLine returns the instruction cmd executes and its line, or 0 if it
+// wasn't read from a line of a program.
+func sourceLine(cmd Command) (Command, int) {
+	switch c := cmd.(type) {
+	case *fileCommand:
+		if c.line > 0 {
+			return c.cmd, c.line
+		}
+		return sourceLine(c.cmd)
+	case *resultCommand:
+		return sourceLine(c.cmd)
+	case *postedCommand:
+		return sourceLine(c.cmd)
+	case *programCommand:
+		if c.ip < len(c.prog.cmds) {
+			return c.prog.cmds[c.ip], c.prog.line(c.ip)
+		}
+	}
+	return cmd, 0
+}
+
+// writeEcho echoes cmd, if it has a line, in a single write.
+func (l *EventLoop) writeEcho(cmd Command) {
+	cmd, line := sourceLine(cmd)
+	if line == 0 {
+		return
+	}
+	text := textOf(cmd)
+	if text == "" {
+		text = commandName(cmd)
+	}
+	io.WriteString(l.echo, fmt.Sprintf("%d: %s\n", line, text))
+}
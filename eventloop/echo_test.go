@@ -0,0 +1,15 @@
+package eventloop
+
+import "testing"
+
+func TestEcho(t *testing.T) {
+	var echo syncBuffer
+	out, _ := runScript(t, "print a\nadd 1 2\n\nprint \"b c\"", WithEcho(&echo))
+	if want := "a\nb c\n3\n"; out != want {
+		t.Errorf("output = %q, want %q", out, want)
+	}
+	// The print of the sum was posted by add, not read from a line.
+	if got, want := echo.String(), "1: print a\n2: add 1 2\n4: print \"b c\"\n"; got != want {
+		t.Errorf("echoed %q, want %q", got, want)
+	}
+}
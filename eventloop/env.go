@@ -0,0 +1,49 @@
+package eventloop
+
+import (
+	"fmt"
+	"strconv"
+)
+
+const UnsetEnvError string = "error: environment variable %v is not set"
+const EnvNotNumberError string = "error: environment variable %v is not a number: %q"
+
+// MARK: - Environment
+
+// getenvCommand stores the integer value of an environment variable, looked
+// up with the loop's WithEnv function, in a variable. An unset variable or
+// one that doesn't hold an integer is reported, and the store is left as is.
+type getenvCommand struct {
+	name string
+	env  string
+}
+
+func (g *getenvCommand) attrs() []any {
+	return []any{"var", g.name, "env", g.env}
+}
+
+func (g *getenvCommand) Execute(handler Handler) {
+	h, ok := findHandler[workerHandler](handler)
+	if !ok {
+		return
+	}
+	s, ok := h.lookupEnv(g.env)
+	if !ok {
+		handler.Post(&errorCommand{msg: fmt.Sprintf(UnsetEnvError, g.env)})
+		return
+	}
+	val, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		handler.Post(&errorCommand{msg: fmt.Sprintf(EnvNotNumberError, g.env, s)})
+		return
+	}
+	handler.Vars().Set(g.name, IntValue(val))
+	returnResult(handler, val)
+}
+
+func parseGetenv(args []string) (Command, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "getenv")
+	}
+	return &getenvCommand{name: args[0], env: args[1]}, nil
+}
@@ -0,0 +1,27 @@
+package eventloop
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestGetenv(t *testing.T) {
+	env := map[string]string{"ANSWER": "42", "NAME": "bob"}
+	lookup := func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	}
+
+	var out, errs syncBuffer
+	l := newTestLoop(&out, &errs, WithEnv(lookup))
+	l.Start()
+	postScript(t, l, "getenv x ANSWER\ngetenv y NAME")
+	l.AwaitFinish()
+
+	if v, ok := l.Vars().Get("x"); !ok || v != IntValue(42) {
+		t.Errorf("x = %v, %v, want 42 from the injected lookup", v, ok)
+	}
+	if got, want := errs.String(), "line 2: "+fmt.Sprintf(EnvNotNumberError, "NAME", "bob")+"\n"; got != want {
+		t.Errorf("errors = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,80 @@
+package eventloop
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// MARK: - Errors
+
+// Severity tells how bad an error reported by the loop is.
+type Severity int
+
+const (
+	// SeverityError is a failed command; the loop carries on.
+	SeverityError Severity = iota
+	// SeverityFatal is a failure the loop stops on, such as an assert on a
+	// fail-fast loop or reaching the command limit.
+	SeverityFatal
+)
+
+func (s Severity) String() string {
+	if s == SeverityFatal {
+		return "fatal"
+	}
+	return "error"
+}
+
+// WithErrorOutput routes the errors the loop reports, like a division by zero
+// or an undefined variable, to w instead of os.Stderr, keeping them apart from
+// the output of print commands.
+func WithErrorOutput(w io.Writer) Option {
+	return func(l *EventLoop) {
+		l.errors = w
+	}
+}
+
+// ErrorCount returns the number of errors the loop has reported.
+func (l *EventLoop) ErrorCount() int64 {
+	return l.errorCount.Load()
+}
+
+// report writes msg to the error output and counts it. The output of print
+// commands is flushed first, so that on a terminal the error shows up after
+// the lines printed before it.
+func (l *EventLoop) report(msg string) {
+	l.errorCount.Add(1)
+	l.flush()
+	if l.color {
+		msg = ColorError(msg)
+	}
+	io.WriteString(l.errors, msg)
+}
+
+// errorCommand reports an error posted by a failed command. It is posted,
+// like the results commands print, so that errors are reported in the order
+// the commands failed. The error instruction reports message as an error too.
+// line is that of the instruction that failed, if known, which the report
+// starts with.
+type errorCommand struct {
+	msg      string
+	severity Severity
+	line     int
+}
+
+func (e *errorCommand) attrs() []any {
+	return []any{"msg", e.msg, "severity", e.severity}
+}
+
+func (e *errorCommand) Execute(handler Handler) {
+	msg := e.msg
+	if e.line > 0 {
+		msg = fmt.Sprintf("line %d: %s", e.line, msg)
+	}
+	if h, ok := findHandler[workerHandler](handler); ok {
+		h.report(msg + "\n")
+		return
+	}
+	fmt.Fprintln(os.Stderr, msg)
+}
@@ -0,0 +1,63 @@
+package eventloop
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestErrorsReportedApart(t *testing.T) {
+	var out, errs syncBuffer
+	l := newTestLoop(&out, &errs)
+	l.Start()
+	postScript(t, l, "print a\ndiv 1 0\nget zz\nadd 9223372036854775807 1\nerror something bad\nprint b")
+	l.AwaitFinish()
+
+	if got, want := out.String(), "a\nb\n"; got != want {
+		t.Errorf("output = %q, want only the prints", got)
+	}
+	// The error instruction reports its text as it executes, before the
+	// errors the other commands posted.
+	want := "something bad\n" +
+		"line 2: " + DivisionByZeroError + "\n" +
+		"line 3: " + fmt.Sprintf(UndefinedVariableError, "zz") + "\n" +
+		"line 4: " + IntegerOverflowError + "\n"
+	if got := errs.String(); got != want {
+		t.Errorf("errors = %q, want %q", got, want)
+	}
+	if n := l.ErrorCount(); n != 4 {
+		t.Errorf("ErrorCount() = %d, want 4", n)
+	}
+}
+
+func TestSeverity(t *testing.T) {
+	if s := SeverityError.String(); s != "error" {
+		t.Errorf("SeverityError = %q, want %q", s, "error")
+	}
+	if s := SeverityFatal.String(); s != "fatal" {
+		t.Errorf("SeverityFatal = %q, want %q", s, "fatal")
+	}
+}
+
+func TestErrorLineNumbers(t *testing.T) {
+	divError := func(line int) string {
+		return fmt.Sprintf("line %d: %s\n", line, DivisionByZeroError)
+	}
+	checkOutput(t, "print a\nprint b\ndiv 1 0", "a\nb\n", divError(3))
+	// Blank lines and comments count, though they yield no command.
+	checkOutput(t, "print a\n\n# comment\ndiv 1 0", "a\n", divError(4))
+	// A command executed by another reports the line of the outer one.
+	checkOutput(t, "set x 1\nif x eq 1 div 1 0\nrepeat 2 div 1 0", "", divError(2)+divError(3)+divError(3))
+	checkOutput(t, "def m\ndiv 1 0\nenddef\ncall m", "", divError(4))
+}
+
+func TestErrorWithoutLine(t *testing.T) {
+	var out, errs syncBuffer
+	l := newTestLoop(&out, &errs)
+	l.Start()
+	l.Post(mustParse(t, "div 1 0"))
+	l.AwaitFinish()
+	// A command posted on its own has no line to report.
+	if got, want := errs.String(), DivisionByZeroError+"\n"; got != want {
+		t.Errorf("errors = %q, want %q", got, want)
+	}
+}
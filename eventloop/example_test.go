@@ -0,0 +1,23 @@
+package eventloop_test
+
+import (
+	"os"
+
+	"github.com/Beaxhem/architecture-lab-4/eventloop"
+)
+
+func Example() {
+	loop := eventloop.NewEventLoop(eventloop.WithOutput(os.Stdout))
+	loop.Start()
+	for _, line := range []string{"print hello", "add 1 2"} {
+		cmd, err := eventloop.Parse(line)
+		if err != nil {
+			panic(err)
+		}
+		loop.Post(cmd)
+	}
+	loop.AwaitFinish()
+	// Output:
+	// hello
+	// 3
+}
@@ -0,0 +1,85 @@
+package eventloop
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+const ExecDisabledError string = "error: %v %v: running programs is not allowed"
+const ExecError string = "error: %v %v: %v"
+
+// MARK: - External programs
+
+// execCommand runs a program and prints its output or, with a name, stores
+// it in that variable, without the trailing newline. The program's stderr is
+// passed through to os.Stderr. Running programs has to be enabled with
+// WithExec; it is cut short when the loop's context is done or the timeout
+// set there expires.
+type execCommand struct {
+	name string
+	prog string
+	args []string
+}
+
+func (e *execCommand) attrs() []any {
+	return []any{"var", e.name, "program", e.prog, "args", e.args}
+}
+
+// command returns the name of the instruction, which is capture with a
+// variable to store the output in and exec without.
+func (e *execCommand) command() string {
+	if e.name != "" {
+		return "capture"
+	}
+	return "exec"
+}
+
+func (e *execCommand) Execute(handler Handler) {
+	h, ok := findHandler[workerHandler](handler)
+	if !ok || !h.allowExec {
+		handler.Post(&errorCommand{msg: fmt.Sprintf(ExecDisabledError, e.command(), e.prog)})
+		return
+	}
+	ctx := h.ctx
+	if h.execTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.execTimeout)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, e.prog, e.args...)
+	cmd.Stderr = os.Stderr
+	h.flush()
+	out, err := cmd.Output()
+	if ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("timed out after %v", h.execTimeout)
+	}
+	if err != nil {
+		handler.Post(&errorCommand{msg: fmt.Sprintf(ExecError, e.command(), e.prog, err)})
+		return
+	}
+	res := strings.TrimSuffix(string(out), "\n")
+	if e.name != "" {
+		handler.Vars().Set(e.name, StringValue(res))
+		returnResult(handler, res)
+		return
+	}
+	returnResult(handler, res)
+	handler.Post(&printCommand{arg: res})
+}
+
+func parseExec(args []string) (Command, error) {
+	if len(args) < 1 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "exec")
+	}
+	return &execCommand{prog: args[0], args: args[1:]}, nil
+}
+
+func parseCapture(args []string) (Command, error) {
+	if len(args) < 2 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "capture")
+	}
+	return &execCommand{name: args[0], prog: args[1], args: args[2:]}, nil
+}
@@ -0,0 +1,37 @@
+package eventloop
+
+import (
+	"fmt"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestExec(t *testing.T) {
+	if _, err := exec.LookPath("echo"); err != nil {
+		t.Skip("no echo program:", err)
+	}
+
+	checkOutput(t, "exec echo hello world", "hello world\n", "", WithExec(0))
+	checkOutput(t, "capture greeting echo hi\nprint $greeting!", "hi!\n", "", WithExec(0))
+}
+
+func TestExecTimeout(t *testing.T) {
+	if _, err := exec.LookPath("sleep"); err != nil {
+		t.Skip("no sleep program:", err)
+	}
+
+	start := time.Now()
+	checkOutput(t, "exec sleep 5", "",
+		fmt.Sprintf("line 1: "+ExecError+"\n", "exec", "sleep", "timed out after 50ms"), WithExec(50*time.Millisecond))
+	checkOutput(t, "capture out sleep 5", "",
+		fmt.Sprintf("line 1: "+ExecError+"\n", "capture", "sleep", "timed out after 50ms"), WithExec(50*time.Millisecond))
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("exec ran for %v, want it killed after the timeout", elapsed)
+	}
+}
+
+func TestExecDisabledByDefault(t *testing.T) {
+	checkOutput(t, "exec echo hello", "", fmt.Sprintf("line 1: "+ExecDisabledError+"\n", "exec", "echo"))
+	checkOutput(t, "capture greeting echo hi", "", fmt.Sprintf("line 1: "+ExecDisabledError+"\n", "capture", "echo"))
+}
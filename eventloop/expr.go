@@ -0,0 +1,240 @@
+package eventloop
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+const InvalidExpressionError string = "SYNTAX ERROR: invalid expression '%v': %v"
+
+// MARK: - Expressions
+
+// expr is a node of a parsed arithmetic expression. eval reports false if
+// the expression can't be computed, in which case the error has already been
+// reported.
+type expr interface {
+	eval(handler Handler) (int64, bool)
+}
+
+// operand is a leaf of an expression.
+func (o operand) eval(handler Handler) (int64, bool) {
+	return o.resolve(handler)
+}
+
+type negExpr struct {
+	x expr
+}
+
+func (n *negExpr) eval(handler Handler) (int64, bool) {
+	x, ok := n.x.eval(handler)
+	if !ok {
+		return 0, false
+	}
+	res, ok := checkedSub(0, x)
+	if !ok {
+		handler.Post(&errorCommand{msg: IntegerOverflowError})
+	}
+	return res, ok
+}
+
+type binaryExpr struct {
+	op   byte
+	x, y expr
+}
+
+func (b *binaryExpr) eval(handler Handler) (int64, bool) {
+	x, ok := b.x.eval(handler)
+	if !ok {
+		return 0, false
+	}
+	y, ok := b.y.eval(handler)
+	if !ok {
+		return 0, false
+	}
+	var res int64
+	switch b.op {
+	case '+':
+		res, ok = checkedAdd(x, y)
+	case '-':
+		res, ok = checkedSub(x, y)
+	case '*':
+		res, ok = checkedMul(x, y)
+	case '/', '%':
+		if y == 0 {
+			handler.Post(&errorCommand{msg: DivisionByZeroError})
+			return 0, false
+		}
+		if b.op == '%' {
+			return x % y, true
+		}
+		res, ok = checkedDiv(x, y)
+	}
+	if !ok {
+		handler.Post(&errorCommand{msg: IntegerOverflowError})
+	}
+	return res, ok
+}
+
+// exprParser is a recursive-descent parser for the grammar
+//
+//	expr    = term { ("+" | "-") term }
+//	term    = unary { ("*" | "/" | "%") unary }
+//	unary   = "-" unary | primary
+//	primary = integer | variable | "(" expr ")"
+//
+// Operators of the same precedence associate to the left, and the integer
+// operators behave like the arithmetic commands.
+type exprParser struct {
+	tokens []string
+	pos    int
+}
+
+func parseExpr(s string) (expr, error) {
+	tokens, err := tokenizeExpr(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{tokens: tokens}
+	e, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected '%v'", p.tokens[p.pos])
+	}
+	return e, nil
+}
+
+// tokenizeExpr splits s into numbers, names, operators and parentheses.
+func tokenizeExpr(s string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case strings.ContainsRune("+-*/%()", c):
+			tokens = append(tokens, s[i:i+1])
+			i++
+		case c == '_' || unicode.IsLetter(c) || unicode.IsDigit(c):
+			end := i + 1
+			for end < len(s) && (s[end] == '_' || unicode.IsLetter(rune(s[end])) || unicode.IsDigit(rune(s[end]))) {
+				end++
+			}
+			tokens = append(tokens, s[i:end])
+			i = end
+		default:
+			return nil, fmt.Errorf("unexpected '%c'", c)
+		}
+	}
+	return tokens, nil
+}
+
+func (p *exprParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *exprParser) expr() (expr, error) {
+	return p.binary(p.term, "+", "-")
+}
+
+func (p *exprParser) term() (expr, error) {
+	return p.binary(p.unary, "*", "/", "%")
+}
+
+// binary parses a left-associative chain of operands joined by ops.
+func (p *exprParser) binary(operand func() (expr, error), ops ...string) (expr, error) {
+	x, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		if !slices.Contains(ops, op) {
+			return x, nil
+		}
+		p.pos++
+		y, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		x = &binaryExpr{op: op[0], x: x, y: y}
+	}
+}
+
+func (p *exprParser) unary() (expr, error) {
+	if p.peek() == "-" {
+		p.pos++
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &negExpr{x: x}, nil
+	}
+	return p.primary()
+}
+
+func (p *exprParser) primary() (expr, error) {
+	tok := p.peek()
+	switch tok {
+	case "":
+		return nil, fmt.Errorf("unexpected end")
+	case "(":
+		p.pos++
+		x, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("missing ')'")
+		}
+		p.pos++
+		return x, nil
+	}
+	p.pos++
+	if isIdentifier(tok) {
+		return operand{name: tok}, nil
+	}
+	val, err := parseInt(tok)
+	if err != nil {
+		return nil, fmt.Errorf("unexpected '%v'", tok)
+	}
+	return operand{val: val}, nil
+}
+
+// evalCommand evaluates an expression and stores the result in a variable.
+type evalCommand struct {
+	name string
+	src  string
+	expr expr
+}
+
+func (e *evalCommand) attrs() []any {
+	return []any{"var", e.name, "expr", e.src}
+}
+
+func (e *evalCommand) Execute(handler Handler) {
+	val, ok := e.expr.eval(handler)
+	if !ok {
+		return
+	}
+	handler.Vars().Set(e.name, IntValue(val))
+	returnResult(handler, val)
+}
+
+func parseEval(args []string) (Command, error) {
+	if len(args) < 2 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "eval")
+	}
+	src := strings.Join(args[1:], " ")
+	e, err := parseExpr(src)
+	if err != nil {
+		return nil, fmt.Errorf(InvalidExpressionError, src, err)
+	}
+	return &evalCommand{name: args[0], src: src, expr: e}, nil
+}
@@ -0,0 +1,36 @@
+package eventloop
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestEval(t *testing.T) {
+	for _, c := range []struct {
+		expr string
+		want string
+	}{
+		{"2 + 3 * 4", "14"},
+		{"10 - 4 - 3", "3"},
+		{"7 / 2 * 2", "6"},
+		{"(2 + 3) * 4", "20"},
+		{"((1 + 2) * (3 + 4))", "21"},
+		{"-(2 + 3) * -2", "10"},
+		{"(x + 2) * 3", "18"},
+		{"x * x - y", "15"},
+	} {
+		checkOutput(t, "set x 4\nset y 1\neval r "+c.expr+"\nget r", c.want+"\n", "")
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	checkOutput(t, "eval r 1 / (2 - 2)", "", "line 1: "+DivisionByZeroError+"\n")
+	checkOutput(t, "eval r z + 1", "", "line 1: "+fmt.Sprintf(UndefinedVariableError, "z")+"\n")
+	checkOutput(t, "eval r 9223372036854775807 + 1", "", "line 1: "+IntegerOverflowError+"\n")
+
+	for _, line := range []string{"eval r (1 + 2", "eval r 2 +", "eval r 1 2", "eval r"} {
+		if _, err := NewLineParser().Parse(line); err == nil {
+			t.Errorf("Parse(%q) succeeded, want a syntax error", line)
+		}
+	}
+}
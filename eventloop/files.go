@@ -0,0 +1,134 @@
+package eventloop
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const FileError string = "error: %v %v: %v"
+
+// errOutsideRoot rejects paths escaping the loop's file root.
+var errOutsideRoot = errors.New("path is outside of the file root")
+
+// MARK: - Files
+
+// resolvePath maps path, relative to root unless absolute, to a path relative
+// to root. It only checks the path lexically; opening it in an os.Root also
+// keeps symbolic links from leading out of root.
+func resolvePath(root, path string) (string, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(root, path)
+	}
+	rel, err := filepath.Rel(root, filepath.Clean(path))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", errOutsideRoot
+	}
+	return rel, nil
+}
+
+// openFile opens path in the loop's file root, with the flags of os.OpenFile.
+func openFile(handler Handler, path string, flag int) (*os.File, error) {
+	dir := fileRoot(handler)
+	path, err := resolvePath(dir, path)
+	if err != nil {
+		return nil, err
+	}
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer root.Close()
+	return root.OpenFile(path, flag, 0o644)
+}
+
+// readfileCommand stores the contents of a file in a variable as a string.
+// Paths are confined to the root set with WithFileRoot.
+type readfileCommand struct {
+	name string
+	path string
+}
+
+func (r *readfileCommand) attrs() []any {
+	return []any{"var", r.name, "path", r.path}
+}
+
+func (r *readfileCommand) Execute(handler Handler) {
+	data, err := readFile(handler, r.path)
+	if err != nil {
+		handler.Post(&errorCommand{msg: fmt.Sprintf(FileError, "readfile", r.path, err)})
+		return
+	}
+	handler.Vars().Set(r.name, StringValue(string(data)))
+	returnResult(handler, string(data))
+}
+
+// writefileCommand writes the text of a variable to a file, replacing its
+// contents. Paths are confined to the root set with WithFileRoot.
+type writefileCommand struct {
+	path string
+	name string
+}
+
+func (w *writefileCommand) attrs() []any {
+	return []any{"path", w.path, "var", w.name}
+}
+
+func (w *writefileCommand) Execute(handler Handler) {
+	val, ok := lookupVar(handler, w.name)
+	if !ok {
+		return
+	}
+	if err := writeFile(handler, w.path, []byte(val.String())); err != nil {
+		handler.Post(&errorCommand{msg: fmt.Sprintf(FileError, "writefile", w.path, err)})
+	}
+}
+
+func fileRoot(handler Handler) string {
+	if h, ok := findHandler[workerHandler](handler); ok {
+		return h.fileRoot
+	}
+	return "."
+}
+
+func readFile(handler Handler, path string) ([]byte, error) {
+	f, err := openFile(handler, path, os.O_RDONLY)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+func writeFile(handler Handler, path string, data []byte) error {
+	f, err := openFile(handler, path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func parseReadfile(args []string) (Command, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "readfile")
+	}
+	return &readfileCommand{name: args[0], path: args[1]}, nil
+}
+
+func parseWritefile(args []string) (Command, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "writefile")
+	}
+	return &writefileCommand{path: args[0], name: args[1]}, nil
+}
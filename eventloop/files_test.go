@@ -0,0 +1,51 @@
+package eventloop
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadWriteFile(t *testing.T) {
+	dir := t.TempDir()
+
+	checkOutput(t, "set text hello\nwritefile out.txt text\nreadfile copy out.txt\nprint $copy", "hello\n", "",
+		WithFileRoot(dir))
+	data, err := os.ReadFile(filepath.Join(dir, "out.txt"))
+	if err != nil || string(data) != "hello" {
+		t.Errorf("out.txt holds %q (%v), want %q", data, err, "hello")
+	}
+}
+
+func TestReadMissingFile(t *testing.T) {
+	out, errs := runScript(t, "readfile text missing.txt\nprint after", WithFileRoot(t.TempDir()))
+	if out != "after\n" {
+		t.Errorf("output = %q, want the script to go on", out)
+	}
+	if !strings.Contains(errs, "error: readfile missing.txt") || !strings.Contains(errs, "no such file") {
+		t.Errorf("errors = %q, want the missing file reported", errs)
+	}
+}
+
+func TestFilePathsConfinedToRoot(t *testing.T) {
+	parent := t.TempDir()
+	root := filepath.Join(parent, "root")
+	if err := os.Mkdir(root, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	secret := writeScript(t, parent, "secret.txt", "secret")
+	if err := os.Symlink(secret, filepath.Join(root, "link.txt")); err != nil {
+		t.Skip("no symbolic links:", err)
+	}
+
+	for _, path := range []string{"../secret.txt", secret, "link.txt"} {
+		out, errs := runScript(t, "readfile text "+path+"\nprint $text", WithFileRoot(root))
+		if strings.Contains(out, "secret") {
+			t.Errorf("readfile %s read %q from outside the root", path, out)
+		}
+		if !strings.Contains(errs, "error: readfile "+path) {
+			t.Errorf("errors of readfile %s = %q, want it refused", path, errs)
+		}
+	}
+}
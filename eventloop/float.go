@@ -0,0 +1,153 @@
+package eventloop
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// MARK: - Floating-point arithmetic
+
+// DefaultFloatPrecision prints float results with the fewest digits that
+// parse back to the same value.
+const DefaultFloatPrecision = -1
+
+// floatOperand is a float literal or the name of an integer variable, which
+// is converted when the owning command executes.
+type floatOperand struct {
+	val  float64
+	name string
+}
+
+func (o floatOperand) String() string {
+	if o.name != "" {
+		return o.name
+	}
+	return strconv.FormatFloat(o.val, 'g', -1, 64)
+}
+
+func (o floatOperand) resolve(handler Handler) (float64, bool) {
+	if o.name == "" {
+		return o.val, true
+	}
+	val, ok := lookupVar(handler, o.name)
+	if !ok {
+		return 0, false
+	}
+	f, err := val.toFloat(o.name)
+	if err != nil {
+		handler.Post(&errorCommand{msg: err.Error()})
+	}
+	return f, err == nil
+}
+
+// runFloat applies op to the resolved operands and prints the result with the
+// loop's float precision.
+func runFloat(handler Handler, o1, o2 floatOperand, op func(a, b float64) float64) {
+	arg1, ok := o1.resolve(handler)
+	if !ok {
+		return
+	}
+	arg2, ok := o2.resolve(handler)
+	if !ok {
+		return
+	}
+	res := op(arg1, arg2)
+	returnResult(handler, res)
+	handler.Post(&printCommand{arg: formatFloat(handler, res)})
+}
+
+func formatFloat(handler Handler, val float64) string {
+	prec := DefaultFloatPrecision
+	if h, ok := findHandler[workerHandler](handler); ok {
+		prec = h.floatPrecision
+	}
+	return strconv.FormatFloat(val, 'f', prec, 64)
+}
+
+type addfCommand struct {
+	arg1, arg2 floatOperand
+}
+
+func (add *addfCommand) attrs() []any {
+	return []any{"arg1", add.arg1, "arg2", add.arg2}
+}
+
+func (add *addfCommand) Execute(handler Handler) {
+	runFloat(handler, add.arg1, add.arg2, func(a, b float64) float64 { return a + b })
+}
+
+type subfCommand struct {
+	arg1, arg2 floatOperand
+}
+
+func (sub *subfCommand) attrs() []any {
+	return []any{"arg1", sub.arg1, "arg2", sub.arg2}
+}
+
+func (sub *subfCommand) Execute(handler Handler) {
+	runFloat(handler, sub.arg1, sub.arg2, func(a, b float64) float64 { return a - b })
+}
+
+type mulfCommand struct {
+	arg1, arg2 floatOperand
+}
+
+func (mul *mulfCommand) attrs() []any {
+	return []any{"arg1", mul.arg1, "arg2", mul.arg2}
+}
+
+func (mul *mulfCommand) Execute(handler Handler) {
+	runFloat(handler, mul.arg1, mul.arg2, func(a, b float64) float64 { return a * b })
+}
+
+// divfCommand divides like divCommand, but without truncation. Rather than
+// producing an infinity, a zero divisor prints DivisionByZeroError.
+type divfCommand struct {
+	arg1, arg2 floatOperand
+}
+
+func (div *divfCommand) attrs() []any {
+	return []any{"arg1", div.arg1, "arg2", div.arg2}
+}
+
+func (div *divfCommand) Execute(handler Handler) {
+	divisor, ok := div.arg2.resolve(handler)
+	if !ok {
+		return
+	}
+	if divisor == 0 {
+		handler.Post(&errorCommand{msg: DivisionByZeroError})
+		return
+	}
+	runFloat(handler, div.arg1, floatOperand{val: divisor}, func(a, b float64) float64 { return a / b })
+}
+
+// parseFloatOperand accepts finite float literals and variable names.
+func parseFloatOperand(arg string) (floatOperand, error) {
+	if isIdentifier(arg) {
+		return floatOperand{name: arg}, nil
+	}
+	val, err := strconv.ParseFloat(arg, 64)
+	if err != nil || math.IsInf(val, 0) || math.IsNaN(val) {
+		return floatOperand{}, fmt.Errorf(NotNumberError, arg)
+	}
+	return floatOperand{val: val}, nil
+}
+
+func parseFloatArithmetic(command string, build func(arg1, arg2 floatOperand) Command) ParseFunc {
+	return func(args []string) (Command, error) {
+		if len(args) != 2 {
+			return nil, fmt.Errorf(AmbiguousArgsNumberError, command)
+		}
+		arg1, err := parseFloatOperand(args[0])
+		if err != nil {
+			return nil, err
+		}
+		arg2, err := parseFloatOperand(args[1])
+		if err != nil {
+			return nil, err
+		}
+		return build(arg1, arg2), nil
+	}
+}
@@ -0,0 +1,29 @@
+package eventloop
+
+import "testing"
+
+func TestFloatArithmetic(t *testing.T) {
+	tests := []struct {
+		name      string
+		script    string
+		precision int
+		want      string
+		wantErrs  string
+	}{
+		{"fraction", "divf 1 4", DefaultFloatPrecision, "0.25\n", ""},
+		{"shortest form", "addf 0.1 0.2", DefaultFloatPrecision, "0.30000000000000004\n", ""},
+		{"whole result", "mulf 2.5 4", DefaultFloatPrecision, "10\n", ""},
+		{"fixed precision", "divf 1 3", 3, "0.333\n", ""},
+		{"fixed precision padded", "subf 1 0.5", 3, "0.500\n", ""},
+		{"by zero", "divf 1 0", DefaultFloatPrecision, "", "line 1: error: division by zero\n"},
+		{"zero by zero", "divf 0 0", DefaultFloatPrecision, "", "line 1: error: division by zero\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The same script prints the same text on every run.
+			for i := 0; i < 3; i++ {
+				checkOutput(t, tt.script, tt.want, tt.wantErrs, WithFloatPrecision(tt.precision))
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package eventloop
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MARK: - Help
+
+// helpCommand prints the commands of registry, or the usage of a single one.
+// The registry is read when the command executes, so commands registered
+// after parsing are listed too.
+type helpCommand struct {
+	registry *Registry
+	name     string
+}
+
+func (h *helpCommand) Execute(handler Handler) {
+	var b strings.Builder
+	if h.name != "" {
+		help := h.registry.lookupHelp(h.name)
+		fmt.Fprintf(&b, "usage: %s", help.usage)
+		if help.summary != "" {
+			fmt.Fprintf(&b, "\n%s", help.summary)
+		}
+	} else {
+		names := h.registry.Names()
+		width := 0
+		for _, name := range names {
+			width = max(width, len(name))
+		}
+		for i, name := range names {
+			if i > 0 {
+				b.WriteByte('\n')
+			}
+			if summary := h.registry.lookupHelp(name).summary; summary != "" {
+				fmt.Fprintf(&b, "%-*s  %s", width, name, summary)
+			} else {
+				b.WriteString(name)
+			}
+		}
+	}
+	handler.Post(&printCommand{arg: b.String()})
+}
+
+func (r *Registry) parseHelp(args []string) (Command, error) {
+	switch len(args) {
+	case 0:
+		return &helpCommand{registry: r}, nil
+	case 1:
+		_, isCommand := r.lookup(args[0])
+		if _, isBlock := r.lookupBlock(args[0]); !isCommand && !isBlock {
+			return nil, fmt.Errorf(UnknownCommandError, args[0])
+		}
+		return &helpCommand{registry: r, name: args[0]}, nil
+	}
+	return nil, fmt.Errorf(AmbiguousArgsNumberError, "help")
+}
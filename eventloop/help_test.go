@@ -0,0 +1,29 @@
+package eventloop
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHelp(t *testing.T) {
+	out, _ := runScript(t, "help")
+	for _, name := range []string{"add", "sub", "print", "set", "help", "while", "def"} {
+		found := false
+		for _, line := range strings.Split(out, "\n") {
+			if fields := strings.Fields(line); len(fields) > 0 && fields[0] == name {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("help doesn't list %s:\n%s", name, out)
+		}
+	}
+}
+
+func TestHelpCommand(t *testing.T) {
+	checkOutput(t, "help add", "usage: add <a> <b> [c...]\nprint a + b, plus any further operands\n", "")
+
+	if _, err := Parse("help nope"); err == nil {
+		t.Error("help for an unknown command parsed")
+	}
+}
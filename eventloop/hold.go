@@ -0,0 +1,36 @@
+package eventloop
+
+import "time"
+
+// MARK: - Hold
+
+// WithHold starts the loop held: Start launches the workers, but they don't
+// execute anything until Trigger, so that a program can be staged in the
+// queue first and several loops can be started together. Commands posted
+// meanwhile stay queued, and Wait, AwaitFinish and a drain don't complete, as
+// on a paused loop; Stop still does.
+func WithHold(enabled bool) Option {
+	return func(l *EventLoop) {
+		l.hold = enabled
+	}
+}
+
+// Trigger releases a loop held by WithHold, letting the workers execute the
+// queued commands. Once released, the loop stays so for good; calling
+// Trigger again, or on a loop that was never held, does nothing. Trigger
+// doesn't resume a loop paused by Pause.
+func (l *EventLoop) Trigger() {
+	l.queue.release()
+}
+
+// release lets pullBlocking hand out commands of a held queue.
+func (q *commandsQueue) release() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.holding {
+		q.holding = false
+		q.lastActive = time.Now()
+	}
+	q.notify.Broadcast()
+}
@@ -0,0 +1,68 @@
+package eventloop
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHold(t *testing.T) {
+	var out, errs syncBuffer
+	var n atomic.Int64
+	l := newTestLoop(&out, &errs, WithHold(true))
+	l.Start()
+	for range 3 {
+		l.Post(countCommand{&n})
+	}
+	postScript(t, l, "print staged")
+
+	time.Sleep(20 * time.Millisecond)
+	if got := n.Load(); got != 0 || out.String() != "" {
+		t.Fatalf("%d commands and output %q before Trigger, want none", got, out.String())
+	}
+	if got := l.QueueLen(); got != 4 {
+		t.Errorf("%d commands queued before Trigger, want 4", got)
+	}
+
+	l.Trigger()
+	l.AwaitFinish()
+	if got := n.Load(); got != 3 || out.String() != "staged\n" {
+		t.Errorf("%d commands and output %q after Trigger, want all of it", got, out.String())
+	}
+	// Released for good, so a second Trigger does nothing.
+	l.Trigger()
+}
+
+func TestHoldStop(t *testing.T) {
+	var out, errs syncBuffer
+	var n atomic.Int64
+	l := newTestLoop(&out, &errs, WithHold(true))
+	l.Start()
+	l.Post(countCommand{&n})
+
+	stopped := make(chan struct{})
+	go func() {
+		l.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Stop of a held loop did not return")
+	}
+	if got := n.Load(); got != 0 {
+		t.Errorf("%d commands executed by a held loop stopped, want none", got)
+	}
+}
+
+func TestTriggerWithoutHold(t *testing.T) {
+	var n atomic.Int64
+	l := NewEventLoop()
+	l.Trigger()
+	l.Start()
+	l.Post(countCommand{&n})
+	l.AwaitFinish()
+	if n.Load() != 1 {
+		t.Errorf("executed %d commands after a Trigger of an unheld loop, want 1", n.Load())
+	}
+}
@@ -0,0 +1,67 @@
+package eventloop
+
+import "time"
+
+// MARK: - Idle timeout
+
+// WithIdleTimeout stops the loop once no command has executed for d, like
+// Stop, so that a loop serving requests shuts down once they stop coming.
+// Every command finishing restarts the timeout, and a command executing for
+// longer than d keeps the loop from stopping meanwhile; a paused loop, which
+// executes nothing, counts as idle, but a loop held by WithHold only starts
+// counting once triggered. Commands scheduled with Schedule or after
+// that haven't fired yet are cancelled. A non-positive d, the default, never
+// stops the loop.
+func WithIdleTimeout(d time.Duration) Option {
+	return func(l *EventLoop) {
+		l.idleTimeout = d
+	}
+}
+
+// Done returns a channel that is closed once the workers started by the last
+// call to Start have exited.
+func (l *EventLoop) Done() <-chan struct{} {
+	return l.stopSignal
+}
+
+// watchIdle stops the loop once it has been idle for the idle timeout. It
+// returns early when done is closed.
+func (l *EventLoop) watchIdle(done <-chan struct{}) {
+	l.queue.touch()
+	timer := time.NewTimer(l.idleTimeout)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+		case <-done:
+			return
+		}
+		left := l.queue.idleLeft(l.idleTimeout)
+		if left <= 0 {
+			l.Stop()
+			return
+		}
+		timer.Reset(left)
+	}
+}
+
+// touch marks the queue as active now.
+func (q *commandsQueue) touch() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.lastActive = time.Now()
+}
+
+// idleLeft returns how much longer the queue has to stay idle to have been
+// idle for d: d itself while a command is executing or the queue is held,
+// and 0 or less once it has been idle for d.
+func (q *commandsQueue) idleLeft(d time.Duration) time.Duration {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.active > 0 || q.holding {
+		return d
+	}
+	return d - time.Since(q.lastActive)
+}
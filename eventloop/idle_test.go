@@ -0,0 +1,57 @@
+package eventloop
+
+import (
+	"testing"
+	"time"
+)
+
+// awaitDone waits for l to stop on its own and returns how long that took.
+func awaitDone(t *testing.T, l *EventLoop, start time.Time) time.Duration {
+	t.Helper()
+
+	select {
+	case <-l.Done():
+		return time.Since(start)
+	case <-time.After(2 * time.Second):
+		t.Fatal("the loop didn't stop on its own")
+		return 0
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	const idle = 50 * time.Millisecond
+	var out, errs syncBuffer
+	l := newTestLoop(&out, &errs, WithIdleTimeout(idle))
+	start := time.Now()
+	l.Start()
+	postScript(t, l, "print a")
+	if elapsed := awaitDone(t, l, start); elapsed < idle {
+		t.Errorf("stopped after %v, want at least %v of inactivity", elapsed, idle)
+	}
+	if !l.Stopped() || out.String() != "a\n" {
+		t.Errorf("stopped %v, output %q, want the loop stopped after printing a", l.Stopped(), out.String())
+	}
+}
+
+func TestIdleTimeoutWhileBusy(t *testing.T) {
+	const idle = 50 * time.Millisecond
+	var out, errs syncBuffer
+	l := newTestLoop(&out, &errs, WithIdleTimeout(idle))
+	start := time.Now()
+	l.Start()
+
+	// Commands keep flowing for four times the timeout.
+	for range 10 {
+		l.Post(mustParse(t, "nop"))
+		time.Sleep(idle / 3)
+	}
+	if l.Stopped() {
+		t.Fatal("the loop stopped while commands were flowing")
+	}
+	// A command running longer than the timeout doesn't count as idle.
+	postScript(t, l, "sleep 150\nprint after")
+	awaitDone(t, l, start)
+	if out.String() != "after\n" {
+		t.Errorf("output = %q, want the command after the long one run", out.String())
+	}
+}
@@ -0,0 +1,263 @@
+package eventloop
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const IncludeError string = "error: include %v: %v"
+const IncludeSyntaxError string = "error: include %v: line %d: %v"
+const IncludeCycleError string = "error: include %v: cycle through %v"
+const IncludeDepthError string = "error: include %v: nesting deeper than %v"
+const EvalCommandsError string = "error: eval-commands %v: %v"
+const EvalCommandsSyntaxError string = "error: eval-commands %v: line %d: %v"
+const EvalCommandsDepthError string = "error: eval-commands %v: nesting deeper than %v"
+
+// MaxIncludeDepth is how deeply include commands may nest.
+const MaxIncludeDepth = 16
+
+// MARK: - Include
+
+// sourceFile is an instruction file being executed, linked to the file that
+// included it. depth counts the includes leading to it.
+type sourceFile struct {
+	path   string
+	parent *sourceFile
+	depth  int
+}
+
+// includes reports whether path is f or one of the files including it.
+func (f *sourceFile) includes(path string) bool {
+	for ; f != nil; f = f.parent {
+		if f.path == path {
+			return true
+		}
+	}
+	return false
+}
+
+// fileCommand executes cmd as part of file, so that an include among its
+// follow-up commands resolves relative paths against the file's directory.
+// line is that of cmd in the file, if it is an instruction read from one, or
+// 0. A command of a program read from stdin has a line but no file.
+type fileCommand struct {
+	cmd  Command
+	file *sourceFile
+	line int
+}
+
+func (f *fileCommand) attrs() []any {
+	if a, ok := f.cmd.(attrser); ok {
+		return a.attrs()
+	}
+	return nil
+}
+
+func (f *fileCommand) Execute(handler Handler) {
+	f.cmd.Execute(&fileHandler{Handler: handler, file: f.file, line: f.line})
+}
+
+// fileHandler keeps the commands posted or scheduled from within a file
+// attached to it. The errors posted by the instruction on line, if it isn't
+// 0, are reported with the line.
+type fileHandler struct {
+	Handler
+	file *sourceFile
+	line int
+}
+
+func (h *fileHandler) unwrap() Handler {
+	return h.Handler
+}
+
+func (h *fileHandler) wrap(cmd Command) Command {
+	if _, ok := cmd.(*fileCommand); ok || h.file == nil {
+		return cmd
+	}
+	return &fileCommand{cmd: cmd, file: h.file}
+}
+
+func (h *fileHandler) Post(cmd Command) {
+	if e, ok := cmd.(*errorCommand); ok && h.line > 0 && e.line == 0 {
+		withLine := *e
+		withLine.line = h.line
+		cmd = &withLine
+	}
+	h.Handler.Post(h.wrap(cmd))
+}
+
+func (h *fileHandler) Schedule(d time.Duration, cmd Command) {
+	h.Handler.Schedule(d, h.wrap(cmd))
+}
+
+// fileOf returns the file a command executes as part of, or nil.
+func fileOf(handler Handler) *sourceFile {
+	if h, ok := findHandler[*fileHandler](handler); ok {
+		return h.file
+	}
+	return nil
+}
+
+// includeCommand reads an instruction file when it executes and posts its
+// commands behind those already queued. A relative path is resolved against
+// the directory of the including file, or the working directory outside of
+// one. The file is only run if it parses completely; an include cycle or
+// nesting deeper than MaxIncludeDepth is reported instead.
+type includeCommand struct {
+	path     string
+	registry *Registry
+}
+
+func (inc *includeCommand) attrs() []any {
+	return []any{"path", inc.path}
+}
+
+func (inc *includeCommand) Execute(handler Handler) {
+	parent := fileOf(handler)
+	path := inc.path
+	if parent != nil && !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(parent.path), path)
+	}
+	path, err := filepath.Abs(path)
+	if err != nil {
+		handler.Post(&errorCommand{msg: fmt.Sprintf(IncludeError, inc.path, err)})
+		return
+	}
+	if parent.includes(path) {
+		handler.Post(&errorCommand{msg: fmt.Sprintf(IncludeCycleError, inc.path, path)})
+		return
+	}
+	file := &sourceFile{path: path, parent: parent, depth: 1}
+	if parent != nil {
+		file.depth = parent.depth + 1
+	}
+	if file.depth > MaxIncludeDepth {
+		handler.Post(&errorCommand{msg: fmt.Sprintf(IncludeDepthError, inc.path, MaxIncludeDepth)})
+		return
+	}
+
+	prog, ok := inc.load(handler, path)
+	if !ok {
+		return
+	}
+	prog.PostTo(&fileHandler{Handler: handler, file: file})
+}
+
+// load parses the file at path into a program, reporting the first error.
+func (inc *includeCommand) load(handler Handler, path string) (*Program, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		handler.Post(&errorCommand{msg: fmt.Sprintf(IncludeError, inc.path, err)})
+		return nil, false
+	}
+	defer f.Close()
+
+	prog, line, err := readProgram(inc.registry, f)
+	switch {
+	case err != nil && line > 0:
+		handler.Post(&errorCommand{msg: fmt.Sprintf(IncludeSyntaxError, inc.path, line, err)})
+	case err != nil:
+		handler.Post(&errorCommand{msg: fmt.Sprintf(IncludeError, inc.path, err)})
+	}
+	return prog, err == nil
+}
+
+// readProgram parses the lines read from r into a program, dropping the \r
+// of lines ending in \r\n. For a syntax error, it also returns the number of
+// the line with the error.
+func readProgram(registry *Registry, r io.Reader) (*Program, int, error) {
+	var cmds []Command
+	var lines []int
+	parser := registry.LineParser()
+	scanner := bufio.NewScanner(r)
+	lineNo := 1
+	for ; scanner.Scan(); lineNo++ {
+		cmd, err := parser.Parse(strings.TrimSuffix(scanner.Text(), "\r"))
+		if err != nil {
+			return nil, lineNo, err
+		}
+		if cmd != nil {
+			cmds = append(cmds, cmd)
+			lines = append(lines, parser.Line())
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, 0, err
+	}
+	if err := parser.Close(); err != nil {
+		return nil, lineNo, err
+	}
+	prog, err := NewProgram(cmds)
+	if err != nil {
+		return nil, 0, err
+	}
+	prog.Lines = lines
+	return prog, 0, nil
+}
+
+func (r *Registry) parseInclude(args []string) (Command, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "include")
+	}
+	return &includeCommand{path: args[0], registry: r}, nil
+}
+
+// MARK: - Eval commands
+
+// evalCommandsCommand parses the text of a string variable as instruction
+// lines when it executes and posts them behind the commands already queued,
+// like an include of a file holding the text. Its commands run as part of the
+// file of the eval-commands, if any, so that relative includes resolve
+// against its directory, and count as a level of nesting: a variable that
+// evaluates itself, directly or not, stops at MaxIncludeDepth.
+type evalCommandsCommand struct {
+	name     string
+	registry *Registry
+}
+
+func (e *evalCommandsCommand) attrs() []any {
+	return []any{"var", e.name}
+}
+
+func (e *evalCommandsCommand) Execute(handler Handler) {
+	val, ok := lookupVar(handler, e.name)
+	if !ok {
+		return
+	}
+	if !val.IsString() {
+		handler.Post(&errorCommand{msg: fmt.Sprintf(NotStringValueError, e.name, val)})
+		return
+	}
+	parent := fileOf(handler)
+	file := &sourceFile{parent: parent, depth: 1}
+	if parent != nil {
+		file.path = parent.path
+		file.depth = parent.depth + 1
+	}
+	if file.depth > MaxIncludeDepth {
+		handler.Post(&errorCommand{msg: fmt.Sprintf(EvalCommandsDepthError, e.name, MaxIncludeDepth)})
+		return
+	}
+	prog, line, err := readProgram(e.registry, strings.NewReader(val.String()))
+	switch {
+	case err != nil && line > 0:
+		handler.Post(&errorCommand{msg: fmt.Sprintf(EvalCommandsSyntaxError, e.name, line, err)})
+		return
+	case err != nil:
+		handler.Post(&errorCommand{msg: fmt.Sprintf(EvalCommandsError, e.name, err)})
+		return
+	}
+	prog.PostTo(&fileHandler{Handler: handler, file: file})
+}
+
+func (r *Registry) parseEvalCommands(args []string) (Command, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "eval-commands")
+	}
+	return &evalCommandsCommand{name: args[0], registry: r}, nil
+}
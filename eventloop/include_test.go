@@ -0,0 +1,126 @@
+package eventloop
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeScript writes script to name in dir and returns its path.
+func writeScript(t *testing.T, dir, name, script string) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(script), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestInclude(t *testing.T) {
+	dir := t.TempDir()
+	writeScript(t, dir, "inner.txt", "print inner\n")
+	// The include in outer.txt resolves against its own directory.
+	outer := writeScript(t, dir, "outer.txt", "print outer\ninclude inner.txt\n")
+
+	checkOutput(t, "include "+outer+"\nprint main", "main\nouter\ninner\n", "")
+}
+
+func TestIncludeSeesAliases(t *testing.T) {
+	inner := writeScript(t, t.TempDir(), "inner.txt", "say inner\n")
+
+	checkOutput(t, "alias say print\ninclude "+inner, "inner\n", "")
+}
+
+func TestIncludeMissingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing.txt")
+
+	out, errs := runScript(t, "include "+path+"\nprint after")
+	if out != "after\n" {
+		t.Errorf("output = %q, want the script to go on", out)
+	}
+	if !strings.Contains(errs, "error: include "+path) || !strings.Contains(errs, "no such file") {
+		t.Errorf("errors = %q, want the missing file reported", errs)
+	}
+}
+
+func TestIncludeCycle(t *testing.T) {
+	dir := t.TempDir()
+	writeScript(t, dir, "b.txt", "print b\ninclude a.txt\n")
+	a := writeScript(t, dir, "a.txt", "print a\ninclude b.txt\n")
+
+	out, errs := runScript(t, "include "+a)
+	if out != "a\nb\n" {
+		t.Errorf("output = %q, want each file run once", out)
+	}
+	if want := fmt.Sprintf(IncludeCycleError, "a.txt", a); !strings.Contains(errs, want) {
+		t.Errorf("errors = %q, want %q", errs, want)
+	}
+}
+
+func TestIncludeDepthLimit(t *testing.T) {
+	dir := t.TempDir()
+	for i := range MaxIncludeDepth + 1 {
+		writeScript(t, dir, fmt.Sprintf("%d.txt", i), fmt.Sprintf("include %d.txt\n", i+1))
+	}
+	writeScript(t, dir, fmt.Sprintf("%d.txt", MaxIncludeDepth+1), "print deepest\n")
+
+	out, errs := runScript(t, "include "+filepath.Join(dir, "0.txt"))
+	if out != "" {
+		t.Errorf("output = %q, want the deepest file not run", out)
+	}
+	want := fmt.Sprintf(IncludeDepthError, fmt.Sprintf("%d.txt", MaxIncludeDepth), MaxIncludeDepth)
+	if !strings.Contains(errs, want) {
+		t.Errorf("errors = %q, want %q", errs, want)
+	}
+}
+
+// runEvalCommands runs script on a loop with the variables in vars set.
+func runEvalCommands(t *testing.T, vars map[string]string, script string) (out, errs string) {
+	t.Helper()
+
+	var outBuf, errsBuf syncBuffer
+	l := newTestLoop(&outBuf, &errsBuf)
+	for name, text := range vars {
+		l.Vars().Set(name, StringValue(text))
+	}
+	l.Start()
+	postScript(t, l, script)
+	l.AwaitFinish()
+	return outBuf.String(), errsBuf.String()
+}
+
+func TestEvalCommands(t *testing.T) {
+	out, errs := runEvalCommands(t, map[string]string{"s": "print hi\nadd 1 2"}, "eval-commands s\nprint after")
+	// The commands are posted behind those already queued.
+	if want := "after\nhi\n3\n"; out != want {
+		t.Errorf("output = %q, want %q", out, want)
+	}
+	if errs != "" {
+		t.Errorf("errors = %q, want none", errs)
+	}
+}
+
+func TestEvalCommandsErrors(t *testing.T) {
+	vars := map[string]string{"bad": "print a\nfrob", "self": "eval-commands self"}
+
+	out, errs := runEvalCommands(t, vars, "eval-commands bad")
+	if out != "" || !strings.Contains(errs, "error: eval-commands bad: line 2: ") {
+		t.Errorf("output = %q, errors = %q, want nothing run and the error on line 2", out, errs)
+	}
+	_, errs = runEvalCommands(t, vars, "eval-commands self")
+	if want := fmt.Sprintf(EvalCommandsDepthError, "self", MaxIncludeDepth); !strings.Contains(errs, want) {
+		t.Errorf("errors = %q, want %q", errs, want)
+	}
+	_, errs = runEvalCommands(t, vars, "set n 5\neval-commands n")
+	if want := "line 2: " + fmt.Sprintf(NotStringValueError, "n", 5) + "\n"; errs != want {
+		t.Errorf("errors = %q, want %q", errs, want)
+	}
+}
+
+func TestIncludeCRLF(t *testing.T) {
+	path := writeScript(t, t.TempDir(), "crlf.txt", "print \"a b\"\r\nprint c # comment\r\n\r\nadd 1 2\r\n")
+	checkOutput(t, "include "+path, "a b\nc\n3\n", "")
+}
@@ -0,0 +1,85 @@
+package eventloop
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+const NoInputError string = "error: read %v: no input to read from"
+const EndOfInputError string = "error: read %v: end of input"
+const ReadError string = "error: read %v: %v"
+
+// MARK: - Input
+
+// WithInput makes the read command read lines from r. Without it, read
+// reports an error.
+func WithInput(r io.Reader) Option {
+	return func(l *EventLoop) {
+		l.input = &lineReader{r: bufio.NewReader(r)}
+	}
+}
+
+// lineReader hands out the lines of the loop's input one at a time. It is
+// safe for concurrent use.
+type lineReader struct {
+	r  *bufio.Reader
+	mu sync.Mutex
+}
+
+// readLine returns the next line without its line ending. A last line
+// without one is returned as is; after it, readLine returns io.EOF.
+func (lr *lineReader) readLine() (string, error) {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+
+	line, err := lr.r.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimSuffix(line, "\n")
+	return strings.TrimSuffix(line, "\r"), nil
+}
+
+// readCommand stores the next line of the loop's input in a variable, as a
+// string. The loop waits until the line arrives.
+type readCommand struct {
+	name string
+}
+
+func (r *readCommand) attrs() []any {
+	return []any{"var", r.name}
+}
+
+func (r *readCommand) Execute(handler Handler) {
+	h, ok := findHandler[workerHandler](handler)
+	if !ok || h.input == nil {
+		handler.Post(&errorCommand{msg: fmt.Sprintf(NoInputError, r.name)})
+		return
+	}
+	// Show a prompt printed before the read while waiting.
+	h.flush()
+	line, err := h.input.readLine()
+	if err == io.EOF {
+		handler.Post(&errorCommand{msg: fmt.Sprintf(EndOfInputError, r.name)})
+		return
+	}
+	if err != nil {
+		handler.Post(&errorCommand{msg: fmt.Sprintf(ReadError, r.name, err)})
+		return
+	}
+	handler.Vars().Set(r.name, StringValue(line))
+	returnResult(handler, line)
+}
+
+func parseRead(args []string) (Command, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "read")
+	}
+	return &readCommand{name: args[0]}, nil
+}
@@ -0,0 +1,18 @@
+package eventloop
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestRead(t *testing.T) {
+	input := WithInput(strings.NewReader("hello world\r\n42\n"))
+	checkOutput(t, "read a\nread b\nprint $a!\nadd b 1", "hello world!\n43\n", "", input)
+}
+
+func TestReadErrors(t *testing.T) {
+	checkOutput(t, "read a", "", "line 1: "+fmt.Sprintf(NoInputError, "a")+"\n")
+	checkOutput(t, "read a\nread b\nprint $a", "last\n", "line 2: "+fmt.Sprintf(EndOfInputError, "b")+"\n",
+		WithInput(strings.NewReader("last")))
+}
@@ -0,0 +1,106 @@
+package eventloop
+
+import (
+	"fmt"
+	"io"
+)
+
+// MARK: - Journal
+
+// WithJournal writes every instruction the loop executes to w, one line per
+// instruction (several for a block) in the text format, in the order they
+// executed. The output the loop prints itself, like results, is journaled as
+// prints too, and the errors it reports as error instructions, so that a loop
+// using WithReplay reproduces the output of the run by executing the journal.
+// Label, include, eval-commands, after, batch and jumps are left out: the
+// journal holds the instructions of programs, included files, evaluated
+// variables and batches as they executed, and those of after when they ran.
+func WithJournal(w io.Writer) Option {
+	return func(l *EventLoop) {
+		l.journal = w
+	}
+}
+
+// WithReplay prepares the loop to execute a journal written by WithJournal.
+// The journal already holds the output the loop printed itself and the errors
+// it reported, so the loop drops such prints and errors posted by the
+// commands it executes instead of reporting them twice.
+func WithReplay(replay bool) Option {
+	return func(l *EventLoop) {
+		l.replay = replay
+	}
+}
+
+// replayed reports whether cmd is output that a replaying loop drops.
+func (l *EventLoop) replayed(cmd Command) bool {
+	if !l.replay {
+		return false
+	}
+	if f, ok := cmd.(*fileCommand); ok {
+		cmd = f.cmd
+	}
+	switch c := cmd.(type) {
+	case *printCommand:
+		return !c.expand
+	case *errorCommand:
+		return true
+	}
+	return false
+}
+
+// journalEntry returns the lines journaled for cmd, and false if there are
+// none. A command without an instruction, such as one registered by the
+// caller, leaves a comment.
+func journalEntry(cmd Command) (string, bool) {
+	switch c := cmd.(type) {
+	case *programCommand:
+		if c.ip >= len(c.prog.cmds) {
+			return "", false
+		}
+		return journalEntry(c.prog.cmds[c.ip])
+	case *resultCommand:
+		return journalEntry(c.cmd)
+	case *fileCommand:
+		return journalEntry(c.cmd)
+	case *postedCommand:
+		return journalEntry(c.cmd)
+	case *labelCommand, *includeCommand, *evalCommandsCommand, *afterCommand, *batchCommand:
+		return "", false
+	}
+	if isInternal(cmd) || jumps(cmd) {
+		return "", false
+	}
+	if text := textOf(cmd); text != "" {
+		return text, true
+	}
+	return fmt.Sprintf("# %v command not journaled", commandName(cmd)), true
+}
+
+// jumps reports whether cmd is a goto, possibly under a condition, define,
+// repeat or priority.
+func jumps(cmd Command) bool {
+	switch c := cmd.(type) {
+	case *gotoCommand:
+		return true
+	case *ifCommand:
+		return jumps(c.cmd)
+	case *whendefCommand:
+		return jumps(c.cmd)
+	case *repeatCommand:
+		return jumps(c.cmd)
+	case *foreachCommand:
+		return jumps(c.cmd)
+	case *priorityCommand:
+		return jumps(c.cmd)
+	}
+	return false
+}
+
+// writeJournal journals cmd before it executes, so that the journal of a run
+// that crashes names the instruction it crashed on. Each entry is a single
+// write, so entries of concurrent workers don't mix.
+func (l *EventLoop) writeJournal(cmd Command) {
+	if text, ok := journalEntry(cmd); ok {
+		io.WriteString(l.journal, text+"\n")
+	}
+}
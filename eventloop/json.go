@@ -0,0 +1,72 @@
+package eventloop
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const InvalidJSONError string = "SYNTAX ERROR: invalid JSON instruction: %v"
+const MissingJSONCommandError string = "SYNTAX ERROR: JSON instruction has no \"cmd\""
+
+// MARK: - JSON instructions
+
+// jsonInstruction is the JSON form of an instruction line: the command name
+// and its arguments, each of which is one field of the text form.
+type jsonInstruction struct {
+	Cmd  string   `json:"cmd"`
+	Args []string `json:"args"`
+}
+
+// ParseJSON builds the command described by a JSON object such as
+// {"cmd":"add","args":["1","2"]}, which is equivalent to the line "add 1 2".
+// Commands taking another command, like repeat, continue it in args:
+// {"cmd":"repeat","args":["3","print","hi"]}. A blank line yields a nil
+// command and a nil error.
+func (r *Registry) ParseJSON(line string) (Command, error) {
+	parts, seps, err := jsonInstructionFields(line)
+	if err != nil || len(parts) == 0 {
+		return nil, err
+	}
+	return r.scope().parseInstruction(parts, seps)
+}
+
+// jsonInstructionFields is jsonFields, also returning the indexes of the
+// fields holding just parallelSeparator. JSON has no quotes to tell them
+// apart by, so all of them separate the commands of a parallel.
+func jsonInstructionFields(line string) ([]string, []int, error) {
+	parts, err := jsonFields(line)
+	var seps []int
+	for i, part := range parts {
+		if part == parallelSeparator {
+			seps = append(seps, i)
+		}
+	}
+	return parts, seps, err
+}
+
+// jsonFields splits a JSON instruction into the fields of its text form.
+func jsonFields(line string) ([]string, error) {
+	if strings.TrimSpace(line) == "" {
+		return nil, nil
+	}
+	var in jsonInstruction
+	dec := json.NewDecoder(strings.NewReader(line))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&in); err != nil {
+		return nil, fmt.Errorf(InvalidJSONError, err)
+	}
+	if dec.More() {
+		return nil, fmt.Errorf(InvalidJSONError, "unexpected data after the object")
+	}
+	if in.Cmd == "" {
+		return nil, errors.New(MissingJSONCommandError)
+	}
+	return append([]string{in.Cmd}, in.Args...), nil
+}
+
+// ParseJSON parses a JSON instruction using the built-in commands only.
+func ParseJSON(line string) (Command, error) {
+	return builtins.ParseJSON(line)
+}
@@ -0,0 +1,47 @@
+package eventloop
+
+import "testing"
+
+func TestJSONMatchesText(t *testing.T) {
+	text := `set x 4
+add x 2 3
+print "two words"
+repeat 2 print again
+while x lt 6
+inc x
+endwhile
+get x`
+	json := `{"cmd": "set", "args": ["x", "4"]}
+{"cmd": "add", "args": ["x", "2", "3"]}
+{"cmd": "print", "args": ["two words"]}
+{"cmd": "repeat", "args": ["2", "print", "again"]}
+{"cmd": "while", "args": ["x", "lt", "6"]}
+{"cmd": "inc", "args": ["x"]}
+{"cmd": "endwhile"}
+{"cmd": "get", "args": ["x"]}`
+
+	run := func(parser *LineParser, script string) (string, string) {
+		var out, errs syncBuffer
+		l := newTestLoop(&out, &errs)
+		l.Start()
+		postScriptWith(t, l, parser, script)
+		l.AwaitFinish()
+		return out.String(), errs.String()
+	}
+	textOut, textErrs := run(NewLineParser(), text)
+	jsonOut, jsonErrs := run(NewJSONLineParser(), json)
+	if want := "two words\nagain\nagain\n9\n6\n"; textOut != want {
+		t.Errorf("text output = %q, want %q", textOut, want)
+	}
+	if jsonOut != textOut || jsonErrs != textErrs {
+		t.Errorf("JSON printed %q and reported %q, text %q and %q", jsonOut, jsonErrs, textOut, textErrs)
+	}
+}
+
+func TestParseJSONErrors(t *testing.T) {
+	for _, line := range []string{`{"cmd": "frob"}`, `{"cmd": "add", "args": ["1"]}`, `not json`, `{"args": ["1", "2"]}`} {
+		if cmd, err := ParseJSON(line); err == nil {
+			t.Errorf("ParseJSON(%q) = %v, want an error", line, cmd)
+		}
+	}
+}
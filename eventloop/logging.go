@@ -0,0 +1,49 @@
+package eventloop
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// MARK: - Logging
+
+// nopHandler discards every record; it is the default so that logging costs
+// nothing unless a logger is configured.
+type nopHandler struct{}
+
+func (nopHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (nopHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h nopHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h nopHandler) WithGroup(string) slog.Handler           { return h }
+
+// attrser is implemented by commands that add their arguments to log records.
+type attrser interface {
+	attrs() []any
+}
+
+func commandAttrs(cmd Command) []any {
+	attrs := []any{"command", commandName(cmd)}
+	if a, ok := cmd.(attrser); ok {
+		attrs = append(attrs, a.attrs()...)
+	}
+	return attrs
+}
+
+func (l *EventLoop) logReceived(cmd Command) {
+	if !l.logger.Enabled(context.Background(), slog.LevelDebug) {
+		return
+	}
+	l.logger.Debug("command received", commandAttrs(cmd)...)
+}
+
+func (l *EventLoop) logExecuted(cmd Command, d time.Duration) {
+	if !l.logger.Enabled(context.Background(), slog.LevelInfo) {
+		return
+	}
+	l.logger.Info("command executed", append(commandAttrs(cmd), "duration", d)...)
+}
+
+func (l *EventLoop) logErrored(cmd Command, err any) {
+	l.logger.Error("command errored", append(commandAttrs(cmd), "error", err)...)
+}
@@ -0,0 +1,57 @@
+package eventloop
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"testing"
+)
+
+// captureHandler keeps the records logged through it.
+type captureHandler struct {
+	mu      sync.Mutex
+	records []slog.Record
+}
+
+func (h *captureHandler) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h *captureHandler) Handle(_ context.Context, r slog.Record) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.records = append(h.records, r)
+	return nil
+}
+
+func (h *captureHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+func (h *captureHandler) WithGroup(string) slog.Handler      { return h }
+
+func TestLogsExecutedCommand(t *testing.T) {
+	h := &captureHandler{}
+	var out, errs syncBuffer
+	l := newTestLoop(&out, &errs, WithLogger(slog.New(h)))
+	l.Start()
+	l.Post(mustParse(t, "sub 5 3"))
+	l.AwaitFinish()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, r := range h.records {
+		if r.Message != "command executed" || r.Level != slog.LevelInfo {
+			continue
+		}
+		attrs := make(map[string]slog.Value)
+		r.Attrs(func(a slog.Attr) bool {
+			attrs[a.Key] = a.Value
+			return true
+		})
+		if attrs["command"].String() != "sub" {
+			continue
+		}
+		if _, ok := attrs["duration"]; !ok {
+			t.Error("execute event for sub has no duration")
+		}
+		return
+	}
+	t.Errorf("no execute event for sub among %d records", len(h.records))
+}
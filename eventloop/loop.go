@@ -0,0 +1,772 @@
+// Package eventloop implements a command queue drained by a worker goroutine,
+// together with the built-in commands of the instruction language.
+package eventloop
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MARK: - EventLoop
+
+// EventLoop executes posted commands one at a time, in FIFO order, on a
+// dedicated worker goroutine.
+type EventLoop struct {
+	queue          *commandsQueue
+	vars           *Store
+	output         io.Writer
+	errors         io.Writer
+	errorCount     atomic.Int64
+	ctx            context.Context
+	middleware     []Middleware
+	metrics        *metrics
+	recover        bool
+	failFast       bool
+	workers        int
+	floatPrecision int
+	rand           *lockedRand
+	lookupEnv      func(key string) (string, bool)
+	logger         *slog.Logger
+	timings        io.Writer
+	journal        io.Writer
+	echo           io.Writer
+	trace          *trace
+	replay         bool
+	input          *lineReader
+	maxCommands    int64
+	commandCount   atomic.Int64
+	postIDs        atomic.Uint64
+	dedupe         bool
+	maxDepth       int
+	allowExec      bool
+	execTimeout    time.Duration
+	idleTimeout    time.Duration
+	hold           bool
+	defines        map[string]string
+	fileRoot       string
+	stack          *stack
+	macros         *macros
+	maxIterations  int
+	routes         map[string]*EventLoop
+	awaitRoutes    bool
+	color          bool
+	limiter        *limiter
+	clock          func() time.Time
+	tics           *tics
+	saved          *savedVars
+	bufferOutput   bool
+	buffered       *bufferedWriter
+	timers         *timers
+	signals        *signals
+	abandoned      sync.WaitGroup
+	stopSignal     chan struct{}
+	halt           *halt
+	isStopped      atomic.Bool
+	exitCode       atomic.Int32
+	started        bool
+}
+
+// Option configures an EventLoop created by NewEventLoop.
+type Option func(l *EventLoop)
+
+// WithOutput routes the output of print commands to w instead of os.Stdout.
+func WithOutput(w io.Writer) Option {
+	return func(l *EventLoop) {
+		l.output = w
+	}
+}
+
+// WithContext stops the loop once ctx is done. Cancellation behaves like Stop:
+// the command being executed finishes and anything still queued is discarded.
+func WithContext(ctx context.Context) Option {
+	return func(l *EventLoop) {
+		l.ctx = ctx
+	}
+}
+
+// WithMaxSize bounds the queue to n commands. Once it is full Post blocks
+// until the worker frees a slot, and TryPost reports false. Commands posted
+// from within Execute, and the stop marker, bypass the limit so the worker
+// can never block on itself.
+func WithMaxSize(n int) Option {
+	return func(l *EventLoop) {
+		l.queue = newCommandsQueue(n)
+	}
+}
+
+// WithMaxDepth caps the queue at n commands: instead of waiting for room, as
+// with WithMaxSize, Post and TryPost reject a command posted to a queue
+// holding n commands already, Post reporting so on the error output. This
+// keeps a producer posting faster than the loop executes from growing the
+// queue without bounds. Commands posted from within Execute and the loop's
+// bookkeeping, like the commands of Wait, are never rejected. Zero, the
+// default, leaves the queue uncapped.
+func WithMaxDepth(n int) Option {
+	return func(l *EventLoop) {
+		l.maxDepth = n
+	}
+}
+
+// Middleware wraps the execution of every command. Calling next runs the
+// rest of the chain and finally the command itself; returning without
+// calling it skips the command.
+type Middleware func(cmd Command, next func())
+
+// WithMiddleware appends mw to the loop's middleware. The first middleware
+// registered is the outermost one.
+func WithMiddleware(mw ...Middleware) Option {
+	return func(l *EventLoop) {
+		l.middleware = append(l.middleware, mw...)
+	}
+}
+
+// WithRecover controls whether a panicking command is recovered, reported on
+// the error output and skipped (the default), or allowed to crash the program.
+func WithRecover(enabled bool) Option {
+	return func(l *EventLoop) {
+		l.recover = enabled
+	}
+}
+
+// WithFailFast makes the first failing assert stop the loop, abandoning
+// anything still queued, instead of carrying on to report further failures.
+func WithFailFast(enabled bool) Option {
+	return func(l *EventLoop) {
+		l.failFast = enabled
+	}
+}
+
+// WithFloatPrecision sets how many digits after the decimal point the float
+// commands print. The default, DefaultFloatPrecision, prints as many as
+// needed to identify the result.
+func WithFloatPrecision(digits int) Option {
+	return func(l *EventLoop) {
+		l.floatPrecision = digits
+	}
+}
+
+// WithRand makes the rand command draw from r, for example to get the same
+// numbers on every run from a fixed seed. By default the source is seeded
+// from the current time. The loop takes ownership of r.
+func WithRand(r *rand.Rand) Option {
+	return func(l *EventLoop) {
+		l.rand = newLockedRand(r)
+	}
+}
+
+// WithEnv replaces os.LookupEnv as the source of the getenv command.
+func WithEnv(lookup func(key string) (string, bool)) Option {
+	return func(l *EventLoop) {
+		l.lookupEnv = lookup
+	}
+}
+
+// WithWorkers sets how many worker goroutines drain the queue. An ordered
+// loop always uses a single worker, which executes commands strictly one at a
+// time in FIFO order. An unordered loop with n > 1 workers starts commands in
+// FIFO order but runs up to n of them concurrently, so they may finish, and
+// their follow-up commands may be queued, in any order. Draining still waits
+// for every worker to go idle before the loop stops.
+func WithWorkers(n int, ordered bool) Option {
+	return func(l *EventLoop) {
+		if ordered || n < 1 {
+			n = 1
+		}
+		l.workers = n
+	}
+}
+
+// WithLogger emits a structured record whenever a command is received,
+// executed or panics. By default nothing is logged.
+func WithLogger(logger *slog.Logger) Option {
+	return func(l *EventLoop) {
+		l.logger = logger
+	}
+}
+
+// WithTimings writes a line such as "[add] 12µs" to w after every command,
+// telling how long its Execute took.
+func WithTimings(w io.Writer) Option {
+	return func(l *EventLoop) {
+		l.timings = w
+	}
+}
+
+// WithDedupe drops a posted command that is identical to the last one still
+// waiting in the queue, which collapses runs of repeated commands in an
+// idempotent stream. Commands are identical if they have the same type and
+// arguments.
+func WithDedupe(enabled bool) Option {
+	return func(l *EventLoop) {
+		l.dedupe = enabled
+	}
+}
+
+// WithExec allows the exec and capture commands to run external programs,
+// which they refuse to do by default. A positive timeout kills a program that
+// runs longer. Programs are also killed once the loop's context is done.
+func WithExec(timeout time.Duration) Option {
+	return func(l *EventLoop) {
+		l.allowExec = true
+		l.execTimeout = timeout
+	}
+}
+
+// WithFileRoot confines the paths of readfile and writefile to the directory
+// root, the working directory by default. Relative paths are resolved
+// against it, and symbolic links pointing out of it are refused.
+func WithFileRoot(root string) Option {
+	return func(l *EventLoop) {
+		l.fileRoot = root
+	}
+}
+
+// WithRate limits the loop to starting perSecond commands a second, however
+// many workers it has. Bookkeeping such as the stop marker of a drain isn't
+// limited. A non-positive rate means no limit.
+func WithRate(perSecond float64) Option {
+	return func(l *EventLoop) {
+		l.limiter = nil
+		if perSecond > 0 {
+			l.limiter = newLimiter(perSecond)
+		}
+	}
+}
+
+// WithMaxIterations makes a while loop give up with an error after n
+// iterations. Zero, the default, means no limit.
+func WithMaxIterations(n int) Option {
+	return func(l *EventLoop) {
+		l.maxIterations = n
+	}
+}
+
+// WithMaxCommands stops the loop once it has executed n commands since it
+// was started, counting every command, including the prints of results, but
+// not the bookkeeping of the loop. Zero, the default, means no limit.
+func WithMaxCommands(n int64) Option {
+	return func(l *EventLoop) {
+		l.maxCommands = n
+	}
+}
+
+// WithClock replaces time.Now as the clock read by the now, tic and toc
+// commands.
+func WithClock(now func() time.Time) Option {
+	return func(l *EventLoop) {
+		l.clock = now
+	}
+}
+
+// WithBufferedOutput collects the output of print commands in a buffer that
+// is written out whenever the queue runs empty, before Wait returns and once
+// the loop has finished, instead of writing every line separately. The bytes
+// written are the same, but far fewer writes reach the underlying writer.
+// Everything printed before a flush, sleep, read, exec or capture command,
+// and before an error is reported, is written out before that command
+// starts waiting, so that the output doesn't lag behind while it does.
+func WithBufferedOutput(enabled bool) Option {
+	return func(l *EventLoop) {
+		l.bufferOutput = enabled
+	}
+}
+
+// NewEventLoop creates a loop writing to os.Stdout; call Start to run it.
+func NewEventLoop(opts ...Option) *EventLoop {
+	l := &EventLoop{
+		queue:          newCommandsQueue(0),
+		vars:           newStore(),
+		output:         os.Stdout,
+		errors:         os.Stderr,
+		ctx:            context.Background(),
+		metrics:        newMetrics(),
+		recover:        true,
+		workers:        1,
+		floatPrecision: DefaultFloatPrecision,
+		rand:           newLockedRand(nil),
+		lookupEnv:      os.LookupEnv,
+		fileRoot:       ".",
+		stack:          &stack{},
+		macros:         newMacros(),
+		clock:          time.Now,
+		tics:           newTics(),
+		saved:          newSavedVars(),
+		logger:         slog.New(nopHandler{}),
+		timers:         newTimers(),
+		signals:        newSignals(),
+		stopSignal:     make(chan struct{}),
+		halt:           newHalt(),
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	l.queue.dedupe = l.dedupe
+	l.queue.maxDepth = l.maxDepth
+	l.queue.holding = l.hold
+	if l.bufferOutput {
+		l.buffered = &bufferedWriter{w: bufio.NewWriter(l.output)}
+		l.output = l.buffered
+	}
+	// Post reports the commands it rejects from the caller's goroutine.
+	l.errors = &syncWriter{w: l.errors}
+	// The commands of a parallel block print from goroutines of their own,
+	// even with a single worker.
+	if l.buffered == nil {
+		l.output = &syncWriter{w: l.output}
+	}
+	if l.workers > 1 {
+		if l.timings != nil {
+			l.timings = &syncWriter{w: l.timings}
+		}
+		if l.journal != nil {
+			l.journal = &syncWriter{w: l.journal}
+		}
+		if l.echo != nil {
+			l.echo = &syncWriter{w: l.echo}
+		}
+	}
+	return l
+}
+
+// syncWriter serializes writes from concurrent workers.
+type syncWriter struct {
+	w  io.Writer
+	mu sync.Mutex
+}
+
+func (s *syncWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.w.Write(p)
+}
+
+// bufferedWriter is the output of a loop created with WithBufferedOutput. It
+// is safe for concurrent use.
+type bufferedWriter struct {
+	w  *bufio.Writer
+	mu sync.Mutex
+}
+
+func (b *bufferedWriter) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.w.Write(p)
+}
+
+func (b *bufferedWriter) Flush() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.w.Flush()
+}
+
+// flush writes out buffered output, if the output is buffered.
+func (l *EventLoop) flush() {
+	if l.buffered != nil {
+		l.buffered.Flush()
+	}
+}
+
+// flushOutput flushes the output of the loop executing a command.
+func flushOutput(handler Handler) {
+	if h, ok := findHandler[workerHandler](handler); ok {
+		h.flush()
+	}
+}
+
+// Start launches the worker goroutines. They exit once the loop stops, by
+// Stop, a drain, the cancellation of its context or the idle timeout of
+// WithIdleTimeout, and AwaitFinish returns only after they have. A loop that
+// has been stopped can be started again: Start waits for the previous worker
+// to exit, then resets the stop state. Commands left in the queue by Stop
+// run in the new session.
+func (l *EventLoop) Start() {
+	if l.started {
+		<-l.stopSignal
+		l.stopSignal = make(chan struct{})
+		l.isStopped.Store(false)
+		l.halt.reset()
+		l.queue.reopen()
+		l.commandCount.Store(0)
+		if l.limiter != nil {
+			l.limiter.reset()
+		}
+	}
+	l.started = true
+
+	// Every goroutine of the session has exited by the time stopSignal is
+	// closed, except the one closing it, so that a finished loop leaves
+	// nothing running behind.
+	var watcher sync.WaitGroup
+	workersDone := make(chan struct{})
+	if done := l.ctx.Done(); done != nil {
+		watcher.Add(1)
+		go func() {
+			defer watcher.Done()
+			select {
+			case <-done:
+				l.Stop()
+			case <-workersDone:
+			}
+		}()
+	}
+	if l.idleTimeout > 0 {
+		watcher.Add(1)
+		go func() {
+			defer watcher.Done()
+			l.watchIdle(workersDone)
+		}()
+	}
+	var wg sync.WaitGroup
+	wg.Add(l.workers)
+	for i := 0; i < l.workers; i++ {
+		go func() {
+			defer wg.Done()
+			for !l.isStopped.Load() {
+				cmd, ok := l.queue.pullBlocking()
+				if !ok {
+					continue
+				}
+				if l.limiter != nil && !isInternal(cmd) && !l.limiter.wait() {
+					// Stopped while waiting: keep cmd for the next session.
+					l.queue.unpull(cmd)
+					continue
+				}
+				if l.overLimit(cmd) {
+					l.queue.unpull(cmd)
+					l.Stop()
+					continue
+				}
+				l.execute(cmd)
+				l.queue.finish()
+				if l.buffered != nil && l.queue.empty() {
+					l.flush()
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(workersDone)
+		watcher.Wait()
+		l.flush()
+		close(l.stopSignal)
+	}()
+}
+
+const PanicError string = "panic in %v command: %v\n"
+const CommandLimitError string = "error: command limit of %v reached, stopping\n"
+
+// overLimit counts cmd against the limit of WithMaxCommands and reports
+// whether executing it would exceed the limit, reporting that the first
+// time.
+func (l *EventLoop) overLimit(cmd Command) bool {
+	if l.maxCommands <= 0 || isInternal(cmd) {
+		return false
+	}
+	n := l.commandCount.Add(1)
+	if n == l.maxCommands+1 {
+		l.report(fmt.Sprintf(CommandLimitError, l.maxCommands))
+	}
+	return n > l.maxCommands
+}
+
+func (l *EventLoop) execute(cmd Command) {
+	if l.recover {
+		defer func() {
+			if r := recover(); r != nil {
+				l.logErrored(cmd, r)
+				l.report(fmt.Sprintf(PanicError, commandName(cmd), r))
+			}
+		}()
+	}
+	if l.journal != nil {
+		l.writeJournal(cmd)
+	}
+	if l.echo != nil {
+		l.writeEcho(cmd)
+	}
+	next := func() {
+		start := time.Now()
+		cmd.Execute(workerHandler{l})
+		if !isInternal(cmd) {
+			if l.trace != nil {
+				l.trace.record(cmd)
+			}
+			d := time.Since(start)
+			l.metrics.record(commandName(cmd), d)
+			l.logExecuted(cmd, d)
+			if l.timings != nil {
+				fmt.Fprintf(l.timings, "[%s] %v\n", commandName(cmd), d)
+			}
+		}
+	}
+	for i := len(l.middleware) - 1; i >= 0; i-- {
+		mw, inner := l.middleware[i], next
+		next = func() { mw(cmd, inner) }
+	}
+	next()
+}
+
+// QueueLen returns how many commands are waiting to execute. A pending stop
+// marker is not counted.
+func (l *EventLoop) QueueLen() int {
+	return l.queue.pending()
+}
+
+// QueueSnapshot returns the names of the waiting commands in execution
+// order, without modifying the queue.
+func (l *EventLoop) QueueSnapshot() []string {
+	cmds := l.queue.snapshot()
+	names := make([]string, len(cmds))
+	for i, cmd := range cmds {
+		names[i] = commandName(cmd)
+	}
+	return names
+}
+
+// ClearQueue discards every waiting command and returns how many it dropped.
+// Commands that are already executing are unaffected, and a pending drain
+// still stops the loop once they finish.
+func (l *EventLoop) ClearQueue() int {
+	return l.queue.clear()
+}
+
+// Stats returns a snapshot of the loop's execution metrics.
+func (l *EventLoop) Stats() Stats {
+	stats := l.metrics.snapshot()
+	stats.PeakDepth = l.queue.peakDepth()
+	return stats
+}
+
+// ResetStats clears the execution metrics. The peak depth starts over from
+// the commands queued at the time.
+func (l *EventLoop) ResetStats() {
+	l.metrics.reset()
+	l.queue.resetPeak()
+}
+
+// Stop halts the loop immediately: the command being executed finishes, but
+// everything still queued is abandoned. Use StopAndDrain to run it first.
+// Commands scheduled with Schedule that have not fired yet are cancelled, and
+// a waitsignal command gives up waiting, as does retry waiting out a backoff.
+func (l *EventLoop) Stop() {
+	l.isStopped.Store(true)
+	l.halt.close()
+	l.queue.close()
+	l.timers.cancelAll()
+	l.signals.wake()
+	if l.limiter != nil {
+		l.limiter.stop()
+	}
+}
+
+// Stopped reports whether the loop has been stopped, by Stop, a finished
+// drain or an exit command.
+func (l *EventLoop) Stopped() bool {
+	return l.isStopped.Load()
+}
+
+// ExitCode returns the status requested by the last exit command, 1 if an
+// assert failed without one, or 0 otherwise.
+func (l *EventLoop) ExitCode() int {
+	return int(l.exitCode.Load())
+}
+
+// Pause keeps the workers from starting further commands until Resume. The
+// commands being executed finish normally, and everything posted meanwhile
+// stays queued. Wait, AwaitFinish and a drain don't complete while the loop
+// is paused, but Stop does.
+func (l *EventLoop) Pause() {
+	l.queue.setPaused(true)
+}
+
+// Resume lets a paused loop carry on with the queued commands.
+func (l *EventLoop) Resume() {
+	l.queue.setPaused(false)
+}
+
+const QueueDepthError string = "error: queue depth limit of %v reached, %v command rejected\n"
+
+// Post enqueues cmd for execution, blocking while a bounded queue is full. A
+// queue capped by WithMaxDepth rejects cmd instead once it is at the cap.
+func (l *EventLoop) Post(cmd Command) {
+	l.post(cmd)
+}
+
+// post is Post, reporting whether cmd was queued.
+func (l *EventLoop) post(cmd Command) bool {
+	l.logReceived(cmd)
+	if !l.queue.pushBlocking(cmd) {
+		l.report(fmt.Sprintf(QueueDepthError, l.maxDepth, commandName(cmd)))
+		return false
+	}
+	return true
+}
+
+// PostWithResult enqueues cmd and returns a channel delivering the value the
+// command computes, such as the sum of an add. The channel is buffered and
+// closed once cmd has executed, so it never blocks the worker and yields
+// nothing for commands without a result.
+func (l *EventLoop) PostWithResult(cmd Command) <-chan any {
+	results := make(chan any, 1)
+	l.Post(&resultCommand{cmd: cmd, results: results})
+	return results
+}
+
+// Schedule posts cmd after d without blocking the loop. A draining loop
+// waits for scheduled commands before it stops.
+func (l *EventLoop) Schedule(d time.Duration, cmd Command) {
+	l.timers.schedule(d, func() {
+		if !l.isStopped.Load() {
+			l.queue.push(cmd)
+		}
+	})
+}
+
+// CancelScheduled cancels the commands scheduled with Schedule, or by after,
+// that haven't fired yet, and returns how many it cancelled. A cancelled
+// command is never posted; one that is firing already still may be.
+func (l *EventLoop) CancelScheduled() int {
+	return l.timers.cancelAll()
+}
+
+// TryPost enqueues cmd and reports whether it did. Unlike Post, which waits
+// for room if needed, it never blocks: it returns false instead if a bounded
+// queue is full or a capped one at its cap, or if the loop has stopped and
+// would never execute cmd. A draining loop still accepts commands, which run
+// before it stops.
+func (l *EventLoop) TryPost(cmd Command) bool {
+	return l.queue.tryPush(cmd)
+}
+
+// Vars returns the loop's variable store.
+func (l *EventLoop) Vars() *Store {
+	return l.vars
+}
+
+// Output returns the writer print commands write to.
+func (l *EventLoop) Output() io.Writer {
+	return l.output
+}
+
+// StopAndDrain lets the loop execute every queued command, including the
+// follow-ups posted while draining, and stops it once the queue is empty.
+func (l *EventLoop) StopAndDrain() {
+	if l.isStopped.Load() {
+		return
+	}
+	l.queue.push(&stopCommand{loop: l})
+}
+
+// AwaitFinish drains the loop and blocks until its worker has exited. It may
+// be called after Stop and more than once; stopSignal is closed exactly once,
+// by the worker, so every call returns once the loop is finished. It also
+// waits for the commands a timeout gave up on to return, and with
+// WithAwaitRoutes for the routed-to loops too.
+func (l *EventLoop) AwaitFinish() {
+	l.AwaitFinishTimeout(0)
+}
+
+// ErrTimeout is returned by AwaitFinishTimeout when the loop is still running
+// at the deadline.
+var ErrTimeout = errors.New("eventloop: timed out waiting for the loop to finish")
+
+// AwaitFinishTimeout is like AwaitFinish but gives up after d, returning
+// ErrTimeout; a non-positive d waits forever. On a timeout the loop keeps
+// draining, and the caller may Stop it or wait again.
+func (l *EventLoop) AwaitFinishTimeout(d time.Duration) error {
+	l.StopAndDrain()
+	var timeout <-chan time.Time
+	if d > 0 {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	deadline := time.Now().Add(d)
+
+	select {
+	case <-l.stopSignal:
+	case <-timeout:
+		return ErrTimeout
+	}
+	abandoned := make(chan struct{})
+	go func() {
+		l.abandoned.Wait()
+		close(abandoned)
+	}()
+	select {
+	case <-abandoned:
+	case <-timeout:
+		return ErrTimeout
+	}
+	if !l.awaitRoutes {
+		return nil
+	}
+	for _, child := range l.routes {
+		left := time.Duration(0)
+		if d > 0 {
+			if left = time.Until(deadline); left <= 0 {
+				return ErrTimeout
+			}
+		}
+		if err := child.AwaitFinishTimeout(left); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Wait blocks until every command posted so far, including the follow-up
+// commands they post, has executed. It returns immediately on a stopped loop,
+// and as soon as the loop finishes if it is stopped while waiting.
+func (l *EventLoop) Wait() {
+	if l.isStopped.Load() {
+		return
+	}
+	done := make(chan struct{})
+	l.Post(&waitCommand{loop: l, done: done})
+	select {
+	case <-done:
+	case <-l.stopSignal:
+	}
+}
+
+// workerHandler is the Handler passed to executing commands. Its Post ignores
+// the queue size limit, since blocking there would deadlock the worker.
+type workerHandler struct {
+	*EventLoop
+}
+
+func (h workerHandler) Post(cmd Command) {
+	if h.replayed(cmd) {
+		return
+	}
+	h.logReceived(cmd)
+	h.queue.push(cmd)
+}
+
+// Command is a unit of work executed by the loop.
+type Command interface {
+	Execute(handler Handler)
+}
+
+// Handler is the view of the loop available to an executing command.
+type Handler interface {
+	Post(cmd Command)
+	Stop()
+	Schedule(d time.Duration, cmd Command)
+	Vars() *Store
+	Output() io.Writer
+}
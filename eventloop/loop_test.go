@@ -0,0 +1,780 @@
+package eventloop
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// syncBuffer is a bytes.Buffer that several workers can write to at once.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.String()
+}
+
+// countCommand counts its executions.
+type countCommand struct {
+	n *atomic.Int64
+}
+
+func (c countCommand) Execute(handler Handler) {
+	c.n.Add(1)
+}
+
+// newTestLoop returns a loop printing to out and reporting errors to errs.
+func newTestLoop(out, errs *syncBuffer, opts ...Option) *EventLoop {
+	return NewEventLoop(append([]Option{WithOutput(out), WithErrorOutput(errs)}, opts...)...)
+}
+
+// postScript parses script, one instruction per line, as a program and posts
+// it to l.
+func postScript(t *testing.T, l *EventLoop, script string) {
+	t.Helper()
+	postScriptWith(t, l, NewLineParser(), script)
+}
+
+// postScriptWith is postScript in the language of parser.
+func postScriptWith(t *testing.T, l *EventLoop, parser *LineParser, script string) {
+	t.Helper()
+
+	var cmds []Command
+	var lines []int
+	for _, line := range strings.Split(script, "\n") {
+		cmd, err := parser.Parse(line)
+		if err != nil {
+			t.Fatalf("parsing %q: %v", line, err)
+		}
+		if cmd != nil {
+			cmds = append(cmds, cmd)
+			lines = append(lines, parser.Line())
+		}
+	}
+	if err := parser.Close(); err != nil {
+		t.Fatal(err)
+	}
+	prog, err := NewProgram(cmds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prog.Lines = lines
+	prog.PostTo(l)
+}
+
+// runScript executes script on a new loop with opts and returns what it
+// printed and the errors it reported.
+func runScript(t *testing.T, script string, opts ...Option) (string, string) {
+	t.Helper()
+
+	var out, errs syncBuffer
+	l := newTestLoop(&out, &errs, opts...)
+	l.Start()
+	postScript(t, l, script)
+	l.AwaitFinish()
+	return out.String(), errs.String()
+}
+
+// workerStacks returns the stacks of the goroutines executing in the
+// queue's pullBlocking.
+func workerStacks() []string {
+	buf := make([]byte, 1<<20)
+	buf = buf[:runtime.Stack(buf, true)]
+	var stacks []string
+	for _, g := range strings.Split(string(buf), "\n\n") {
+		if strings.Contains(g, "(*commandsQueue).pullBlocking") {
+			stacks = append(stacks, g)
+		}
+	}
+	return stacks
+}
+
+func TestIdleWorkerIsParked(t *testing.T) {
+	var out, errs syncBuffer
+	l := newTestLoop(&out, &errs)
+	l.Start()
+	defer l.AwaitFinish()
+
+	idle := time.Second
+	if testing.Short() {
+		idle = 100 * time.Millisecond
+	}
+	time.Sleep(idle)
+	stacks := workerStacks()
+	if len(stacks) != 1 {
+		t.Fatalf("got %d goroutines in pullBlocking, want 1", len(stacks))
+	}
+	if header, _, _ := strings.Cut(stacks[0], "\n"); !strings.Contains(header, "[sync.Cond.Wait") {
+		t.Errorf("idle worker is not parked: %s", header)
+	}
+	if n := l.Stats().Executed; n != 0 {
+		t.Errorf("idle loop executed %d commands", n)
+	}
+}
+
+func TestConcurrentStop(t *testing.T) {
+	var out, errs syncBuffer
+	l := newTestLoop(&out, &errs)
+	l.Start()
+
+	var executed atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				l.Post(countCommand{&executed})
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		l.Stop()
+	}()
+	wg.Wait()
+	l.AwaitFinish()
+
+	if !l.Stopped() {
+		t.Error("loop isn't stopped after Stop")
+	}
+	if n := executed.Load(); n > 400 {
+		t.Errorf("executed %d commands, want at most 400", n)
+	}
+}
+
+func TestPrintToOutput(t *testing.T) {
+	var out bytes.Buffer
+	l := NewEventLoop(WithOutput(&out))
+	l.Start()
+	for _, line := range []string{"print first", "print second", "print 3"} {
+		cmd, err := Parse(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		l.Post(cmd)
+	}
+	l.AwaitFinish()
+
+	if got, want := out.String(), "first\nsecond\n3\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
+
+func TestContextCancellation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var out, errs syncBuffer
+	l := newTestLoop(&out, &errs, WithContext(ctx))
+	l.Start()
+	for i := 0; i < 100; i++ {
+		l.Post(&sleepCommand{d: 50 * time.Millisecond})
+	}
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+
+	if err := l.AwaitFinishTimeout(time.Second); err != nil {
+		t.Fatalf("AwaitFinish after cancelling the context: %v", err)
+	}
+	if !l.Stopped() {
+		t.Error("loop isn't stopped after cancelling its context")
+	}
+	if n := l.Stats().Executed; n >= 100 {
+		t.Errorf("executed all %d commands despite the cancellation", n)
+	}
+}
+
+// mustParse parses line with the built-in commands.
+func mustParse(t *testing.T, line string) Command {
+	t.Helper()
+
+	cmd, err := Parse(line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cmd
+}
+
+func TestStopAndDrainRunsQueued(t *testing.T) {
+	var out, errs syncBuffer
+	l := newTestLoop(&out, &errs)
+	l.Post(mustParse(t, "add 2 3"))
+	l.Start()
+	l.StopAndDrain()
+	l.AwaitFinish()
+
+	if got := out.String(); got != "5\n" {
+		t.Errorf("output = %q, want the sum printed", got)
+	}
+}
+
+func TestAwaitFinishAfterStop(t *testing.T) {
+	var out, errs syncBuffer
+	l := newTestLoop(&out, &errs)
+	l.Start()
+	l.Stop()
+	if err := l.AwaitFinishTimeout(time.Second); err != nil {
+		t.Fatalf("AwaitFinish after Stop: %v", err)
+	}
+}
+
+func TestDoubleAwaitFinish(t *testing.T) {
+	var out, errs syncBuffer
+	l := newTestLoop(&out, &errs)
+	l.Start()
+	l.Post(mustParse(t, "print a"))
+	for i := 0; i < 2; i++ {
+		if err := l.AwaitFinishTimeout(time.Second); err != nil {
+			t.Fatalf("AwaitFinish #%d: %v", i+1, err)
+		}
+	}
+	if got := out.String(); got != "a\n" {
+		t.Errorf("output = %q, want %q", got, "a\n")
+	}
+}
+
+func TestRestart(t *testing.T) {
+	var out, errs syncBuffer
+	l := newTestLoop(&out, &errs)
+	l.Start()
+	l.Post(mustParse(t, "print first"))
+	l.AwaitFinish()
+
+	l.Start()
+	l.Post(mustParse(t, "print second"))
+	l.AwaitFinish()
+
+	if got, want := out.String(), "first\nsecond\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
+
+func TestTryPostFullQueue(t *testing.T) {
+	var out, errs syncBuffer
+	l := newTestLoop(&out, &errs, WithMaxSize(3))
+	for i := 0; i < 3; i++ {
+		if !l.TryPost(mustParse(t, "nop")) {
+			t.Fatalf("TryPost #%d rejected below capacity", i+1)
+		}
+	}
+	if l.TryPost(mustParse(t, "nop")) {
+		t.Error("TryPost accepted a command into a full queue")
+	}
+	l.Start()
+	l.AwaitFinish()
+	if n := l.Stats().Executed; n != 3 {
+		t.Errorf("executed %d commands, want 3", n)
+	}
+}
+
+func TestTryPostAfterStop(t *testing.T) {
+	var out, errs syncBuffer
+	l := newTestLoop(&out, &errs)
+	l.Start()
+	if !l.TryPost(mustParse(t, "print before")) {
+		t.Error("TryPost rejected a command posted to a running loop")
+	}
+	l.AwaitFinish()
+	if l.TryPost(mustParse(t, "print after")) {
+		t.Error("TryPost accepted a command posted to a stopped loop")
+	}
+	if got, want := out.String(), "before\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+	if n := l.QueueLen(); n != 0 {
+		t.Errorf("QueueLen = %d after a rejected TryPost, want 0", n)
+	}
+}
+
+func TestPostWithResult(t *testing.T) {
+	var out, errs syncBuffer
+	l := newTestLoop(&out, &errs)
+	l.Start()
+	defer l.AwaitFinish()
+
+	results := l.PostWithResult(mustParse(t, "add 2 3"))
+	if sum, ok := <-results; !ok || sum != int64(5) {
+		t.Errorf("result = %v (%T), %v, want 5", sum, sum, ok)
+	}
+	if _, ok := <-results; ok {
+		t.Error("results channel not closed after the result")
+	}
+
+	if val, ok := <-l.PostWithResult(mustParse(t, "print x")); ok {
+		t.Errorf("print yielded result %v, want none", val)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	var counted atomic.Int64
+	counting := func(cmd Command, next func()) {
+		if !isInternal(cmd) {
+			counted.Add(1)
+		}
+		next()
+	}
+	skipping := func(cmd Command, next func()) {
+		if p, ok := cmd.(*printCommand); ok && p.arg == "skipped" {
+			return
+		}
+		next()
+	}
+
+	var out, errs syncBuffer
+	l := newTestLoop(&out, &errs, WithMiddleware(counting, skipping))
+	l.Start()
+	for _, line := range []string{"print a", "print skipped", "print b"} {
+		l.Post(mustParse(t, line))
+	}
+	l.AwaitFinish()
+	if got, want := out.String(), "a\nb\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+	if n := counted.Load(); n != 3 {
+		t.Errorf("counting middleware saw %d commands, want 3", n)
+	}
+}
+
+// panicCommand panics when executed.
+type panicCommand struct{}
+
+func (panicCommand) Execute(handler Handler) {
+	panic("boom")
+}
+
+func TestPanicRecovered(t *testing.T) {
+	var out, errs syncBuffer
+	l := newTestLoop(&out, &errs)
+	l.Start()
+	l.Post(mustParse(t, "print before"))
+	l.Post(panicCommand{})
+	l.Post(mustParse(t, "print after"))
+	l.AwaitFinish()
+
+	if got, want := out.String(), "before\nafter\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+	if got, want := errs.String(), fmt.Sprintf(PanicError, "panic", "boom"); got != want {
+		t.Errorf("errors = %q, want %q", got, want)
+	}
+}
+
+func TestPanicNotRecovered(t *testing.T) {
+	var out, errs syncBuffer
+	l := newTestLoop(&out, &errs, WithRecover(false))
+	defer func() {
+		if r := recover(); r != "boom" {
+			t.Errorf("recovered %v, want the command's panic to surface", r)
+		}
+	}()
+	l.execute(panicCommand{})
+}
+
+func TestWorkers(t *testing.T) {
+	for _, ordered := range []bool{false, true} {
+		t.Run(fmt.Sprintf("ordered=%v", ordered), func(t *testing.T) {
+			var executed atomic.Int64
+			var out, errs syncBuffer
+			l := newTestLoop(&out, &errs, WithWorkers(4, ordered))
+			l.Start()
+			for i := 0; i < 1000; i++ {
+				l.Post(countCommand{&executed})
+			}
+			l.AwaitFinish()
+			if n := executed.Load(); n != 1000 {
+				t.Errorf("executed %d commands with 4 workers, want 1000", n)
+			}
+		})
+	}
+}
+
+// markCommand sleeps, then appends its name to a log.
+type markCommand struct {
+	name  string
+	sleep time.Duration
+	log   *markLog
+}
+
+type markLog struct {
+	mu    sync.Mutex
+	names []string
+}
+
+func (m markCommand) Execute(handler Handler) {
+	time.Sleep(m.sleep)
+	m.log.mu.Lock()
+	defer m.log.mu.Unlock()
+
+	m.log.names = append(m.log.names, m.name)
+}
+
+func TestBarrier(t *testing.T) {
+	// A single worker runs commands in order with or without it.
+	checkOutput(t, "print a\nbarrier\nprint b", "a\nb\n", "")
+
+	var out, errs syncBuffer
+	var log markLog
+	l := newTestLoop(&out, &errs, WithWorkers(4, false))
+	l.Start()
+	for i := range 3 {
+		l.Post(markCommand{name: "before", sleep: time.Duration(30-10*i) * time.Millisecond, log: &log})
+	}
+	l.Post(mustParse(t, "barrier"))
+	for range 3 {
+		l.Post(markCommand{name: "after", log: &log})
+	}
+	l.AwaitFinish()
+
+	want := []string{"before", "before", "before", "after", "after", "after"}
+	if !slices.Equal(log.names, want) {
+		t.Errorf("executed %v, want every command before the barrier first", log.names)
+	}
+}
+
+func TestWait(t *testing.T) {
+	var out, errs syncBuffer
+	var log markLog
+	l := newTestLoop(&out, &errs, WithWorkers(4, false))
+	l.Start()
+	defer l.AwaitFinish()
+	for range 4 {
+		l.Post(markCommand{name: "slow", sleep: 20 * time.Millisecond, log: &log})
+	}
+	l.Wait()
+	log.mu.Lock()
+	n := len(log.names)
+	log.mu.Unlock()
+	if n != 4 {
+		t.Errorf("%d commands executed when Wait returned, want 4", n)
+	}
+}
+
+func TestQueueInspection(t *testing.T) {
+	var out, errs syncBuffer
+	l := newTestLoop(&out, &errs)
+	for _, line := range []string{"print a", "add 1 2", "sleep 1"} {
+		l.Post(mustParse(t, line))
+	}
+	if n := l.QueueLen(); n != 3 {
+		t.Errorf("QueueLen() = %d, want 3", n)
+	}
+	if got, want := l.QueueSnapshot(), []string{"print", "add", "sleep"}; !slices.Equal(got, want) {
+		t.Errorf("QueueSnapshot() = %v, want %v", got, want)
+	}
+	if n := l.QueueLen(); n != 3 {
+		t.Errorf("QueueLen() = %d after the snapshot, want 3", n)
+	}
+	l.Start()
+	l.AwaitFinish()
+	if n := l.QueueLen(); n != 0 {
+		t.Errorf("QueueLen() = %d once finished, want 0", n)
+	}
+}
+
+func TestPauseResume(t *testing.T) {
+	var executed atomic.Int64
+	var out, errs syncBuffer
+	l := newTestLoop(&out, &errs)
+	l.Start()
+	l.Pause()
+	for i := 0; i < 5; i++ {
+		l.Post(countCommand{&executed})
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := executed.Load(); n != 0 {
+		t.Fatalf("executed %d commands while paused", n)
+	}
+	if n := l.QueueLen(); n != 5 {
+		t.Errorf("QueueLen() = %d while paused, want 5", n)
+	}
+
+	l.Resume()
+	l.AwaitFinish()
+	if n := executed.Load(); n != 5 {
+		t.Errorf("executed %d commands after Resume, want 5", n)
+	}
+}
+
+func TestAwaitFinishTimeout(t *testing.T) {
+	var out, errs syncBuffer
+	l := newTestLoop(&out, &errs)
+	l.Start()
+	l.Post(&sleepCommand{d: 300 * time.Millisecond})
+
+	start := time.Now()
+	if err := l.AwaitFinishTimeout(50 * time.Millisecond); err != ErrTimeout {
+		t.Errorf("AwaitFinishTimeout = %v during a blocking command, want ErrTimeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 250*time.Millisecond {
+		t.Errorf("AwaitFinishTimeout took %v, want about 50ms", elapsed)
+	}
+	if err := l.AwaitFinishTimeout(time.Second); err != nil {
+		t.Errorf("waiting again: %v", err)
+	}
+}
+
+func TestTimings(t *testing.T) {
+	var timings syncBuffer
+	runScript(t, "print a\nadd 1 2\nsub 3 1", WithTimings(&timings))
+
+	lines := strings.Split(strings.TrimSuffix(timings.String(), "\n"), "\n")
+	want := []string{"print", "add", "sub", "print", "print"}
+	if len(lines) != len(want) {
+		t.Fatalf("timings = %q, want a line per command", timings.String())
+	}
+	for i, line := range lines {
+		name, d, ok := strings.Cut(line, " ")
+		if !ok || name != "["+want[i]+"]" {
+			t.Errorf("timing line %d = %q, want one for %s", i+1, line, want[i])
+			continue
+		}
+		if _, err := time.ParseDuration(d); err != nil {
+			t.Errorf("timing line %d = %q: %v", i+1, line, err)
+		}
+	}
+}
+
+func TestDedupe(t *testing.T) {
+	script := "print a\nprint a\nprint b\nprint a\nprint b\nprint b"
+	tests := []struct {
+		dedupe bool
+		want   string
+	}{
+		{false, "a\na\nb\na\nb\nb\n"},
+		{true, "a\nb\na\nb\n"},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("dedupe=%v", tt.dedupe), func(t *testing.T) {
+			var out, errs syncBuffer
+			l := newTestLoop(&out, &errs, WithDedupe(tt.dedupe))
+			for _, line := range strings.Split(script, "\n") {
+				l.Post(mustParse(t, line))
+			}
+			l.Start()
+			l.AwaitFinish()
+			if got := out.String(); got != tt.want {
+				t.Errorf("output = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// countingWriter counts the writes reaching the underlying writer.
+type countingWriter struct {
+	syncBuffer
+	writes atomic.Int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.writes.Add(1)
+	return w.syncBuffer.Write(p)
+}
+
+func TestBufferedOutput(t *testing.T) {
+	const n = 1000
+	script := strings.TrimSuffix(strings.Repeat("print line\n", n), "\n")
+
+	run := func(buffered bool) (string, int64) {
+		var out countingWriter
+		l := NewEventLoop(WithOutput(&out), WithBufferedOutput(buffered))
+		l.Start()
+		postScript(t, l, script)
+		l.AwaitFinish()
+		return out.String(), out.writes.Load()
+	}
+
+	unbuffered, unbufferedWrites := run(false)
+	buffered, bufferedWrites := run(true)
+	if want := strings.Repeat("line\n", n); unbuffered != want || buffered != want {
+		t.Errorf("got %d bytes unbuffered and %d buffered, want %d both times, flushed before AwaitFinish returned",
+			len(unbuffered), len(buffered), len(want))
+	}
+	if bufferedWrites >= unbufferedWrites {
+		t.Errorf("%d writes buffered, %d unbuffered, want fewer buffered", bufferedWrites, unbufferedWrites)
+	}
+}
+
+// probeCommand records what out holds when it executes.
+type probeCommand struct {
+	out  *syncBuffer
+	seen *[]string
+}
+
+func (p probeCommand) Execute(handler Handler) {
+	*p.seen = append(*p.seen, p.out.String())
+}
+
+func TestFlush(t *testing.T) {
+	var out syncBuffer
+	var seen []string
+	l := NewEventLoop(WithOutput(&out), WithBufferedOutput(true))
+	probe := probeCommand{out: &out, seen: &seen}
+	// Everything is queued up front, so the loop has no idle moment to flush
+	// in until the end.
+	for _, cmd := range []Command{
+		mustParse(t, "print a"), probe,
+		mustParse(t, "flush"), probe,
+		mustParse(t, "print b"), mustParse(t, "sleep 1"), probe,
+		mustParse(t, "print c"), probe,
+	} {
+		l.Post(cmd)
+	}
+	l.Start()
+	l.AwaitFinish()
+
+	want := []string{"", "a\n", "a\nb\n", "a\nb\n"}
+	if !slices.Equal(seen, want) {
+		t.Errorf("output seen by the commands = %q, want %q", seen, want)
+	}
+	if got := out.String(); got != "a\nb\nc\n" {
+		t.Errorf("output = %q, want it all flushed by AwaitFinish", got)
+	}
+}
+
+// bufferedPrints is the number of prints of every iteration of
+// BenchmarkBufferedOutput.
+const bufferedPrints = 100_000
+
+func BenchmarkBufferedOutput(b *testing.B) {
+	cmds := make([]Command, bufferedPrints)
+	for i := range cmds {
+		cmds[i] = &printCommand{arg: "line"}
+	}
+	prog, err := NewProgram(cmds)
+	if err != nil {
+		b.Fatal(err)
+	}
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer devNull.Close()
+
+	for _, buffered := range []bool{false, true} {
+		b.Run(fmt.Sprintf("buffered=%v", buffered), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				l := NewEventLoop(WithOutput(devNull), WithBufferedOutput(buffered))
+				l.Start()
+				prog.PostTo(l)
+				l.AwaitFinish()
+			}
+		})
+	}
+}
+
+// repostCommand counts its executions and posts itself again.
+type repostCommand struct {
+	n *atomic.Int64
+}
+
+func (r repostCommand) Execute(handler Handler) {
+	r.n.Add(1)
+	handler.Post(r)
+}
+
+func TestMaxCommands(t *testing.T) {
+	var out, errs syncBuffer
+	var n atomic.Int64
+	l := newTestLoop(&out, &errs, WithMaxCommands(10))
+	l.Start()
+	l.Post(repostCommand{&n})
+	l.AwaitFinish()
+	if got := n.Load(); got != 10 {
+		t.Errorf("executed %d times, want the limit of 10", got)
+	}
+	if got, want := errs.String(), fmt.Sprintf(CommandLimitError, 10); got != want {
+		t.Errorf("errors = %q, want %q", got, want)
+	}
+
+	// The prints of results count too: the four adds run first, leaving room
+	// for two of their prints.
+	out2, errs2 := runScript(t, "add 1 1\nadd 2 2\nadd 3 3\nadd 4 4", WithMaxCommands(6))
+	if out2 != "2\n4\n" || errs2 != fmt.Sprintf(CommandLimitError, 6) {
+		t.Errorf("got %q, errors %q, want two sums and the limit reported", out2, errs2)
+	}
+}
+
+// checkNoLeak fails t unless the number of goroutines gets back to before
+// within a second, once it has finished with a loop.
+func checkNoLeak(t *testing.T, before int) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		buf := make([]byte, 1<<16)
+		t.Errorf("%d goroutines left running, %d before:\n%s", n, before, buf[:runtime.Stack(buf, true)])
+	}
+}
+
+func TestNoGoroutinesLeft(t *testing.T) {
+	finishes := []struct {
+		name   string
+		finish func(t *testing.T)
+	}{
+		{"AwaitFinish", func(t *testing.T) {
+			l := newTestLoop(&syncBuffer{}, &syncBuffer{}, WithWorkers(4, false))
+			l.Start()
+			postScript(t, l, "print a\nadd 1 2\nafter 5 print late")
+			l.AwaitFinish()
+		}},
+		{"Stop", func(t *testing.T) {
+			l := newTestLoop(&syncBuffer{}, &syncBuffer{}, WithIdleTimeout(time.Hour))
+			l.Start()
+			postScript(t, l, "sleep 10\nafter 10000 print late\nprint a")
+			l.Stop()
+			l.AwaitFinish()
+		}},
+		{"context", func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			l := newTestLoop(&syncBuffer{}, &syncBuffer{}, WithContext(ctx), WithRate(10))
+			l.Start()
+			postScript(t, l, "print a\nprint b\nprint c")
+			cancel()
+			<-l.Done()
+		}},
+		{"idle timeout", func(t *testing.T) {
+			l := newTestLoop(&syncBuffer{}, &syncBuffer{}, WithIdleTimeout(10*time.Millisecond))
+			l.Start()
+			<-l.Done()
+		}},
+		{"abandoned by timeout", func(t *testing.T) {
+			l := newTestLoop(&syncBuffer{}, &syncBuffer{})
+			l.Start()
+			postScript(t, l, "timeout 10 sleep 50")
+			l.AwaitFinish()
+		}},
+	}
+	for _, f := range finishes {
+		t.Run(f.name, func(t *testing.T) {
+			before := runtime.NumGoroutine()
+			for range 20 {
+				f.finish(t)
+			}
+			checkNoLeak(t, before)
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package eventloop
+
+import (
+	"fmt"
+	"sync"
+)
+
+const UndefinedMacroError string = "error: macro %v is not defined"
+const CallDepthError string = "error: call %v: macros nested deeper than %v"
+
+// MaxCallDepth is how deeply calls may nest, counting the calls made from
+// the body of a macro, so that a macro calling itself stops eventually.
+const MaxCallDepth = 64
+
+// MARK: - Macros
+
+// macros holds the bodies defined by def. It is safe for concurrent use.
+type macros struct {
+	bodies map[string][]Command
+	mu     sync.RWMutex
+}
+
+func newMacros() *macros {
+	return &macros{bodies: make(map[string][]Command)}
+}
+
+func (m *macros) define(name string, body []Command) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.bodies[name] = body
+}
+
+func (m *macros) lookup(name string) ([]Command, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	body, ok := m.bodies[name]
+	return body, ok
+}
+
+// defCommand defines a macro when it executes, replacing any previous macro
+// of the same name. Its body was parsed along with the rest of the file.
+type defCommand struct {
+	name string
+	body []Command
+}
+
+func (d *defCommand) attrs() []any {
+	return []any{"name", d.name, "commands", len(d.body)}
+}
+
+func (d *defCommand) Execute(handler Handler) {
+	if h, ok := findHandler[workerHandler](handler); ok {
+		h.macros.define(d.name, d.body)
+	}
+}
+
+// callHandler marks the commands run by a call, to count nested calls.
+type callHandler struct {
+	Handler
+	depth int
+}
+
+func (h *callHandler) unwrap() Handler {
+	return h.Handler
+}
+
+// callCommand executes the commands of a macro in place, like repeat, so they
+// are done before the command after the call. It stops early if one of them
+// stops the loop.
+type callCommand struct {
+	name string
+}
+
+func (c *callCommand) attrs() []any {
+	return []any{"name", c.name}
+}
+
+func (c *callCommand) Execute(handler Handler) {
+	h, ok := findHandler[workerHandler](handler)
+	if !ok {
+		return
+	}
+	body, ok := h.macros.lookup(c.name)
+	if !ok {
+		handler.Post(&errorCommand{msg: fmt.Sprintf(UndefinedMacroError, c.name)})
+		return
+	}
+	depth := 1
+	if outer, ok := findHandler[*callHandler](handler); ok {
+		depth = outer.depth + 1
+	}
+	if depth > MaxCallDepth {
+		handler.Post(&errorCommand{msg: fmt.Sprintf(CallDepthError, c.name, MaxCallDepth)})
+		return
+	}
+	inner := &callHandler{Handler: handler, depth: depth}
+	for _, cmd := range body {
+		if h.Stopped() {
+			return
+		}
+		cmd.Execute(inner)
+	}
+}
+
+func parseDef(args []string) (func(body []Command) Command, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "def")
+	}
+	name := args[0]
+	return func(body []Command) Command {
+		return &defCommand{name: name, body: body}
+	}, nil
+}
+
+func parseCall(args []string) (Command, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "call")
+	}
+	return &callCommand{name: args[0]}, nil
+}
@@ -0,0 +1,28 @@
+package eventloop
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestMacro(t *testing.T) {
+	script := "def greet\nprint hello\nprint world\nenddef\ncall greet\ncall greet\nprint end"
+	checkOutput(t, script, "hello\nworld\nhello\nworld\nend\n", "")
+
+	// The body is executed on call, not when it is defined.
+	checkOutput(t, "def show\nget x\nenddef\nset x 1\ncall show\nset x 2\ncall show", "1\n2\n", "")
+}
+
+func TestMacroUndefined(t *testing.T) {
+	checkOutput(t, "call nope\nprint after", "after\n", "line 1: "+fmt.Sprintf(UndefinedMacroError, "nope")+"\n")
+}
+
+func TestMacroRecursionLimit(t *testing.T) {
+	out, errs := runScript(t, "def r\ninc n\ncall r\nenddef\nset n 0\ncall r\nprint after\nget n")
+	if want := "line 6: " + fmt.Sprintf(CallDepthError, "r", MaxCallDepth) + "\n"; errs != want {
+		t.Errorf("errors = %q, want %q", errs, want)
+	}
+	if want := fmt.Sprintf("after\n%d\n", MaxCallDepth); out != want {
+		t.Errorf("output = %q, want %q", out, want)
+	}
+}
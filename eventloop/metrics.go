@@ -0,0 +1,148 @@
+package eventloop
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MARK: - Stats
+
+// LatencyBuckets are the upper bounds of the execution time histogram kept
+// for every command type.
+var LatencyBuckets = [...]time.Duration{
+	10 * time.Microsecond,
+	100 * time.Microsecond,
+	time.Millisecond,
+	10 * time.Millisecond,
+	100 * time.Millisecond,
+	time.Second,
+	10 * time.Second,
+}
+
+// CommandStats describes the executions of one command type. Latency[i]
+// counts the executions that took at most LatencyBuckets[i] but longer than
+// the previous bound; the last element counts those slower than every bound.
+// In JSON, Duration is a whole number of nanoseconds.
+type CommandStats struct {
+	Executed int                          `json:"executed"`
+	Duration time.Duration                `json:"durationNs"`
+	Latency  [len(LatencyBuckets) + 1]int `json:"latency"`
+}
+
+// Stats is a snapshot of the loop's execution metrics. Commands is keyed by
+// command name, e.g. "add" for the built-in addCommand. PeakDepth is the
+// largest number of commands queued at once. In JSON, Duration is a whole
+// number of nanoseconds, like that of CommandStats.
+type Stats struct {
+	Executed  int                     `json:"executed"`
+	Duration  time.Duration           `json:"durationNs"`
+	PeakDepth int                     `json:"peakDepth"`
+	Commands  map[string]CommandStats `json:"commands"`
+}
+
+type metrics struct {
+	stats Stats
+	mu    sync.Mutex
+}
+
+func newMetrics() *metrics {
+	m := &metrics{}
+	m.reset()
+	return m
+}
+
+func (m *metrics) record(name string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.stats.Executed++
+	m.stats.Duration += d
+	cs := m.stats.Commands[name]
+	cs.Executed++
+	cs.Duration += d
+	i := 0
+	for i < len(LatencyBuckets) && d > LatencyBuckets[i] {
+		i++
+	}
+	cs.Latency[i]++
+	m.stats.Commands[name] = cs
+}
+
+func (m *metrics) snapshot() Stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := m.stats
+	stats.Commands = make(map[string]CommandStats, len(m.stats.Commands))
+	for name, cs := range m.stats.Commands {
+		stats.Commands[name] = cs
+	}
+	return stats
+}
+
+func (m *metrics) reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.stats = Stats{Commands: make(map[string]CommandStats)}
+}
+
+// statsCommand prints the loop's Stats as a JSON object, in the form served
+// at GET /stats, with the commands sorted by name. The stats command itself is
+// counted once it has finished, so it isn't in its own output.
+type statsCommand struct{}
+
+func (s *statsCommand) Execute(handler Handler) {
+	h, ok := findHandler[workerHandler](handler)
+	if !ok {
+		return
+	}
+	stats := h.Stats()
+	out, err := json.Marshal(stats)
+	if err != nil {
+		handler.Post(&errorCommand{msg: err.Error()})
+		return
+	}
+	returnResult(handler, stats)
+	handler.Post(&printCommand{arg: string(out)})
+}
+
+// commandName derives a command's name from its type: *addCommand is "add".
+// A program step is named after the instruction it executes.
+func commandName(cmd Command) string {
+	switch c := cmd.(type) {
+	case *resultCommand:
+		return commandName(c.cmd)
+	case *fileCommand:
+		return commandName(c.cmd)
+	case *postedCommand:
+		return commandName(c.cmd)
+	case *programCommand:
+		if c.ip < len(c.prog.cmds) {
+			return commandName(c.prog.cmds[c.ip])
+		}
+	case *textCommand:
+		return c.op
+	case *logicCommand:
+		return c.op
+	case *evalCommandsCommand:
+		return "eval-commands"
+	}
+	t := reflect.TypeOf(cmd)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return strings.TrimSuffix(t.Name(), "Command")
+}
+
+// isInternal reports whether cmd is loop bookkeeping rather than user work.
+func isInternal(cmd Command) bool {
+	switch cmd.(type) {
+	case *stopCommand, *waitCommand:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,138 @@
+package eventloop
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	var out, errs syncBuffer
+	l := newTestLoop(&out, &errs)
+	l.Start()
+	postScript(t, l, "add 1 2\nadd 3 4\ndiv 1 0\nprint a")
+	l.AwaitFinish()
+
+	stats := l.Stats()
+	want := map[string]int{"add": 2, "div": 1, "print": 3, "error": 1}
+	for name, n := range want {
+		if got := stats.Commands[name].Executed; got != n {
+			t.Errorf("%s executed %d times, want %d", name, got, n)
+		}
+		if stats.Commands[name].Duration <= 0 {
+			t.Errorf("%s took %v, want a positive duration", name, stats.Commands[name].Duration)
+		}
+	}
+	if stats.Executed != 7 {
+		t.Errorf("executed %d commands, want 7", stats.Executed)
+	}
+	if stats.Duration <= 0 {
+		t.Errorf("total duration %v, want a positive one", stats.Duration)
+	}
+	if n := l.ErrorCount(); n != 1 {
+		t.Errorf("error count = %d, want 1", n)
+	}
+}
+
+func TestStatsCommand(t *testing.T) {
+	out, errs := runScript(t, "print a\nadd 1 2\nadd 3 4\nnop\nstats")
+	if errs != "" {
+		t.Fatalf("errors = %q", errs)
+	}
+	// The sums print behind stats, which prints behind them in turn.
+	lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+	if len(lines) != 4 || !slices.Equal(lines[:3], []string{"a", "3", "7"}) {
+		t.Fatalf("output = %q, want the prints, then the stats", out)
+	}
+	var stats Stats
+	if err := json.Unmarshal([]byte(lines[3]), &stats); err != nil {
+		t.Fatalf("stats printed %q: %v", lines[3], err)
+	}
+	if stats.Executed != 4 {
+		t.Errorf("executed = %d, want the 4 commands before stats", stats.Executed)
+	}
+	for name, n := range map[string]int{"add": 2, "nop": 1, "print": 1} {
+		if got := stats.Commands[name].Executed; got != n {
+			t.Errorf("%s executed %d times, want %d", name, got, n)
+		}
+	}
+	// Commands are keyed in sorted order.
+	if i, j, k := strings.Index(lines[3], `"add"`), strings.Index(lines[3], `"nop"`), strings.Index(lines[3], `"print"`); !(i < j && j < k) {
+		t.Errorf("commands out of order in %s", lines[3])
+	}
+}
+
+func TestPeakDepth(t *testing.T) {
+	var out, errs syncBuffer
+	var n atomic.Int64
+	l := newTestLoop(&out, &errs)
+	for range 5 {
+		l.Post(countCommand{&n})
+	}
+	l.Start()
+	l.Post(countCommand{&n})
+	l.AwaitFinish()
+
+	if got := l.Stats().PeakDepth; got < 5 {
+		t.Errorf("peak depth = %d, want at least 5", got)
+	}
+	if got := n.Load(); got != 6 {
+		t.Errorf("executed %d commands, want 6", got)
+	}
+}
+
+func TestPeakDepthConcurrent(t *testing.T) {
+	var out, errs syncBuffer
+	var n atomic.Int64
+	l := newTestLoop(&out, &errs)
+
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 25 {
+				l.Post(countCommand{&n})
+			}
+		}()
+	}
+	wg.Wait()
+	l.Start()
+	l.AwaitFinish()
+
+	if got := n.Load(); got != 100 {
+		t.Errorf("executed %d commands, want 100", got)
+	}
+	if got := l.Stats().PeakDepth; got < 100 {
+		t.Errorf("peak depth = %d, want at least 100", got)
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	var out, errs syncBuffer
+	var n atomic.Int64
+	l := newTestLoop(&out, &errs, WithMaxDepth(3))
+	for range 5 {
+		l.Post(countCommand{&n})
+	}
+	if l.TryPost(countCommand{&n}) {
+		t.Error("TryPost on a full queue succeeded")
+	}
+	l.Start()
+	l.AwaitFinish()
+
+	if got := n.Load(); got != 3 {
+		t.Errorf("executed %d commands, want 3", got)
+	}
+	want := strings.Repeat(fmt.Sprintf(QueueDepthError, 3, "count"), 2)
+	if got := errs.String(); got != want {
+		t.Errorf("errors = %q, want %q", got, want)
+	}
+	if got := l.Stats().PeakDepth; got < 3 {
+		t.Errorf("peak depth = %d, want at least 3", got)
+	}
+}
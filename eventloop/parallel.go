@@ -0,0 +1,104 @@
+package eventloop
+
+import (
+	"fmt"
+	"sync"
+)
+
+// MARK: - Parallel
+
+// parallelSeparator separates the commands of a parallel on one line.
+const parallelSeparator = ";"
+
+// parallelCommand executes the commands of a parallel ... endparallel block,
+// or of a parallel <cmd1> ; <cmd2> ; ... line, in place, each on a goroutine
+// of its own, and returns once all of them have finished, so the commands
+// queued behind the block run after the whole of it. The commands share the
+// loop's variables and output, which are safe for concurrent use, but the
+// order they run and print in is unspecified; to give one of them several
+// steps, define them as a macro and call it. A panic of a command is raised
+// again on the worker once all have finished, as if it had run there.
+type parallelCommand struct {
+	cmds []Command
+}
+
+func (p *parallelCommand) attrs() []any {
+	return []any{"commands", len(p.cmds)}
+}
+
+func (p *parallelCommand) Execute(handler Handler) {
+	var wg sync.WaitGroup
+	panics := make([]any, len(p.cmds))
+	for i, cmd := range p.cmds {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				panics[i] = recover()
+			}()
+			cmd.Execute(handler)
+		}()
+	}
+	wg.Wait()
+	for _, r := range panics {
+		if r != nil {
+			panic(r)
+		}
+	}
+}
+
+// parseParallelLine parses the commands of a parallel on one line wrapped in
+// another command, as in repeat 2 parallel a ; b. The quotes of its fields
+// are gone by then, so every field holding just parallelSeparator separates
+// two commands; an instruction starting with parallel is parsed by
+// parseParallelFields instead, which leaves a quoted one alone.
+func (r *Registry) parseParallelLine(args []string) (Command, error) {
+	var seps []int
+	for i, arg := range args {
+		if arg == parallelSeparator {
+			seps = append(seps, i)
+		}
+	}
+	return r.parseParallelFields(args, seps)
+}
+
+// parseParallelFields parses the commands of a parallel on one line, args
+// being split into them at the indexes in seps.
+func (r *Registry) parseParallelFields(args []string, seps []int) (Command, error) {
+	var cmds []Command
+	for i, start := 0, 0; i <= len(seps); i++ {
+		end := len(args)
+		if i < len(seps) {
+			end = seps[i]
+		}
+		fields := args[start:end]
+		start = end + 1
+		if len(fields) == 0 {
+			return nil, fmt.Errorf(AmbiguousArgsNumberError, "parallel")
+		}
+		cmd, err := r.parseFields(fields)
+		if err != nil {
+			return nil, err
+		}
+		cmds = append(cmds, cmd)
+	}
+	return &parallelCommand{cmds: cmds}, nil
+}
+
+// isParallel reports whether the command called name is parallel, possibly
+// under an alias.
+func (r *Registry) isParallel(name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.resolveLocked(name) == "parallel"
+}
+
+func parseParallel(args []string) (func(body []Command) Command, error) {
+	if len(args) != 0 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "parallel")
+	}
+	return func(body []Command) Command {
+		return &parallelCommand{cmds: body}
+	}, nil
+}
@@ -0,0 +1,63 @@
+package eventloop
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sleepThenPrint defines macros a and b, each sleeping parallelSleep and
+// then printing its name.
+const sleepThenPrint = "def a\nsleep 50\nprint a\nenddef\ndef b\nsleep 50\nprint b\nenddef\n"
+
+// parallelSleep is how long every macro of sleepThenPrint sleeps.
+const parallelSleep = 50 * time.Millisecond
+
+func TestParallel(t *testing.T) {
+	for name, script := range map[string]string{
+		"line":  "parallel call a ; call b\nprint done",
+		"block": "parallel\ncall a\ncall b\nendparallel\nprint done",
+	} {
+		t.Run(name, func(t *testing.T) {
+			start := time.Now()
+			out, errs := runScript(t, sleepThenPrint+script)
+			if d := time.Since(start); d >= 2*parallelSleep {
+				t.Errorf("took %v, want less than the %v of running them one after the other", d, 2*parallelSleep)
+			}
+			if errs != "" {
+				t.Errorf("errors = %q, want none", errs)
+			}
+			// The order of a and b is unspecified, but the block joins them
+			// before the commands behind it.
+			lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+			if len(lines) != 3 || lines[2] != "done" || !slices.Contains(lines, "a") || !slices.Contains(lines, "b") {
+				t.Errorf("output = %q, want a and b in any order, then done", out)
+			}
+		})
+	}
+}
+
+func TestParallelSharedVariables(t *testing.T) {
+	checkOutput(t, "set n 0\nparallel addto n 1 ; addto n 2 ; addto n 3 ; addto n 4\nget n", "10\n", "")
+}
+
+func TestParallelQuotedSeparator(t *testing.T) {
+	out, errs := runScript(t, `parallel print ";" ; print "a ; b"`)
+	lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+	if errs != "" || len(lines) != 2 || !slices.Contains(lines, ";") || !slices.Contains(lines, "a ; b") {
+		t.Errorf("output = %q, errors = %q, want the quoted separators printed", out, errs)
+	}
+	checkOutput(t, `parallel print ";"`, ";\n", "")
+}
+
+func TestParallelAlias(t *testing.T) {
+	start := time.Now()
+	out, errs := runScript(t, sleepThenPrint+"alias par parallel\npar call a ; call b\nprint done")
+	if d := time.Since(start); d >= 2*parallelSleep {
+		t.Errorf("took %v, want the alias to run the commands at the same time", d)
+	}
+	if errs != "" || !strings.HasSuffix(out, "done\n") || len(out) != len("a\nb\ndone\n") {
+		t.Errorf("output = %q, errors = %q, want a and b, then done", out, errs)
+	}
+}
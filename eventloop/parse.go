@@ -0,0 +1,475 @@
+package eventloop
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const AmbiguousArgsNumberError string = "SYNTAX ERROR: number of arguments for '%v' is ambiguous"
+const NotNumberError string = "SYNTAX ERROR: '%v' is not a number"
+const UnknownCommandError string = "SYNTAX ERROR: unknown command '%v'"
+const InvalidRepeatCountError string = "SYNTAX ERROR: repeat count '%v' must be between 0 and %v"
+const InvalidForeachRangeError string = "SYNTAX ERROR: foreach range from '%v' to '%v' must hold at most %v integers"
+const InvalidExitCodeError string = "SYNTAX ERROR: exit code '%v' must be between 0 and 255"
+const InvalidRequirementError string = "SYNTAX ERROR: requirement '%v' must be <name>:int, <name>:float or <name>:string"
+const InvalidDurationError string = "SYNTAX ERROR: '%v' is not a valid number of milliseconds"
+
+func isIdentifier(s string) bool {
+	for i, r := range s {
+		if r == '_' || unicode.IsLetter(r) || (i > 0 && unicode.IsDigit(r)) {
+			continue
+		}
+		return false
+	}
+	return s != ""
+}
+
+// parseInt parses a base-10 integer, or a hexadecimal, octal or binary one
+// prefixed with 0x, 0o or 0b. A leading 0 alone doesn't make a number octal.
+func parseInt(arg string) (int64, error) {
+	base := 10
+	digits := strings.TrimLeft(arg, "+-")
+	if len(digits) > 2 && digits[0] == '0' && strings.ContainsRune("xXoObB", rune(digits[1])) {
+		base = 0
+	}
+	val, err := strconv.ParseInt(arg, base, 64)
+	if err != nil {
+		return 0, fmt.Errorf(NotNumberError, arg)
+	}
+	return val, nil
+}
+
+func parseOperand(arg string) (operand, error) {
+	if isIdentifier(arg) {
+		return operand{name: arg}, nil
+	}
+	val, err := parseInt(arg)
+	return operand{val: val}, err
+}
+
+// parseOperands parses the two operands of an arithmetic command.
+func parseOperands(command string, args []string) (operand, operand, error) {
+	if len(args) != 2 {
+		return operand{}, operand{}, fmt.Errorf(AmbiguousArgsNumberError, command)
+	}
+	arg1, err := parseOperand(args[0])
+	if err != nil {
+		return operand{}, operand{}, err
+	}
+	arg2, err := parseOperand(args[1])
+	if err != nil {
+		return operand{}, operand{}, err
+	}
+	return arg1, arg2, nil
+}
+
+// parseOperandList parses any number of operands.
+func parseOperandList(args []string) ([]operand, error) {
+	ops := make([]operand, len(args))
+	for i, arg := range args {
+		o, err := parseOperand(arg)
+		if err != nil {
+			return nil, err
+		}
+		ops[i] = o
+	}
+	return ops, nil
+}
+
+func parseArithmetic(command string, build func(arg1, arg2 operand) Command) ParseFunc {
+	return func(args []string) (Command, error) {
+		arg1, arg2, err := parseOperands(command, args)
+		if err != nil {
+			return nil, err
+		}
+		return build(arg1, arg2), nil
+	}
+}
+
+// parseStoredArithmetic parses "<var> <a> <b>" for a command storing its
+// result in var instead of printing it.
+func parseStoredArithmetic(command string, build func(dest string, arg1, arg2 operand) Command) ParseFunc {
+	return func(args []string) (Command, error) {
+		if len(args) != 3 {
+			return nil, fmt.Errorf(AmbiguousArgsNumberError, command)
+		}
+		arg1, arg2, err := parseOperands(command, args[1:])
+		if err != nil {
+			return nil, err
+		}
+		return build(args[0], arg1, arg2), nil
+	}
+}
+
+func parseNeg(args []string) (Command, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "neg")
+	}
+	arg, err := parseOperand(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return &negCommand{arg: arg}, nil
+}
+
+func parseAdd(args []string) (Command, error) {
+	if len(args) < 2 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "add")
+	}
+	ops, err := parseOperandList(args)
+	if err != nil {
+		return nil, err
+	}
+	return &addCommand{args: ops}, nil
+}
+
+func parseSum(args []string) (Command, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "sum")
+	}
+	ops, err := parseOperandList(args[1:])
+	if err != nil {
+		return nil, err
+	}
+	return &sumCommand{dest: args[0], args: ops}, nil
+}
+
+func parseAbs(args []string) (Command, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "abs")
+	}
+	arg, err := parseOperand(args[1])
+	if err != nil {
+		return nil, err
+	}
+	return &absCommand{dest: args[0], arg: arg}, nil
+}
+
+// parsePrint joins its arguments with single spaces; without any it prints an
+// empty line.
+func parsePrint(args []string) (Command, error) {
+	return &printCommand{arg: strings.Join(args, " "), expand: true}, nil
+}
+
+// parseError joins its arguments like parsePrint, but without expanding
+// variables.
+func parseError(args []string) (Command, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "error")
+	}
+	return &errorCommand{msg: strings.Join(args, " ")}, nil
+}
+
+// parseMillis parses a non-negative duration given in milliseconds.
+func parseMillis(arg string) (time.Duration, error) {
+	ms, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil || ms < 0 {
+		return 0, fmt.Errorf(InvalidDurationError, arg)
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+func parseSleep(args []string) (Command, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "sleep")
+	}
+	d, err := parseMillis(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return &sleepCommand{d: d}, nil
+}
+
+func (r *Registry) parseAfter(args []string) (Command, error) {
+	if len(args) < 2 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "after")
+	}
+	d, err := parseMillis(args[0])
+	if err != nil {
+		return nil, err
+	}
+	cmd, err := r.parseFields(args[1:])
+	if err != nil {
+		return nil, err
+	}
+	return &afterCommand{d: d, cmd: cmd}, nil
+}
+
+// MaxRepeat is the largest count accepted by repeat.
+const MaxRepeat = 1_000_000
+
+func (r *Registry) parseRepeat(args []string) (Command, error) {
+	if len(args) < 2 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "repeat")
+	}
+	n, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil || n < 0 || n > MaxRepeat {
+		return nil, fmt.Errorf(InvalidRepeatCountError, args[0], MaxRepeat)
+	}
+	cmd, err := r.parseFields(args[1:])
+	if err != nil {
+		return nil, err
+	}
+	return &repeatCommand{n: n, cmd: cmd}, nil
+}
+
+// parseForeach accepts ranges of up to MaxRepeat integers, like the counts
+// of repeat.
+func (r *Registry) parseForeach(args []string) (Command, error) {
+	if len(args) < 4 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "foreach")
+	}
+	start, err := parseInt(args[1])
+	if err != nil {
+		return nil, err
+	}
+	end, err := parseInt(args[2])
+	if err != nil {
+		return nil, err
+	}
+	n, ok := checkedSub(max(start, end), min(start, end))
+	if !ok || n >= MaxRepeat {
+		return nil, fmt.Errorf(InvalidForeachRangeError, args[1], args[2], MaxRepeat)
+	}
+	cmd, err := r.parseFields(args[3:])
+	if err != nil {
+		return nil, err
+	}
+	return &foreachCommand{name: args[0], start: start, end: end, cmd: cmd}, nil
+}
+
+func (r *Registry) parseIf(args []string) (Command, error) {
+	cond, err := parseCondition("if", args)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) < 4 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "if")
+	}
+	cmd, err := r.parseFields(args[3:])
+	if err != nil {
+		return nil, err
+	}
+	return &ifCommand{cond: cond, cmd: cmd}, nil
+}
+
+func parseAssert(args []string) (Command, error) {
+	cond, err := parseCondition("assert", args)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) != 3 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "assert")
+	}
+	return &assertCommand{cond: cond}, nil
+}
+
+func parseAssertempty(args []string) (Command, error) {
+	if len(args) != 0 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "assertempty")
+	}
+	return &assertemptyCommand{}, nil
+}
+
+func parseRequire(args []string) (Command, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "require")
+	}
+	cmd := &requireCommand{}
+	for _, arg := range args {
+		name, typ, _ := strings.Cut(arg, ":")
+		if name == "" || !slices.Contains(kindNames[:], typ) {
+			return nil, fmt.Errorf(InvalidRequirementError, arg)
+		}
+		cmd.reqs = append(cmd.reqs, requirement{name: name, typ: typ})
+	}
+	return cmd, nil
+}
+
+func parseStopif(args []string) (Command, error) {
+	cond, err := parseCondition("stopif", args)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) != 3 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "stopif")
+	}
+	return &stopifCommand{cond: cond}, nil
+}
+
+func parseClear(args []string) (Command, error) {
+	if len(args) != 0 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "clear")
+	}
+	return &clearCommand{}, nil
+}
+
+// parseAlias defines the alias as soon as the line is parsed, so that it
+// applies to the lines parsed after it; the command it returns does nothing.
+// r is the scope of the parser reading the line, so the alias is gone once
+// that input is, and other inputs never see it.
+func (r *Registry) parseAlias(args []string) (Command, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "alias")
+	}
+	if err := r.Alias(args[0], args[1]); err != nil {
+		return nil, err
+	}
+	return &aliasCommand{name: args[0], target: args[1]}, nil
+}
+
+func parseCancelscheduled(args []string) (Command, error) {
+	if len(args) != 0 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "cancelscheduled")
+	}
+	return &cancelscheduledCommand{}, nil
+}
+
+func parseNop(args []string) (Command, error) {
+	if len(args) != 0 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "nop")
+	}
+	return &nopCommand{}, nil
+}
+
+func parseBarrier(args []string) (Command, error) {
+	if len(args) != 0 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "barrier")
+	}
+	return &barrierCommand{}, nil
+}
+
+func parseFlush(args []string) (Command, error) {
+	if len(args) != 0 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "flush")
+	}
+	return &flushCommand{}, nil
+}
+
+func parseQdepth(args []string) (Command, error) {
+	if len(args) != 0 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "qdepth")
+	}
+	return &qdepthCommand{}, nil
+}
+
+func parseStats(args []string) (Command, error) {
+	if len(args) != 0 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "stats")
+	}
+	return &statsCommand{}, nil
+}
+
+func parseExit(args []string) (Command, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "exit")
+	}
+	code, err := parseInt(args[0])
+	if err != nil {
+		return nil, err
+	}
+	if code < 0 || code > 255 {
+		return nil, fmt.Errorf(InvalidExitCodeError, args[0])
+	}
+	return &exitCommand{code: int(code)}, nil
+}
+
+// parseSet stores an integer, or a float if the value has a fraction or an
+// exponent, and a string if it isn't a number at all, like a quoted text; a
+// number out of range, like an integer too large for int64, is an error
+// rather than a float or a string.
+func parseSet(args []string) (Command, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "set")
+	}
+	if n, err := parseInt(args[1]); err == nil {
+		return &setCommand{name: args[0], val: IntValue(n)}, nil
+	}
+	f, err := strconv.ParseFloat(args[1], 64)
+	switch {
+	case errors.Is(err, strconv.ErrRange):
+		return nil, fmt.Errorf(NotNumberError, args[1])
+	case err != nil || math.IsInf(f, 0) || math.IsNaN(f):
+		return &setCommand{name: args[0], val: StringValue(args[1])}, nil
+	case !strings.ContainsAny(args[1], ".eEpP"):
+		return nil, fmt.Errorf(NotNumberError, args[1])
+	}
+	return &setCommand{name: args[0], val: FloatValue(f)}, nil
+}
+
+func parseInc(command string, delta int64) ParseFunc {
+	return func(args []string) (Command, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf(AmbiguousArgsNumberError, command)
+		}
+		return &incCommand{name: args[0], delta: delta}, nil
+	}
+}
+
+func parseAddto(args []string) (Command, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "addto")
+	}
+	amount, err := parseOperand(args[1])
+	if err != nil {
+		return nil, err
+	}
+	return &addtoCommand{name: args[0], amount: amount}, nil
+}
+
+func parseConcat(args []string) (Command, error) {
+	if len(args) != 3 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "concat")
+	}
+	return &concatCommand{name: args[0], arg1: args[1], arg2: args[2]}, nil
+}
+
+func parseGet(args []string) (Command, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "get")
+	}
+	return &getCommand{name: args[0]}, nil
+}
+
+func parseUnset(args []string) (Command, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "unset")
+	}
+	return &unsetCommand{name: args[0]}, nil
+}
+
+func parseDumpvars(args []string) (Command, error) {
+	if len(args) != 0 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "dumpvars")
+	}
+	return &dumpvarsCommand{}, nil
+}
+
+func parseCopy(command string, move bool) ParseFunc {
+	return func(args []string) (Command, error) {
+		if len(args) != 2 {
+			return nil, fmt.Errorf(AmbiguousArgsNumberError, command)
+		}
+		return &copyCommand{dest: args[0], src: args[1], move: move}, nil
+	}
+}
+
+func parseLen(args []string) (Command, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "len")
+	}
+	return &lenCommand{dest: args[0], src: args[1]}, nil
+}
+
+func parseSwap(args []string) (Command, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "swap")
+	}
+	return &swapCommand{a: args[0], b: args[1]}, nil
+}
@@ -0,0 +1,45 @@
+package eventloop
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"frob 1", fmt.Sprintf(UnknownCommandError, "frob")},
+		{"add 1", fmt.Sprintf(AmbiguousArgsNumberError, "add")},
+		{"sub 1", fmt.Sprintf(AmbiguousArgsNumberError, "sub")},
+		{"sub 1 2x", fmt.Sprintf(NotNumberError, "2x")},
+		{"mul 1.5 2", fmt.Sprintf(NotNumberError, "1.5")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			cmd, err := Parse(tt.line)
+			if err == nil {
+				t.Fatalf("Parse(%q) = %v, want an error", tt.line, cmd)
+			}
+			if cmd != nil {
+				t.Errorf("Parse(%q) returned %v along with its error", tt.line, cmd)
+			}
+			if err.Error() != tt.want {
+				t.Errorf("Parse(%q) error = %q, want %q", tt.line, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestIntegerLiterals(t *testing.T) {
+	checkOutput(t, "add 0x10 0b101 7", "28\n", "")
+	checkOutput(t, "add 0o17 -0x1 010", "24\n", "")
+	checkOutput(t, "sub 0XfF 0B1", "254\n", "")
+
+	for _, arg := range []string{"0x", "0b2", "0o8", "0xg"} {
+		if _, err := Parse("add 1 " + arg); err == nil {
+			t.Errorf("add 1 %s parsed", arg)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package eventloop
+
+import (
+	"slices"
+	"sync"
+)
+
+// MARK: - Parsers
+
+// Parser turns instruction lines into commands, one line at a time. A blank
+// line, or one that doesn't complete an instruction yet, yields a nil command
+// and a nil error. LineParser is the parser of the built-in instruction
+// language; RegisterParser makes others available by name.
+type Parser interface {
+	Parse(line string) (Command, error)
+}
+
+// parsers holds the parser constructors registered by name.
+var parsers = struct {
+	byName map[string]func() Parser
+	mu     sync.Mutex
+}{byName: map[string]func() Parser{
+	"text": func() Parser { return NewLineParser() },
+	"json": func() Parser { return NewJSONLineParser() },
+}}
+
+// RegisterParser makes newParser available as the parser called name, such
+// as for the -parser flag of the command line tool, replacing any parser
+// registered under name before. "text" and "json" are the LineParsers of
+// NewLineParser and NewJSONLineParser. A parser is used by one goroutine at a
+// time, so newParser is called for every input.
+func RegisterParser(name string, newParser func() Parser) {
+	parsers.mu.Lock()
+	defer parsers.mu.Unlock()
+
+	parsers.byName[name] = newParser
+}
+
+// NewParser returns a new parser of the kind registered as name, and false
+// if there is none.
+func NewParser(name string) (Parser, bool) {
+	parsers.mu.Lock()
+	newParser, ok := parsers.byName[name]
+	parsers.mu.Unlock()
+
+	if !ok {
+		return nil, false
+	}
+	return newParser(), true
+}
+
+// ParserNames returns the names of the registered parsers, sorted.
+func ParserNames() []string {
+	parsers.mu.Lock()
+	defer parsers.mu.Unlock()
+
+	names := make([]string, 0, len(parsers.byName))
+	for name := range parsers.byName {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
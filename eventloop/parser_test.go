@@ -0,0 +1,57 @@
+package eventloop
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// sumParser reads a line of numbers as the add of them all, a language just
+// unlike the built-in one.
+type sumParser struct{}
+
+func (sumParser) Parse(line string) (Command, error) {
+	if strings.TrimSpace(line) == "" {
+		return nil, nil
+	}
+	return Parse("add " + line)
+}
+
+func TestRegisterParser(t *testing.T) {
+	RegisterParser("sum", func() Parser { return sumParser{} })
+	if !slices.Contains(ParserNames(), "sum") {
+		t.Errorf("parser names = %q, want sum among them", ParserNames())
+	}
+	parser, ok := NewParser("sum")
+	if !ok {
+		t.Fatal("NewParser of a registered parser failed")
+	}
+
+	var out, errs syncBuffer
+	l := newTestLoop(&out, &errs)
+	l.Start()
+	for _, line := range []string{"1 2", "", "3 4 5"} {
+		cmd, err := parser.Parse(line)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", line, err)
+		}
+		if cmd != nil {
+			l.Post(cmd)
+		}
+	}
+	l.AwaitFinish()
+	if got, want := out.String(), "3\n12\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
+
+func TestNewParser(t *testing.T) {
+	for _, name := range []string{"text", "json"} {
+		if p, ok := NewParser(name); !ok || p == nil {
+			t.Errorf("NewParser(%q) = %v, %v, want the built-in parser", name, p, ok)
+		}
+	}
+	if p, ok := NewParser("nope"); ok || p != nil {
+		t.Errorf("NewParser of an unknown name = %v, %v, want none", p, ok)
+	}
+}
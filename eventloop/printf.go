@@ -0,0 +1,143 @@
+package eventloop
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const PrintfFormatError string = "SYNTAX ERROR: printf format '%v' %v"
+const PrintfArgError string = "error: printf: %%%c needs an integer, got %v"
+
+// MARK: - printf
+
+// printfVerbs lists the verbs printf understands: %d and %x format an integer
+// in decimal and hexadecimal, %s any value as text. %% is a literal %.
+const printfVerbs = "dsx"
+
+// printfArg is a printf argument: a variable, or a literal value.
+type printfArg struct {
+	name string
+	val  Value
+}
+
+func (a printfArg) String() string {
+	if a.name != "" {
+		return a.name
+	}
+	return a.val.String()
+}
+
+func (a printfArg) resolve(handler Handler) (Value, bool) {
+	if a.name == "" {
+		return a.val, true
+	}
+	return lookupVar(handler, a.name)
+}
+
+// printfCommand prints its arguments formatted by a format string, as in
+// printf "x=%d" x.
+type printfCommand struct {
+	format string
+	args   []printfArg
+}
+
+func (p *printfCommand) attrs() []any {
+	return []any{"format", p.format, "args", p.args}
+}
+
+func (p *printfCommand) Execute(handler Handler) {
+	vals := make([]Value, len(p.args))
+	for i, arg := range p.args {
+		val, ok := arg.resolve(handler)
+		if !ok {
+			return
+		}
+		vals[i] = val
+	}
+	var b strings.Builder
+	for i := 0; i < len(p.format); i++ {
+		c := p.format[i]
+		if c != '%' {
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		verb := p.format[i]
+		if verb == '%' {
+			b.WriteByte('%')
+			continue
+		}
+		val := vals[0]
+		vals = vals[1:]
+		if verb == 's' {
+			b.WriteString(val.String())
+			continue
+		}
+		n, ok := val.Int()
+		if !ok {
+			handler.Post(&errorCommand{msg: fmt.Sprintf(PrintfArgError, verb, strconv.Quote(val.String()))})
+			return
+		}
+		base := 10
+		if verb == 'x' {
+			base = 16
+		}
+		b.WriteString(strconv.FormatInt(n, base))
+	}
+	res := b.String()
+	returnResult(handler, res)
+	handler.Post(&printCommand{arg: res})
+}
+
+// countVerbs checks format and returns the number of arguments it takes.
+func countVerbs(format string) (int, error) {
+	n := 0
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		i++
+		switch {
+		case i == len(format):
+			return 0, fmt.Errorf(PrintfFormatError, format, "ends with a lone %")
+		case format[i] == '%':
+		case strings.IndexByte(printfVerbs, format[i]) >= 0:
+			n++
+		default:
+			return 0, fmt.Errorf(PrintfFormatError, format, fmt.Sprintf("has unknown verb %%%c", format[i]))
+		}
+	}
+	return n, nil
+}
+
+// parsePrintf takes variables by name; any other argument is a literal
+// integer, or else text.
+func parsePrintf(args []string) (Command, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "printf")
+	}
+	format := args[0]
+	n, err := countVerbs(format)
+	if err != nil {
+		return nil, err
+	}
+	if n != len(args)-1 {
+		return nil, fmt.Errorf(PrintfFormatError, format, fmt.Sprintf("takes %d arguments, got %d", n, len(args)-1))
+	}
+	cmd := &printfCommand{format: format}
+	for _, arg := range args[1:] {
+		cmd.args = append(cmd.args, parsePrintfArg(arg))
+	}
+	return cmd, nil
+}
+
+func parsePrintfArg(arg string) printfArg {
+	if isIdentifier(arg) {
+		return printfArg{name: arg}
+	}
+	if n, err := parseInt(arg); err == nil {
+		return printfArg{val: IntValue(n)}
+	}
+	return printfArg{val: StringValue(arg)}
+}
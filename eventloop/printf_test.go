@@ -0,0 +1,38 @@
+package eventloop
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPrintf(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   string
+	}{
+		{"%d", `set x 42` + "\n" + `printf "x=%d" x`, "x=42\n"},
+		{"%d literal", `printf "%d items" -7`, "-7 items\n"},
+		{"%s", `set s abc` + "\n" + `set f 1.5` + "\n" + `printf "%s, %s and %s" s f 3`, "abc, 1.5 and 3\n"},
+		{"%x", `set x 255` + "\n" + `printf "%x/%x" x 16`, "ff/10\n"},
+		{"%%", `printf "100%%"`, "100%\n"},
+		{"no verbs", `printf plain`, "plain\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkOutput(t, tt.script, tt.want, "")
+		})
+	}
+}
+
+func TestPrintfErrors(t *testing.T) {
+	checkOutput(t, "set s abc\nprintf \"%d\" s", "", "line 2: "+fmt.Sprintf(PrintfArgError, 'd', `"abc"`)+"\n")
+	checkOutput(t, "printf \"%x\" 1.5", "", "line 1: "+fmt.Sprintf(PrintfArgError, 'x', `"1.5"`)+"\n")
+	checkOutput(t, "printf \"%s\" zz", "", "line 1: "+fmt.Sprintf(UndefinedVariableError, "zz")+"\n")
+
+	for _, line := range []string{`printf "%d %d" 1`, `printf "%d" 1 2`, `printf "%q" 1`, `printf "50%"`, `printf`} {
+		if _, err := Parse(line); err == nil {
+			t.Errorf("Parse(%q) succeeded, want a syntax error", line)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package eventloop
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+const InvalidPriorityError string = "SYNTAX ERROR: priority '%v' must be an integer between %v and %v"
+
+// MARK: - Priorities
+
+// priorityCommand queues cmd with priority n instead of the default of 0. A
+// worker pulls the queued command of the highest priority first, and commands
+// of the same priority in the order they were posted; a drain still stops
+// only after every priority has run. The priority only affects queuing: in a
+// program with labels, which is queued an instruction at a time, it has no
+// effect.
+type priorityCommand struct {
+	n   int
+	cmd Command
+}
+
+func (p *priorityCommand) attrs() []any {
+	return []any{"priority", p.n}
+}
+
+func (p *priorityCommand) Execute(handler Handler) {
+	p.cmd.Execute(handler)
+}
+
+func (r *Registry) parsePriority(args []string) (Command, error) {
+	if len(args) < 2 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "priority")
+	}
+	n, err := strconv.ParseInt(args[0], 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf(InvalidPriorityError, args[0], math.MinInt32, math.MaxInt32)
+	}
+	cmd, err := r.parseFields(args[1:])
+	if err != nil {
+		return nil, err
+	}
+	return &priorityCommand{n: int(n), cmd: cmd}, nil
+}
@@ -0,0 +1,50 @@
+package eventloop
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestPriority(t *testing.T) {
+	var out, errs syncBuffer
+	l := newTestLoop(&out, &errs)
+	for _, line := range []string{
+		"print a", "print b", "priority 5 print c", "priority 5 print d", "priority -1 print e", "priority 9 print f",
+	} {
+		l.Post(mustParse(t, line))
+	}
+	l.Start()
+	l.AwaitFinish()
+	// Highest first, in the order posted within a priority.
+	if got, want := out.String(), "f\nc\nd\na\nb\ne\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
+
+func TestPriorityStopStaysLast(t *testing.T) {
+	q := newCommandsQueue(0)
+	q.push(seqCommand(1))
+	q.push(&stopCommand{})
+	q.push(&priorityCommand{n: 9, cmd: seqCommand(2)})
+	q.push(&priorityCommand{n: -9, cmd: seqCommand(3)})
+	cmds := queued(q)
+	if len(cmds) != 4 {
+		t.Fatalf("queued %v, want 4 commands", cmds)
+	}
+	if _, ok := cmds[len(cmds)-1].(*stopCommand); !ok {
+		t.Errorf("queued %v, want the stop marker behind every priority", cmds)
+	}
+}
+
+func TestPriorityParseErrors(t *testing.T) {
+	for _, line := range []string{"priority 1", "priority x print a", "priority 1.5 print a"} {
+		if _, err := Parse(line); err == nil {
+			t.Errorf("Parse(%q) succeeded, want an error", line)
+		}
+	}
+	_, err := Parse("priority 99999999999 print a")
+	if want := fmt.Sprintf(InvalidPriorityError, "99999999999", math.MinInt32, math.MaxInt32); err == nil || err.Error() != want {
+		t.Errorf("Parse of an out-of-range priority = %v, want %q", err, want)
+	}
+}
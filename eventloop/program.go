@@ -0,0 +1,283 @@
+package eventloop
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sync"
+)
+
+const UndefinedLabelError string = "error: undefined label %v"
+const DuplicateLabelError string = "error: duplicate label %v"
+const JumpLimitError string = "error: jump limit of %v exceeded"
+const GotoOutsideProgramError string = "error: goto %v outside of a program"
+
+// MARK: - Program
+
+// Program is a complete instruction file. Unlike commands posted one by one,
+// it keeps every instruction so goto can resume execution at any label.
+type Program struct {
+	cmds   []Command
+	labels map[string]int
+
+	// MaxJumps stops the program with an error after that many jumps; zero
+	// means no limit.
+	MaxJumps int
+
+	// Path names the file the program was read from, if any. Include
+	// commands in the program resolve relative paths against its directory.
+	Path string
+
+	// Lines holds the line each command starts on, if known, for WithEcho
+	// and the errors the commands report.
+	Lines []int
+}
+
+// NewProgram indexes the labels of cmds and checks that every top-level goto
+// has a target.
+func NewProgram(cmds []Command) (*Program, error) {
+	p := &Program{cmds: cmds, labels: make(map[string]int)}
+	for ip, cmd := range cmds {
+		if l, ok := cmd.(*labelCommand); ok {
+			if _, ok := p.labels[l.name]; ok {
+				return nil, fmt.Errorf(DuplicateLabelError, l.name)
+			}
+			p.labels[l.name] = ip
+		}
+	}
+	for _, cmd := range cmds {
+		if g, ok := cmd.(*gotoCommand); ok {
+			if _, ok := p.labels[g.label]; !ok {
+				return nil, fmt.Errorf(UndefinedLabelError, g.label)
+			}
+		}
+	}
+	return p, nil
+}
+
+// PostTo queues the program on h. A program without labels is posted as its
+// individual commands; one with labels is stepped through an instruction at
+// a time, each step posting the next, so that jumps can take effect. Labels
+// do nothing, so the steps skip them.
+func (p *Program) PostTo(h Handler) {
+	if p.Path != "" {
+		if path, err := filepath.Abs(p.Path); err == nil {
+			h = &fileHandler{Handler: h, file: &sourceFile{path: path}}
+		}
+	}
+	if len(p.labels) == 0 {
+		for ip, cmd := range p.cmds {
+			if line := p.line(ip); line > 0 {
+				cmd = &fileCommand{cmd: cmd, file: fileOf(h), line: line}
+			}
+			h.Post(cmd)
+		}
+		return
+	}
+	if ip := p.skipLabels(0); ip < len(p.cmds) {
+		h.Post(&programCommand{prog: p, ip: ip})
+	}
+}
+
+// line returns the line of the command at ip, or 0 if it isn't known.
+func (p *Program) line(ip int) int {
+	if ip < len(p.Lines) {
+		return p.Lines[ip]
+	}
+	return 0
+}
+
+// skipLabels returns the index of the first instruction from ip on that
+// isn't a label, or the length of the program if there is none.
+func (p *Program) skipLabels(ip int) int {
+	for ip < len(p.cmds) {
+		if _, ok := p.cmds[ip].(*labelCommand); !ok {
+			break
+		}
+		ip++
+	}
+	return ip
+}
+
+// remaining counts the instructions from ip on, labels left out.
+func (p *Program) remaining(ip int) int {
+	n := 0
+	for ; ip < len(p.cmds); ip++ {
+		if _, ok := p.cmds[ip].(*labelCommand); !ok {
+			n++
+		}
+	}
+	return n
+}
+
+// programCommand executes the instruction at ip and posts the next step.
+// The commands the instructions post, like the prints of their results, are
+// held back in posted until the program jumps or ends, so that they run
+// after the rest of the program, as they would behind the instructions of a
+// program without labels. The loop's metrics and limits, and the length of
+// the queue, see the instruction rather than the step: a queued step counts
+// as the instructions left and the commands held back.
+type programCommand struct {
+	prog   *Program
+	ip     int
+	jumps  int
+	posted []Command
+}
+
+func (p *programCommand) attrs() []any {
+	if p.ip < len(p.prog.cmds) {
+		if a, ok := p.prog.cmds[p.ip].(attrser); ok {
+			return a.attrs()
+		}
+	}
+	return nil
+}
+
+// pending counts the instructions and the commands the step stands for.
+func (p *programCommand) pending() int {
+	return p.prog.remaining(p.ip) + len(p.posted)
+}
+
+func (p *programCommand) Execute(handler Handler) {
+	if p.ip >= len(p.prog.cmds) {
+		postAll(handler, p.posted)
+		return
+	}
+	h := &programHandler{Handler: handler, prog: p.prog, ip: p.ip, next: p.ip + 1, posted: p.posted}
+	var step Handler = h
+	if line := p.prog.line(p.ip); line > 0 {
+		step = &fileHandler{Handler: h, file: fileOf(handler), line: line}
+	}
+	p.prog.cmds[p.ip].Execute(step)
+	if h.cleared {
+		return
+	}
+
+	jumps := p.jumps
+	if h.jumped {
+		jumps++
+		exceeded := p.prog.MaxJumps > 0 && jumps > p.prog.MaxJumps
+		if exceeded {
+			// Reported as an error of the goto, with its line.
+			step.Post(&errorCommand{msg: fmt.Sprintf(JumpLimitError, p.prog.MaxJumps)})
+		}
+		postAll(handler, h.posted)
+		h.posted = nil
+		if exceeded {
+			return
+		}
+	}
+	next := p.prog.skipLabels(h.next)
+	if next >= len(p.prog.cmds) {
+		postAll(handler, h.posted)
+		return
+	}
+	handler.Post(&programCommand{prog: p.prog, ip: next, jumps: jumps, posted: h.posted})
+}
+
+func postAll(handler Handler, cmds []Command) {
+	for _, cmd := range cmds {
+		handler.Post(cmd)
+	}
+}
+
+// programHandler lets a goto executed by a program step pick the next step,
+// and holds back the commands the step posts.
+type programHandler struct {
+	Handler
+	prog    *Program
+	ip      int
+	next    int
+	jumped  bool
+	cleared bool
+	posted  []Command
+	mu      sync.Mutex
+}
+
+func (h *programHandler) unwrap() Handler {
+	return h.Handler
+}
+
+func (h *programHandler) Post(cmd Command) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !h.cleared {
+		h.posted = append(h.posted, cmd)
+	}
+}
+
+// pending counts the instructions after the executing one and the commands
+// held back, which are queued behind it as far as the step is concerned.
+func (h *programHandler) pending() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.prog.remaining(h.ip+1) + len(h.posted)
+}
+
+// rest returns the instructions after the executing one and the commands
+// held back.
+func (h *programHandler) rest() (cmds, posted []Command) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.prog.cmds[h.next:], slices.Clone(h.posted)
+}
+
+// clear ends the program at the executing instruction, dropping what it
+// holds back, as clear drops the rest of a program without labels.
+func (h *programHandler) clear() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	n := h.prog.remaining(h.ip+1) + len(h.posted)
+	h.cleared = true
+	h.posted = nil
+	return n
+}
+
+func (h *programHandler) jump(label string) bool {
+	ip, ok := h.prog.labels[label]
+	if ok {
+		h.next = ip
+		h.jumped = true
+	}
+	return ok
+}
+
+// labelCommand marks a position in a program; executing it does nothing.
+type labelCommand struct {
+	name string
+}
+
+func (l *labelCommand) Execute(handler Handler) {}
+
+type gotoCommand struct {
+	label string
+}
+
+func (g *gotoCommand) Execute(handler Handler) {
+	h, ok := findHandler[*programHandler](handler)
+	if !ok {
+		handler.Post(&errorCommand{msg: fmt.Sprintf(GotoOutsideProgramError, g.label)})
+		return
+	}
+	if !h.jump(g.label) {
+		handler.Post(&errorCommand{msg: fmt.Sprintf(UndefinedLabelError, g.label)})
+	}
+}
+
+func parseLabel(args []string) (Command, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "label")
+	}
+	return &labelCommand{name: args[0]}, nil
+}
+
+func parseGoto(args []string) (Command, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "goto")
+	}
+	return &gotoCommand{label: args[0]}, nil
+}
@@ -0,0 +1,59 @@
+package eventloop
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestGotoForward(t *testing.T) {
+	checkOutput(t, "print a\ngoto end\nprint skipped\nlabel end\nprint b", "a\nb\n", "")
+}
+
+func TestGotoBackward(t *testing.T) {
+	script := `set i 0
+label top
+inc i
+print $i
+if i lt 3 goto top
+print done`
+	checkOutput(t, script, "1\n2\n3\ndone\n", "")
+}
+
+func TestGotoUndefinedLabel(t *testing.T) {
+	cmds := []Command{mustParse(t, "print a"), mustParse(t, "goto nowhere")}
+	if _, err := NewProgram(cmds); err == nil || err.Error() != fmt.Sprintf(UndefinedLabelError, "nowhere") {
+		t.Errorf("NewProgram error = %v, want an undefined label", err)
+	}
+}
+
+func TestGotoJumpLimit(t *testing.T) {
+	parser := NewLineParser()
+	var cmds []Command
+	var lines []int
+	for _, line := range []string{"label top", "print a", "goto top"} {
+		cmd, err := parser.Parse(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cmds = append(cmds, cmd)
+		lines = append(lines, parser.Line())
+	}
+	prog, err := NewProgram(cmds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prog.Lines = lines
+	prog.MaxJumps = 2
+
+	var out, errs syncBuffer
+	l := newTestLoop(&out, &errs)
+	l.Start()
+	prog.PostTo(l)
+	l.AwaitFinish()
+	if got, want := out.String(), "a\na\na\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+	if got, want := errs.String(), "line 3: "+fmt.Sprintf(JumpLimitError, 2)+"\n"; got != want {
+		t.Errorf("errors = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,564 @@
+package eventloop
+
+import (
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+// MARK: - ring
+
+// ring is a growable circular buffer of commands with O(1) push and pop at
+// either end. Freed slots are reused, so a long run never leaks the backing
+// array the way reslicing a plain slice does.
+type ring struct {
+	buf  []Command
+	head int
+	size int
+}
+
+const minRingSize = 16
+
+func (r *ring) len() int {
+	return r.size
+}
+
+func (r *ring) at(i int) int {
+	return (r.head + i) % len(r.buf)
+}
+
+func (r *ring) grow() {
+	buf := make([]Command, max(minRingSize, 2*len(r.buf)))
+	for i := 0; i < r.size; i++ {
+		buf[i] = r.buf[r.at(i)]
+	}
+	r.buf = buf
+	r.head = 0
+}
+
+func (r *ring) pushBack(cmd Command) {
+	if r.size == len(r.buf) {
+		r.grow()
+	}
+	r.buf[r.at(r.size)] = cmd
+	r.size++
+}
+
+func (r *ring) pushFront(cmd Command) {
+	if r.size == len(r.buf) {
+		r.grow()
+	}
+	r.head = (r.head + len(r.buf) - 1) % len(r.buf)
+	r.buf[r.head] = cmd
+	r.size++
+}
+
+func (r *ring) popFront() Command {
+	cmd := r.buf[r.head]
+	r.buf[r.head] = nil
+	r.head = r.at(1)
+	r.size--
+	return cmd
+}
+
+// each calls fn for every command from front to back.
+func (r *ring) each(fn func(cmd Command)) {
+	for i := 0; i < r.size; i++ {
+		fn(r.buf[r.at(i)])
+	}
+}
+
+// filter keeps only the commands for which keep returns true, preserving
+// their order, and returns how many were removed.
+func (r *ring) filter(keep func(cmd Command) bool) int {
+	kept := 0
+	for i := 0; i < r.size; i++ {
+		cmd := r.buf[r.at(i)]
+		r.buf[r.at(i)] = nil
+		if keep(cmd) {
+			r.buf[r.at(kept)] = cmd
+			kept++
+		}
+	}
+	removed := r.size - kept
+	r.size = kept
+	return removed
+}
+
+func (r *ring) front() Command {
+	if r.size == 0 {
+		return nil
+	}
+	return r.buf[r.head]
+}
+
+func (r *ring) back() Command {
+	if r.size == 0 {
+		return nil
+	}
+	return r.buf[r.at(r.size-1)]
+}
+
+// MARK: - levels
+
+// levels is a priority queue of commands: a ring of the commands of every
+// priority, highest priority first. Commands of the same priority leave in
+// the order they arrived.
+type levels struct {
+	rings []*level
+	size  int
+}
+
+type level struct {
+	prio int
+	ring
+}
+
+func (ls *levels) len() int {
+	return ls.size
+}
+
+// level returns the ring of prio, adding it if there is none yet. Rings are
+// kept once empty; a program uses a handful of priorities.
+func (ls *levels) level(prio int) *level {
+	i := 0
+	for i < len(ls.rings) && ls.rings[i].prio > prio {
+		i++
+	}
+	if i == len(ls.rings) || ls.rings[i].prio != prio {
+		ls.rings = slices.Insert(ls.rings, i, &level{prio: prio})
+	}
+	return ls.rings[i]
+}
+
+func (ls *levels) pushBack(cmd Command) {
+	ls.level(priorityOf(cmd)).pushBack(cmd)
+	ls.size++
+}
+
+func (ls *levels) pushFront(cmd Command) {
+	ls.level(priorityOf(cmd)).pushFront(cmd)
+	ls.size++
+}
+
+// first returns the ring of the highest priority holding a command, or nil.
+func (ls *levels) first() *level {
+	for _, l := range ls.rings {
+		if l.len() > 0 {
+			return l
+		}
+	}
+	return nil
+}
+
+func (ls *levels) popFront() Command {
+	ls.size--
+	return ls.first().popFront()
+}
+
+// back returns the last command of the lowest priority, or nil.
+func (ls *levels) back() Command {
+	for i := len(ls.rings) - 1; i >= 0; i-- {
+		if ls.rings[i].len() > 0 {
+			return ls.rings[i].back()
+		}
+	}
+	return nil
+}
+
+// each calls fn for every command in the order they would leave.
+func (ls *levels) each(fn func(cmd Command)) {
+	for _, l := range ls.rings {
+		l.each(fn)
+	}
+}
+
+func (ls *levels) filter(keep func(cmd Command) bool) int {
+	removed := 0
+	for _, l := range ls.rings {
+		removed += l.filter(keep)
+	}
+	ls.size -= removed
+	return removed
+}
+
+// priorityOf returns the priority cmd is queued with: that of a priority
+// command, the lowest of all for the stop marker, so that it stays last, and
+// 0 for any other command.
+func priorityOf(cmd Command) int {
+	switch c := cmd.(type) {
+	case *priorityCommand:
+		return c.n
+	case *stopCommand:
+		return math.MinInt
+	case *fileCommand:
+		return priorityOf(c.cmd)
+	case *resultCommand:
+		return priorityOf(c.cmd)
+	case *postedCommand:
+		return priorityOf(c.cmd)
+	}
+	return 0
+}
+
+// MARK: - commandsQueue
+
+type commandsQueue struct {
+	queue    levels
+	mu       sync.Mutex
+	notify   *sync.Cond
+	space    *sync.Cond
+	idle     *sync.Cond
+	closed   bool
+	paused   bool
+	holding  bool
+	held     int
+	dedupe   bool
+	maxSize  int
+	maxDepth int
+	peak     int
+
+	// active counts commands pulled by a worker that haven't finished yet,
+	// settling those of them waiting in settle.
+	active     int
+	settling   int
+	lastActive time.Time
+}
+
+// newCommandsQueue creates a queue holding at most maxSize commands, or an
+// unbounded one when maxSize is zero.
+func newCommandsQueue(maxSize int) *commandsQueue {
+	q := &commandsQueue{maxSize: maxSize}
+	q.notify = sync.NewCond(&q.mu)
+	q.space = sync.NewCond(&q.mu)
+	q.idle = sync.NewCond(&q.mu)
+	return q
+}
+
+// pull removes the front command without waiting. The second result is false
+// when the queue is empty.
+func (q *commandsQueue) pull() (Command, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.pop()
+}
+
+func (q *commandsQueue) pop() (Command, bool) {
+	if q.queue.len() == 0 {
+		return nil, false
+	}
+	cmd := q.queue.popFront()
+	q.space.Signal()
+	return cmd, true
+}
+
+// pullBlocking parks the caller until a command is available, and the queue
+// isn't paused, held by WithHold or by a barrier, or the queue is closed. The
+// second result is false once the queue has been closed. A worker must call
+// finish once it has executed the command.
+func (q *commandsQueue) pullBlocking() (Command, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for (q.queue.len() == 0 || q.paused || q.holding || q.held > 0) && !q.closed {
+		q.notify.Wait()
+	}
+	if q.closed {
+		return nil, false
+	}
+	q.active++
+	return q.pop()
+}
+
+// unpull returns a command obtained from pullBlocking to the front of the
+// queue without executing it, and finishes it.
+func (q *commandsQueue) unpull(cmd Command) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.queue.pushFront(cmd)
+	q.active--
+	q.idle.Broadcast()
+}
+
+func (q *commandsQueue) finish() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.active--
+	q.lastActive = time.Now()
+	q.idle.Broadcast()
+}
+
+// settle is called by an executing command that needs every other worker to
+// be idle. It waits until only settling commands are active and returns the
+// number of pending commands at that point.
+func (q *commandsQueue) settle() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.settling++
+	q.idle.Broadcast()
+	for q.active > q.settling && !q.closed {
+		q.idle.Wait()
+	}
+	q.settling--
+	return q.pendingLocked()
+}
+
+// barrier is like settle, but also keeps the other workers from pulling
+// commands meanwhile, so that none queued after the caller starts before
+// those pulled ahead of it have finished.
+func (q *commandsQueue) barrier() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.held++
+	q.settling++
+	q.idle.Broadcast()
+	for q.active > q.settling && !q.closed {
+		q.idle.Wait()
+	}
+	q.settling--
+	q.held--
+	q.notify.Broadcast()
+}
+
+func (q *commandsQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.closed = true
+	q.notify.Broadcast()
+	q.space.Broadcast()
+	q.idle.Broadcast()
+}
+
+// setPaused stops or resumes handing out commands to pullBlocking.
+func (q *commandsQueue) setPaused(paused bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.paused = paused
+	q.notify.Broadcast()
+}
+
+func (q *commandsQueue) reopen() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.closed = false
+}
+
+// pending reports how many commands are queued, not counting a trailing stop,
+// and counting a program step as the rest of its program.
+func (q *commandsQueue) pending() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.pendingLocked()
+}
+
+func (q *commandsQueue) pendingLocked() int {
+	n := q.queue.len()
+	if _, ok := q.peekTail().(*stopCommand); ok {
+		n--
+	}
+	q.queue.each(func(cmd Command) {
+		n += weight(cmd) - 1
+	})
+	return n
+}
+
+// empty reports whether nothing but a trailing stop is queued. Unlike
+// pending, it doesn't walk the queue.
+func (q *commandsQueue) empty() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	switch q.queue.len() {
+	case 0:
+		return true
+	case 1:
+		_, ok := q.peekTail().(*stopCommand)
+		return ok
+	}
+	return false
+}
+
+// weight is the number of pending commands cmd stands for: one, except for a
+// program step, which stands for the rest of its program.
+func weight(cmd Command) int {
+	switch c := cmd.(type) {
+	case *fileCommand:
+		return weight(c.cmd)
+	case *resultCommand:
+		return weight(c.cmd)
+	case *postedCommand:
+		return weight(c.cmd)
+	case *programCommand:
+		return c.pending()
+	}
+	return 1
+}
+
+// snapshot returns the pending commands front to back, without a trailing stop.
+func (q *commandsQueue) snapshot() []Command {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	cmds := make([]Command, 0, q.queue.len())
+	q.queue.each(func(cmd Command) {
+		if _, ok := cmd.(*stopCommand); !ok {
+			cmds = append(cmds, cmd)
+		}
+	})
+	return cmds
+}
+
+// The queue is FIFO within a priority: push appends at the tail of the
+// commands of the same priority and pull removes the front one of the highest
+// priority. peekFront returns what the next pull would yield, peekTail the
+// command that would be pulled last; both return nil for an empty queue and
+// expect the caller to hold q.mu.
+
+func (q *commandsQueue) peekFront() Command {
+	if l := q.queue.first(); l != nil {
+		return l.front()
+	}
+	return nil
+}
+
+func (q *commandsQueue) peekTail() Command {
+	return q.queue.back()
+}
+
+// duplicatesTail reports whether cmd equals the command queued last with the
+// same priority. The stop marker has a priority of its own.
+func (q *commandsQueue) duplicatesTail(cmd Command) bool {
+	return sameCommand(q.queue.level(priorityOf(cmd)).back(), cmd)
+}
+
+func (q *commandsQueue) full() bool {
+	return q.maxSize > 0 && q.queue.len() >= q.maxSize
+}
+
+// capped reports whether cmd is over the cap of WithMaxDepth.
+func (q *commandsQueue) capped(cmd Command) bool {
+	return q.maxDepth > 0 && q.queue.len() >= q.maxDepth && !isInternal(cmd)
+}
+
+// peakDepth returns the largest length the queue has had.
+func (q *commandsQueue) peakDepth() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.peak
+}
+
+func (q *commandsQueue) resetPeak() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.peak = q.queue.len()
+}
+
+// push appends cmd regardless of the size limit.
+func (q *commandsQueue) push(cmd Command) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.insert(cmd)
+}
+
+// pushAll appends cmds regardless of the size limit, under a single lock so
+// that nothing pushed concurrently lands between them.
+func (q *commandsQueue) pushAll(cmds []Command) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, cmd := range cmds {
+		q.insert(cmd)
+	}
+}
+
+// remove discards the first queued command match returns true for and
+// reports whether there was one.
+func (q *commandsQueue) remove(match func(cmd Command) bool) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	found := false
+	removed := q.queue.filter(func(cmd Command) bool {
+		if !found && match(cmd) {
+			found = true
+			return false
+		}
+		return true
+	})
+	if removed > 0 {
+		q.space.Signal()
+	}
+	return found
+}
+
+// clear discards every queued command except the internal ones, so that a
+// pending stop marker stays at the tail and pending Wait calls still return.
+// It returns how many commands were discarded.
+func (q *commandsQueue) clear() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	removed := q.queue.filter(isInternal)
+	q.space.Broadcast()
+	return removed
+}
+
+// pushBlocking waits until the queue has room for cmd. A closed queue never
+// frees up, so the command is appended anyway instead of blocking forever.
+// It reports false, without appending cmd, if the queue is at its cap.
+func (q *commandsQueue) pushBlocking(cmd Command) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for q.full() && !q.closed {
+		q.space.Wait()
+	}
+	if q.capped(cmd) {
+		return false
+	}
+	q.insert(cmd)
+	return true
+}
+
+// tryPush appends cmd only if the queue is open and has room for it.
+func (q *commandsQueue) tryPush(cmd Command) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed || q.full() || q.capped(cmd) {
+		return false
+	}
+	q.insert(cmd)
+	return true
+}
+
+// insert maintains the queue invariant: at most one stopCommand is queued and
+// it is always the tail, so everything posted before the loop drains still
+// runs ahead of it. Its priority takes care of the latter; a second stop is
+// dropped rather than queued.
+func (q *commandsQueue) insert(cmd Command) {
+	if q.dedupe && q.duplicatesTail(cmd) {
+		return
+	}
+	if _, ok := cmd.(*stopCommand); ok {
+		if _, ok := q.peekTail().(*stopCommand); ok {
+			return
+		}
+	}
+	q.queue.pushBack(cmd)
+	q.peak = max(q.peak, q.queue.len())
+	q.notify.Signal()
+}
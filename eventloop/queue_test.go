@@ -0,0 +1,209 @@
+package eventloop
+
+import "testing"
+
+// seqCommand is a command told apart by its number.
+type seqCommand int
+
+func (seqCommand) Execute(handler Handler) {}
+
+func TestPullEmptyQueue(t *testing.T) {
+	q := newCommandsQueue(0)
+	if cmd, ok := q.pull(); cmd != nil || ok {
+		t.Errorf("pull() = %v, %v on an empty queue, want nil, false", cmd, ok)
+	}
+}
+
+func TestQueueFIFO(t *testing.T) {
+	q := newCommandsQueue(0)
+	next, want := 0, 0
+	// Interleave pushes and pulls so that the ring wraps around and grows.
+	for round := 0; round < 10; round++ {
+		for i := 0; i < 3*minRingSize/2; i++ {
+			q.push(seqCommand(next))
+			next++
+		}
+		for i := 0; i < minRingSize; i++ {
+			cmd, ok := q.pull()
+			if !ok || cmd != seqCommand(want) {
+				t.Fatalf("pull() = %v, %v, want %v", cmd, ok, want)
+			}
+			want++
+		}
+	}
+	for want < next {
+		if cmd, ok := q.pull(); !ok || cmd != seqCommand(want) {
+			t.Fatalf("pull() = %v, %v, want %v", cmd, ok, want)
+		}
+		want++
+	}
+	if _, ok := q.pull(); ok {
+		t.Error("queue not empty after pulling everything pushed")
+	}
+}
+
+// sliceQueue is the queue as it was before the ring buffer: pulling
+// reslices the front off the backing array.
+type sliceQueue struct {
+	cmds []Command
+}
+
+func (q *sliceQueue) push(cmd Command) {
+	q.cmds = append(q.cmds, cmd)
+}
+
+func (q *sliceQueue) pull() Command {
+	cmd := q.cmds[0]
+	q.cmds[0] = nil
+	q.cmds = q.cmds[1:]
+	return cmd
+}
+
+// pushPullCycles is the number of push/pull cycles of every iteration of
+// BenchmarkPushPull, with a few commands queued throughout.
+const pushPullCycles = 1_000_000
+
+func BenchmarkPushPull(b *testing.B) {
+	var cmd Command = seqCommand(0)
+	b.Run("ring", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var r ring
+			for j := 0; j < 8; j++ {
+				r.pushBack(cmd)
+			}
+			for j := 0; j < pushPullCycles; j++ {
+				r.pushBack(cmd)
+				r.popFront()
+			}
+		}
+	})
+	b.Run("slice", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var q sliceQueue
+			for j := 0; j < 8; j++ {
+				q.push(cmd)
+			}
+			for j := 0; j < pushPullCycles; j++ {
+				q.push(cmd)
+				q.pull()
+			}
+		}
+	})
+}
+
+// peek returns what peekFront and peekTail see.
+func peek(q *commandsQueue) (Command, Command) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.peekFront(), q.peekTail()
+}
+
+func TestPeek(t *testing.T) {
+	q := newCommandsQueue(0)
+	if front, tail := peek(q); front != nil || tail != nil {
+		t.Errorf("peek of an empty queue = %v, %v, want nil, nil", front, tail)
+	}
+
+	for i := 1; i <= 3; i++ {
+		q.push(seqCommand(i))
+	}
+	if front, tail := peek(q); front != seqCommand(1) || tail != seqCommand(3) {
+		t.Errorf("peek = %v, %v, want 1, 3", front, tail)
+	}
+
+	// peekFront is what the next pull yields.
+	for q.pending() > 0 {
+		front, _ := peek(q)
+		if cmd, _ := q.pull(); cmd != front {
+			t.Errorf("pull() = %v after peekFront returned %v", cmd, front)
+		}
+	}
+
+	// A higher priority comes out first, and the stop marker last.
+	q.push(seqCommand(1))
+	q.push(&stopCommand{})
+	urgent := &priorityCommand{n: 1, cmd: seqCommand(2)}
+	q.push(urgent)
+	front, tail := peek(q)
+	if front != urgent {
+		t.Errorf("peekFront = %v, want the priority command", front)
+	}
+	if _, ok := tail.(*stopCommand); !ok {
+		t.Errorf("peekTail = %v, want the stop marker", tail)
+	}
+}
+
+// queued returns every command in q in the order they would be pulled.
+func queued(q *commandsQueue) []Command {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var cmds []Command
+	q.queue.each(func(cmd Command) {
+		cmds = append(cmds, cmd)
+	})
+	return cmds
+}
+
+func TestStopStaysLast(t *testing.T) {
+	stop := func() Command { return &stopCommand{} }
+	tests := []struct {
+		name   string
+		pushes []Command
+		want   int // commands queued, the stop marker last
+	}{
+		{"command after a stop", []Command{seqCommand(1), stop(), seqCommand(2)}, 3},
+		{"two stops", []Command{seqCommand(1), stop(), stop()}, 2},
+		{"two stops around a command", []Command{stop(), seqCommand(1), stop()}, 2},
+		{"stop into an empty queue", []Command{stop()}, 1},
+		{"command into an empty queue after a stop", []Command{stop(), seqCommand(1)}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newCommandsQueue(0)
+			for _, cmd := range tt.pushes {
+				q.push(cmd)
+			}
+			cmds := queued(q)
+			if len(cmds) != tt.want {
+				t.Fatalf("queued %v, want %d commands", cmds, tt.want)
+			}
+			for i, cmd := range cmds {
+				_, isStop := cmd.(*stopCommand)
+				if isStop != (i == len(cmds)-1) {
+					t.Fatalf("queued %v, want a single stop marker at the tail", cmds)
+				}
+			}
+		})
+	}
+
+	t.Run("command into an empty queue", func(t *testing.T) {
+		q := newCommandsQueue(0)
+		q.push(seqCommand(1))
+		if cmds := queued(q); len(cmds) != 1 || cmds[0] != seqCommand(1) {
+			t.Errorf("queued %v, want just the command", cmds)
+		}
+	})
+}
+
+func TestClearKeepsStopMarker(t *testing.T) {
+	q := newCommandsQueue(0)
+	for i := 0; i < 3; i++ {
+		q.push(seqCommand(i))
+	}
+	q.push(&stopCommand{})
+
+	if n := q.clear(); n != 3 {
+		t.Errorf("clear() = %d, want 3", n)
+	}
+	cmds := queued(q)
+	if len(cmds) != 1 {
+		t.Fatalf("queued %v after clear, want the stop marker alone", cmds)
+	}
+	if _, ok := cmds[0].(*stopCommand); !ok {
+		t.Errorf("queued %v after clear, want the stop marker", cmds)
+	}
+}
@@ -0,0 +1,85 @@
+package eventloop
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const InvalidRangeError string = "error: empty range [%v, %v]"
+
+// MARK: - Random numbers
+
+// lockedRand shares a *rand.Rand, which isn't safe for concurrent use, among
+// the workers.
+type lockedRand struct {
+	r  *rand.Rand
+	mu sync.Mutex
+}
+
+func newLockedRand(r *rand.Rand) *lockedRand {
+	if r == nil {
+		r = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return &lockedRand{r: r}
+}
+
+// between returns a uniformly distributed integer in [min, max].
+func (l *lockedRand) between(min, max int64) int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	span := uint64(max) - uint64(min)
+	if span < math.MaxInt64 {
+		return min + l.r.Int63n(int64(span)+1)
+	}
+	// The range covers at least half of int64, so this rarely takes more
+	// than a couple of draws.
+	for {
+		if v := int64(l.r.Uint64()); v >= min && v <= max {
+			return v
+		}
+	}
+}
+
+// randCommand stores a random integer between min and max, inclusive, in a
+// variable. The loop's source is set with WithRand.
+type randCommand struct {
+	name     string
+	min, max operand
+}
+
+func (r *randCommand) attrs() []any {
+	return []any{"var", r.name, "min", r.min, "max", r.max}
+}
+
+func (r *randCommand) Execute(handler Handler) {
+	min, max, ok := resolveOperands(handler, r.min, r.max)
+	if !ok {
+		return
+	}
+	if min > max {
+		handler.Post(&errorCommand{msg: fmt.Sprintf(InvalidRangeError, min, max)})
+		return
+	}
+	h, ok := findHandler[workerHandler](handler)
+	if !ok {
+		return
+	}
+	val := h.rand.between(min, max)
+	handler.Vars().Set(r.name, IntValue(val))
+	returnResult(handler, val)
+}
+
+func parseRand(args []string) (Command, error) {
+	if len(args) != 3 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "rand")
+	}
+	min, max, err := parseOperands("rand", args[1:])
+	if err != nil {
+		return nil, err
+	}
+	return &randCommand{name: args[0], min: min, max: max}, nil
+}
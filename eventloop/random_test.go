@@ -0,0 +1,27 @@
+package eventloop
+
+import (
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestRandSeeded(t *testing.T) {
+	script := strings.Repeat("rand x 1 6\nget x\n", 5)
+
+	// The same source draws the numbers rand stores.
+	ref := rand.New(rand.NewSource(42))
+	var want strings.Builder
+	for i := 0; i < 5; i++ {
+		want.WriteString(strconv.FormatInt(1+ref.Int63n(6), 10) + "\n")
+	}
+
+	for run := 0; run < 2; run++ {
+		checkOutput(t, script, want.String(), "", WithRand(rand.New(rand.NewSource(42))))
+	}
+}
+
+func TestRandEmptyRange(t *testing.T) {
+	checkOutput(t, "rand x 6 1", "", "line 1: error: empty range [6, 1]\n")
+}
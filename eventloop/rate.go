@@ -0,0 +1,74 @@
+package eventloop
+
+import (
+	"sync"
+	"time"
+)
+
+// MARK: - Rate limiting
+
+// limiter spaces out command starts by a fixed interval. Slots are handed out
+// in order, so concurrent workers share the rate.
+type limiter struct {
+	interval time.Duration
+	next     time.Time
+	halt     chan struct{}
+	halted   bool
+	mu       sync.Mutex
+}
+
+func newLimiter(perSecond float64) *limiter {
+	return &limiter{
+		interval: time.Duration(float64(time.Second) / perSecond),
+		halt:     make(chan struct{}),
+	}
+}
+
+// wait blocks until the next slot. It returns false without using the slot
+// if the limiter is halted meanwhile.
+func (l *limiter) wait() bool {
+	l.mu.Lock()
+	now := time.Now()
+	at := l.next
+	if at.Before(now) {
+		at = now
+	}
+	l.next = at.Add(l.interval)
+	halt := l.halt
+	l.mu.Unlock()
+
+	if at.Equal(now) {
+		return true
+	}
+	timer := time.NewTimer(at.Sub(now))
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-halt:
+		return false
+	}
+}
+
+// stop wakes up the workers waiting for a slot.
+func (l *limiter) stop() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.halted {
+		l.halted = true
+		close(l.halt)
+	}
+}
+
+// reset makes a stopped limiter usable again.
+func (l *limiter) reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.halted {
+		l.halted = false
+		l.halt = make(chan struct{})
+	}
+}
@@ -0,0 +1,49 @@
+package eventloop
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateThrottles(t *testing.T) {
+	const n, perSecond = 11, 100
+	script := strings.TrimSuffix(strings.Repeat("print x\n", n), "\n")
+
+	start := time.Now()
+	out, _ := runScript(t, script, WithRate(perSecond), WithWorkers(4, false))
+	elapsed := time.Since(start)
+	if out != strings.Repeat("x\n", n) {
+		t.Errorf("output = %q, want %d lines", out, n)
+	}
+	// The first command starts right away, each other one an interval later.
+	if want := (n - 1) * time.Second / perSecond; elapsed < want*9/10 || elapsed > want+time.Second {
+		t.Errorf("%d commands at %d/s took %v, want about %v", n, perSecond, elapsed, want)
+	}
+}
+
+func TestRateDoesNotBlockStopping(t *testing.T) {
+	var out, errs syncBuffer
+
+	idle := newTestLoop(&out, &errs, WithRate(1))
+	idle.Start()
+	time.Sleep(20 * time.Millisecond)
+	finishWithin(t, idle, time.Second)
+
+	// The second print waits a whole second for its slot when Stop is called.
+	busy := newTestLoop(&out, &errs, WithRate(1))
+	busy.Start()
+	postScript(t, busy, "print a\nprint b")
+	time.Sleep(50 * time.Millisecond)
+	busy.Stop()
+	finishWithin(t, busy, 500*time.Millisecond)
+}
+
+// finishWithin fails t if l doesn't finish within d.
+func finishWithin(t *testing.T, l *EventLoop, d time.Duration) {
+	t.Helper()
+
+	if err := l.AwaitFinishTimeout(d); err != nil {
+		t.Errorf("AwaitFinishTimeout(%v) = %v, want the loop finished", d, err)
+	}
+}
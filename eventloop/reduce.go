@@ -0,0 +1,81 @@
+package eventloop
+
+import (
+	"fmt"
+	"strings"
+)
+
+const InvalidReduceRangeError string = "SYNTAX ERROR: reduce range from '%v' to '%v' must hold at most %v integers"
+const UnknownReduceOpError string = "SYNTAX ERROR: unknown reduce operator '%v', expected one of %v"
+
+// MARK: - Reduce
+
+// reduceOps are the operators reduce folds with, by name, reporting false on
+// an overflow.
+var reduceOps = map[string]func(acc, i int64) (int64, bool){
+	"+": checkedAdd,
+	"*": checkedMul,
+	"min": func(acc, i int64) (int64, bool) {
+		return min(acc, i), true
+	},
+	"max": func(acc, i int64) (int64, bool) {
+		return max(acc, i), true
+	},
+}
+
+// reduceOpNames lists the operators of reduce for its syntax error.
+var reduceOpNames = []string{"+", "*", "min", "max"}
+
+// reduceCommand folds an operator over the integers from start to end, both
+// included, starting from init, and stores the result in a variable, so that
+// reduce s 1 5 + 0 stores 15. Unlike foreach, the range is empty when start
+// is above end, leaving init as the result.
+type reduceCommand struct {
+	dest             string
+	start, end, init int64
+	op               string
+}
+
+func (r *reduceCommand) attrs() []any {
+	return []any{"dest", r.dest, "start", r.start, "end", r.end, "op", r.op, "init", r.init}
+}
+
+func (r *reduceCommand) Execute(handler Handler) {
+	fold := reduceOps[r.op]
+	acc := r.init
+	for i := r.start; i <= r.end; i++ {
+		var ok bool
+		if acc, ok = fold(acc, i); !ok {
+			handler.Post(&errorCommand{msg: IntegerOverflowError})
+			return
+		}
+		if i == r.end {
+			break
+		}
+	}
+	handler.Vars().Set(r.dest, IntValue(acc))
+	returnResult(handler, acc)
+}
+
+// parseReduce accepts ranges of up to MaxRepeat integers, like foreach.
+func parseReduce(args []string) (Command, error) {
+	if len(args) != 5 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "reduce")
+	}
+	var nums [3]int64
+	for i, arg := range []string{args[1], args[2], args[4]} {
+		n, err := parseInt(arg)
+		if err != nil {
+			return nil, err
+		}
+		nums[i] = n
+	}
+	start, end, init := nums[0], nums[1], nums[2]
+	if n, ok := checkedSub(end, start); start <= end && (!ok || n >= MaxRepeat) {
+		return nil, fmt.Errorf(InvalidReduceRangeError, args[1], args[2], MaxRepeat)
+	}
+	if _, ok := reduceOps[args[3]]; !ok {
+		return nil, fmt.Errorf(UnknownReduceOpError, args[3], strings.Join(reduceOpNames, ", "))
+	}
+	return &reduceCommand{dest: args[0], start: start, end: end, init: init, op: args[3]}, nil
+}
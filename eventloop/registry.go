@@ -0,0 +1,372 @@
+package eventloop
+
+import (
+	"fmt"
+	"maps"
+	"sort"
+	"sync"
+)
+
+const AliasCycleError string = "SYNTAX ERROR: alias '%v' would form a cycle"
+
+// ParseFunc builds a command from the arguments following its name.
+type ParseFunc func(args []string) (Command, error)
+
+// registryParseFunc is a ParseFunc given the registry the command was looked
+// up in, which a command wrapping another, like repeat, parses it with. That
+// may be a scope of the registry the command was registered on, with aliases
+// of its own.
+type registryParseFunc func(r *Registry, args []string) (Command, error)
+
+// Registry maps command names to the functions that parse them. It is safe
+// for concurrent use.
+type Registry struct {
+	parsers map[string]registryParseFunc
+	blocks  map[string]blockSpec
+	help    map[string]commandHelp
+	aliases map[string]string
+	mu      *sync.RWMutex
+}
+
+// commandHelp is what the help command shows for a command.
+type commandHelp struct {
+	usage, summary string
+}
+
+// NewRegistry returns a registry without any commands.
+func NewRegistry() *Registry {
+	return &Registry{
+		parsers: make(map[string]registryParseFunc),
+		blocks:  make(map[string]blockSpec),
+		help:    make(map[string]commandHelp),
+		aliases: make(map[string]string),
+		mu:      new(sync.RWMutex),
+	}
+}
+
+// scope returns a registry sharing the commands of r, including those
+// registered on r later, but with aliases of its own, starting out as those
+// of r. Every LineParser parses in a scope of its registry, so that the alias
+// instructions of one input, such as a file or a request, leave r and every
+// other input alone.
+func (r *Registry) scope() *Registry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return &Registry{
+		parsers: r.parsers,
+		blocks:  r.blocks,
+		help:    r.help,
+		aliases: maps.Clone(r.aliases),
+		mu:      r.mu,
+	}
+}
+
+// DefaultRegistry returns a registry holding the built-in commands. Commands
+// registered on it afterwards extend or replace the built-ins.
+func DefaultRegistry() *Registry {
+	r := NewRegistry()
+	r.register("print", parsePrint, "print [text...]", "print text, expanding $name variables")
+	r.register("printf", parsePrintf, "printf <format> [args...]", "print args formatted by format, using %d, %x and %s")
+	r.register("error", parseError, "error <text...>", "report text as an error on stderr")
+	r.register("add", parseAdd, "add <a> <b> [c...]", "print a + b, plus any further operands")
+	r.register("sub", parseArithmetic("sub", func(arg1, arg2 operand) Command { return &subCommand{arg1, arg2} }), "sub <a> <b>", "print a - b")
+	r.register("mul", parseArithmetic("mul", func(arg1, arg2 operand) Command { return &mulCommand{arg1, arg2} }), "mul <a> <b>", "print a * b")
+	r.register("div", parseArithmetic("div", func(arg1, arg2 operand) Command { return &divCommand{arg1, arg2} }), "div <a> <b>", "print a / b, truncated towards zero")
+	r.register("mod", parseArithmetic("mod", func(arg1, arg2 operand) Command { return &modCommand{arg1, arg2} }), "mod <a> <b>", "print the remainder of a / b, with the sign of a")
+	r.register("pow", parseArithmetic("pow", func(arg1, arg2 operand) Command { return &powCommand{arg1, arg2} }), "pow <base> <exp>", "print base raised to the power exp")
+	r.register("neg", parseNeg, "neg <a>", "print -a")
+	r.register("min", parseStoredArithmetic("min", func(dest string, arg1, arg2 operand) Command { return &minCommand{dest, arg1, arg2} }), "min <var> <a> <b>", "store the smaller of a and b in var")
+	r.register("max", parseStoredArithmetic("max", func(dest string, arg1, arg2 operand) Command { return &maxCommand{dest, arg1, arg2} }), "max <var> <a> <b>", "store the larger of a and b in var")
+	r.register("sum", parseSum, "sum <var> [a...]", "store the total of the operands in var, 0 if there are none")
+	r.register("abs", parseAbs, "abs <var> <a>", "store the absolute value of a in var")
+	r.register("addf", parseFloatArithmetic("addf", func(arg1, arg2 floatOperand) Command { return &addfCommand{arg1, arg2} }), "addf <a> <b>", "print a + b as a float")
+	r.register("subf", parseFloatArithmetic("subf", func(arg1, arg2 floatOperand) Command { return &subfCommand{arg1, arg2} }), "subf <a> <b>", "print a - b as a float")
+	r.register("mulf", parseFloatArithmetic("mulf", func(arg1, arg2 floatOperand) Command { return &mulfCommand{arg1, arg2} }), "mulf <a> <b>", "print a * b as a float")
+	r.register("divf", parseFloatArithmetic("divf", func(arg1, arg2 floatOperand) Command { return &divfCommand{arg1, arg2} }), "divf <a> <b>", "print a / b as a float")
+	r.register("sleep", parseSleep, "sleep <ms>", "block the loop for ms milliseconds")
+	r.register("waitsignal", parseSignal("waitsignal", func(name string) Command { return &waitsignalCommand{name} }), "waitsignal <name>", "block the loop until a signal is sent to name, unless one was sent already")
+	r.register("signal", parseSignal("signal", func(name string) Command { return &signalCommand{name} }), "signal <name>", "send a signal to name, releasing a waitsignal")
+	r.registerWith("after", (*Registry).parseAfter, "after <ms> <command...>", "run command after ms milliseconds without blocking")
+	r.registerWith("timeout", (*Registry).parseTimeout, "timeout <ms> <command...>", "run command, giving up on it with an error after ms milliseconds")
+	r.registerWith("retry", (*Registry).parseRetry, "retry <n> [ms] <command...>", "run command again, up to n more times, while it fails, waiting ms milliseconds before the first retry and twice as long before each next one, up to an hour")
+	r.registerWith("repeat", (*Registry).parseRepeat, "repeat <n> <command...>", "run command n times")
+	r.register("reduce", parseReduce, "reduce <dest> <start> <end> <+|*|min|max> <init>", "fold the operator over the integers from start to end, starting from init, into dest")
+	r.registerWith("foreach", (*Registry).parseForeach, "foreach <var> <start> <end> <command...>", "run command for every integer from start to end, counting down if start is above end, with var set to it")
+	r.registerWith("whendef", (*Registry).parseWhendef, "whendef <name> <command...>", "run command if the define name was given, as with -D name=value")
+	r.registerWith("if", (*Registry).parseIf, "if <var> <op> <value> <command...>", "run command if the comparison holds (op is eq, ne, lt, le, gt or ge)")
+	r.register("label", parseLabel, "label <name>", "mark a position in the file for goto")
+	r.register("goto", parseGoto, "goto <label>", "continue the file at label")
+	r.registerWith("include", (*Registry).parseInclude, "include <path>", "run the instruction file at path, relative to the including file")
+	r.registerWith("eval-commands", (*Registry).parseEvalCommands, "eval-commands <var>", "run the instruction lines in string var, like an include of a file holding them")
+	r.register("exec", parseExec, "exec <program> [args...]", "run program and print its output")
+	r.register("capture", parseCapture, "capture <var> <program> [args...]", "run program and store its output in var")
+	r.register("readfile", parseReadfile, "readfile <var> <path>", "store the contents of file path in var")
+	r.register("writefile", parseWritefile, "writefile <path> <var>", "write the value of var to file path")
+	r.register("push", parsePush, "push <n>", "push n onto the stack")
+	r.register("pop", parsePop, "pop <var>", "move the top of the stack into var")
+	r.register("op", parseOp, "op <+|-|*|/>", "replace the two topmost values of the stack with their sum, difference, product or quotient")
+	r.register("eval", parseEval, "eval <var> <expr...>", "store the value of an expression like (x + 2) * 3 in var")
+	r.register("now", parseNow, "now <var> [unix|unixmilli|unixnano|rfc3339|rfc3339nano]", "store the current time in var, in Unix seconds by default")
+	r.register("tic", parseTic("tic", func(label string) Command { return &ticCommand{label} }), "tic <label>", "start timing label")
+	r.register("toc", parseTic("toc", func(label string) Command { return &tocCommand{label} }), "toc <label>", "print the time elapsed since tic label")
+	r.registerWith("priority", (*Registry).parsePriority, "priority <n> <command...>", "queue command ahead of those of a lower priority; the default is 0")
+	r.registerWith("route", (*Registry).parseRoute, "route <loop> <command...>", "post command to the loop named loop instead of this one")
+	r.register("set", parseSet, "set <var> <value>", "store an integer, a float or a string in var")
+	r.register("inc", parseInc("inc", 1), "inc <var>", "add 1 to var, starting from 0 if it is undefined")
+	r.register("dec", parseInc("dec", -1), "dec <var>", "subtract 1 from var, starting from 0 if it is undefined")
+	r.register("addto", parseAddto, "addto <var> <amount>", "add amount to var, starting from 0 if it is undefined")
+	r.register("rand", parseRand, "rand <var> <min> <max>", "store a random integer between min and max, inclusive, in var")
+	r.register("getenv", parseGetenv, "getenv <var> <ENVNAME>", "store the integer in environment variable ENVNAME in var")
+	r.register("concat", parseConcat, "concat <var> <a> <b>", "store the text a followed by b in var; $name stands for a variable")
+	r.register("len", parseLen, "len <dest> <src>", "store the number of characters in src in dest")
+	r.register("upper", parseText("upper"), "upper <dest> <src>", "store the text of src in upper case in dest")
+	r.register("lower", parseText("lower"), "lower <dest> <src>", "store the text of src in lower case in dest")
+	r.register("reverse", parseText("reverse"), "reverse <dest> <src>", "store the text of src backwards in dest")
+	r.register("split", parseSplit, "split <prefix> <src> <sep>", "store the pieces of src between seps in prefix0, prefix1... and their count in prefixN")
+	r.register("join", parseJoin, "join <dest> <sep> [vars...]", "store the text of vars separated by sep in dest")
+	r.register("sort", parseSort, "sort <prefix> [numeric|text]", "sort the variables prefix0, prefix1... counted by prefixN, as left by split, in numeric order by default")
+	r.register("hash", parseHash, "hash <dest> <src> <crc32|sha256>", "store the hex digest of the text of string src in dest")
+	r.register("tobase", parseTobase, "tobase <dest> <n> <base>", "store the digits of integer n in base 2 to 36 in dest")
+	r.register("frombase", parseFrombase, "frombase <dest> <src> <base>", "store the integer written in base 2 to 36 in string src in dest")
+	r.register("unset", parseUnset, "unset <var>", "remove var, if it is defined")
+	r.register("dumpvars", parseDumpvars, "dumpvars", "print every variable as name=value, sorted by name")
+	r.register("savevars", parseSavevars("savevars", func(name string) Command { return &savevarsCommand{name} }), "savevars <name>", "save a copy of every variable as name")
+	r.register("loadvars", parseSavevars("loadvars", func(name string) Command { return &loadvarsCommand{name} }), "loadvars <name>", "replace the variables with those saved as name")
+	r.register("cp", parseCopy("cp", false), "cp <dest> <src>", "set dest to the value of src")
+	r.register("mv", parseCopy("mv", true), "mv <dest> <src>", "set dest to the value of src and remove src")
+	r.register("swap", parseSwap, "swap <a> <b>", "exchange the values of variables a and b")
+	r.register("read", parseRead, "read <var>", "store the next line of input in var, waiting for it")
+	r.register("get", parseGet, "get <var>", "print the value of var")
+	r.registerBlock("while", "endwhile", parseWhile, "while <var> <op> <value> ... endwhile", "run the commands up to endwhile for as long as the comparison holds")
+	r.registerBlock("def", "enddef", parseDef, "def <name> ... enddef", "define the commands up to enddef as macro name")
+	r.registerBlock("parallel", "endparallel", parseParallel, "parallel [<command> ; ...] ... endparallel", "run the commands up to endparallel, or those on the line separated by ';', at the same time, waiting for all of them to finish")
+	r.setParser("parallel", (*Registry).parseParallelLine)
+	r.registerBlock("batch", "endbatch", parseBatch, "batch ... endbatch", "queue the commands up to endbatch together, with nothing posted in between")
+	r.register("call", parseCall, "call <name>", "run the commands of macro name in place")
+	r.register("clear", parseClear, "clear", "discard the commands queued so far")
+	r.register("cancel", parseCancel, "cancel <id>", "discard the queued command posted with id, if it hasn't started yet")
+	r.register("cancelscheduled", parseCancelscheduled, "cancelscheduled", "cancel the commands of after that haven't run yet")
+	r.register("nop", parseNop, "nop", "do nothing")
+	r.register("barrier", parseBarrier, "barrier", "wait for the commands before it to finish before starting those after it")
+	r.register("flush", parseFlush, "flush", "write out the output printed so far, if it is buffered")
+	r.register("qdepth", parseQdepth, "qdepth", "print how many commands are queued behind this one")
+	r.register("trace", parseTrace, "trace", "print the commands executed so far, if the loop records them")
+	r.register("throughput", parseThroughput, "throughput <ms>", "print how many commands execute in the next ms milliseconds, and the rate per second")
+	r.register("stats", parseStats, "stats", "print the execution metrics as JSON")
+	r.register("exit", parseExit, "exit <code>", "stop and exit with status code")
+	r.register("cmp", parseCmp, "cmp <var> <a> <op> <b>", "store 1 in var if the comparison holds, 0 otherwise")
+	r.register("and", parseStoredArithmetic("and", func(dest string, arg1, arg2 operand) Command { return &logicCommand{"and", dest, arg1, arg2} }), "and <var> <a> <b>", "store 1 in var if a and b are both nonzero, 0 otherwise")
+	r.register("or", parseStoredArithmetic("or", func(dest string, arg1, arg2 operand) Command { return &logicCommand{"or", dest, arg1, arg2} }), "or <var> <a> <b>", "store 1 in var if a or b is nonzero, 0 otherwise")
+	r.register("not", parseNot, "not <var> <a>", "store 1 in var if a is 0, 0 otherwise")
+	r.register("defined", parseDefined, "defined <var> <name>", "store 1 in var if variable name is defined, 0 otherwise")
+	r.register("select", parseSelect, "select <var> <cond> <a> <b>", "store a in var if cond is nonzero, b otherwise")
+	r.register("stopif", parseStopif, "stopif <var> <op> <value>", "stop, discarding the queued commands, if the comparison holds")
+	r.register("assert", parseAssert, "assert <var> <op> <value>", "fail with exit status 1 unless the comparison holds")
+	r.register("require", parseRequire, "require <name>:<type>...", "fail with exit status 1 for every variable that is undefined or not of its type (int, float or string)")
+	r.register("assertempty", parseAssertempty, "assertempty", "fail with exit status 1 if any command is queued behind this one")
+	r.registerWith("alias", (*Registry).parseAlias, "alias <name> <command>", "make name another name for command in the lines that follow")
+	r.registerWith("help", (*Registry).parseHelp, "help [command]", "list the commands, or describe one")
+	return r
+}
+
+// register adds a built-in command together with its help.
+func (r *Registry) register(name string, parse ParseFunc, usage, summary string) {
+	r.Register(name, parse)
+	r.SetHelp(name, usage, summary)
+}
+
+// registerWith is register for a command parsed with the registry it is
+// looked up in.
+func (r *Registry) registerWith(name string, parse registryParseFunc, usage, summary string) {
+	r.setParser(name, parse)
+	r.SetHelp(name, usage, summary)
+}
+
+// registerBlock adds a built-in block, which runs from a line starting with
+// name to one holding only end.
+func (r *Registry) registerBlock(name, end string, parse blockFunc, usage, summary string) {
+	r.mu.Lock()
+	r.blocks[name] = blockSpec{end: end, parse: parse}
+	r.mu.Unlock()
+	r.SetHelp(name, usage, summary)
+}
+
+// Register makes the command name available, replacing any previous parser
+// registered under the same name.
+func (r *Registry) Register(name string, parse ParseFunc) {
+	r.setParser(name, func(_ *Registry, args []string) (Command, error) {
+		return parse(args)
+	})
+}
+
+func (r *Registry) setParser(name string, parse registryParseFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.parsers[name] = parse
+}
+
+// SetHelp describes the command name to the help command: usage shows its
+// arguments, like "add <a> <b>", and summary says what it does.
+func (r *Registry) SetHelp(name, usage, summary string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.help[name] = commandHelp{usage: usage, summary: summary}
+}
+
+// Names returns the registered command names in alphabetical order.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.parsers)+len(r.blocks))
+	for name := range r.parsers {
+		names = append(names, name)
+	}
+	for name := range r.blocks {
+		if _, ok := r.parsers[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (r *Registry) lookupHelp(name string) commandHelp {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	name = r.resolveLocked(name)
+	if h, ok := r.help[name]; ok {
+		return h
+	}
+	return commandHelp{usage: name}
+}
+
+// Alias makes name another name for the command target, which may itself be
+// an alias. An alias takes precedence over a command of the same name, so it
+// can shadow a built-in. It fails if target is unknown or the alias would
+// form a cycle.
+func (r *Registry) Alias(name, target string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for t := target; ; {
+		if t == name {
+			return fmt.Errorf(AliasCycleError, name)
+		}
+		next, ok := r.aliases[t]
+		if !ok {
+			break
+		}
+		t = next
+	}
+	resolved := r.resolveLocked(target)
+	_, isCommand := r.parsers[resolved]
+	_, isBlock := r.blocks[resolved]
+	if !isCommand && !isBlock {
+		return fmt.Errorf(UnknownCommandError, target)
+	}
+	r.aliases[name] = target
+	return nil
+}
+
+// resolveLocked follows aliases from name to a command name.
+func (r *Registry) resolveLocked(name string) string {
+	for {
+		target, ok := r.aliases[name]
+		if !ok {
+			return name
+		}
+		name = target
+	}
+}
+
+func (r *Registry) lookup(name string) (registryParseFunc, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	parse, ok := r.parsers[r.resolveLocked(name)]
+	return parse, ok
+}
+
+func (r *Registry) lookupBlock(name string) (blockSpec, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	spec, ok := r.blocks[r.resolveLocked(name)]
+	return spec, ok
+}
+
+// isBlockEnd reports whether name ends one of the registered blocks.
+func (r *Registry) isBlockEnd(name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, spec := range r.blocks {
+		if spec.end == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse builds the command described by line, which can't start a block; see
+// LineParser for that. Fields are separated by
+// whitespace unless double-quoted, and everything from an unquoted field that
+// starts with '#' onwards is a comment; blank and comment-only lines yield a
+// nil command and a nil error.
+func (r *Registry) Parse(line string) (Command, error) {
+	parts, seps, err := tokenizeInstruction(line)
+	if err != nil {
+		return nil, err
+	}
+	if len(parts) == 0 {
+		return nil, nil
+	}
+	return r.scope().parseInstruction(parts, seps)
+}
+
+// parseInstruction parses the fields of a whole instruction, seps being the
+// indexes of those separating the commands of a parallel on one line.
+func (r *Registry) parseInstruction(parts []string, seps []int) (Command, error) {
+	if len(parts) > 1 && r.isParallel(parts[0]) {
+		shifted := make([]int, len(seps))
+		for i, sep := range seps {
+			shifted[i] = sep - 1
+		}
+		return r.parseParallelFields(parts[1:], shifted)
+	}
+	return r.parseFields(parts)
+}
+
+// parseFields parses a command that has already been split into fields. It is
+// used by commands that wrap another command.
+func (r *Registry) parseFields(parts []string) (Command, error) {
+	command, args := parts[0], parts[1:]
+
+	parse, ok := r.lookup(command)
+	if _, isBlock := r.lookupBlock(command); !ok && isBlock {
+		return nil, fmt.Errorf(BlockNotOnOwnLineError, command)
+	}
+	if !ok {
+		return nil, fmt.Errorf(UnknownCommandError, command)
+	}
+	return parse(r, args)
+}
+
+var builtins = DefaultRegistry()
+
+// Alias defines an alias among the built-in commands; see Registry.Alias. It
+// is meant for setting up a program, like the -alias flag does: unlike an
+// alias instruction, it applies to every input parsed after it.
+func Alias(name, target string) error {
+	return builtins.Alias(name, target)
+}
+
+// Parse parses line using the built-in commands only.
+func Parse(line string) (Command, error) {
+	return builtins.Parse(line)
+}
@@ -0,0 +1,128 @@
+package eventloop
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRegisterCustomCommand(t *testing.T) {
+	var calls atomic.Int64
+	r := DefaultRegistry()
+	r.Register("count", func(args []string) (Command, error) {
+		if len(args) != 0 {
+			return nil, fmt.Errorf(AmbiguousArgsNumberError, "count")
+		}
+		return countCommand{&calls}, nil
+	})
+
+	cmd, err := r.Parse("count")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Parse("count 1"); err == nil {
+		t.Error("the custom parser's error wasn't returned")
+	}
+	if _, err := Parse("count"); err == nil || !strings.Contains(err.Error(), "unknown command") {
+		t.Errorf("Parse(\"count\") with the built-ins = %v, want an unknown command", err)
+	}
+
+	var out, errs syncBuffer
+	l := newTestLoop(&out, &errs)
+	l.Start()
+	l.Post(cmd)
+	l.Post(cmd)
+	l.AwaitFinish()
+	if n := calls.Load(); n != 2 {
+		t.Errorf("custom command executed %d times, want 2", n)
+	}
+}
+
+// runScriptWith runs script in the language of r.
+func runScriptWith(t *testing.T, r *Registry, script string) string {
+	t.Helper()
+
+	var out, errs syncBuffer
+	l := newTestLoop(&out, &errs)
+	l.Start()
+	postScriptWith(t, l, r.LineParser(), script)
+	l.AwaitFinish()
+	if errs.String() != "" {
+		t.Errorf("errors of %q = %q", script, errs.String())
+	}
+	return out.String()
+}
+
+func TestAlias(t *testing.T) {
+	r := DefaultRegistry()
+	if err := r.Alias("p", "print"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Alias("+", "add"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := runScriptWith(t, r, "p hi\n+ 1 2"), "hi\n3\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+	// The alias command takes effect on the lines that follow it.
+	if got, want := runScriptWith(t, DefaultRegistry(), "alias say print\nsay hello"), "hello\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+	if err := r.Alias("x", "frob"); err == nil {
+		t.Error("an alias of an unknown command was accepted")
+	}
+	if _, err := Parse("p hi"); err == nil {
+		t.Error("an alias leaked into the built-in registry")
+	}
+}
+
+func TestAliasScopedToInput(t *testing.T) {
+	r := DefaultRegistry()
+	// An alias applies to the commands wrapped by the lines that follow too.
+	if got, want := runScriptWith(t, r, "alias say print\nrepeat 2 say hi"), "hi\nhi\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+	if _, err := r.Parse("say hi"); err == nil {
+		t.Error("an alias instruction leaked into its registry")
+	}
+	p := r.LineParser()
+	if _, err := p.Parse("alias say print"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.LineParser().Parse("say hi"); err == nil {
+		t.Error("an alias instruction leaked into another parser")
+	}
+	if _, err := p.Parse("say hi"); err != nil {
+		t.Errorf("Parse after the alias: %v", err)
+	}
+}
+
+func TestAliasShadowsBuiltin(t *testing.T) {
+	r := DefaultRegistry()
+	if err := r.Alias("sub", "add"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := runScriptWith(t, r, "sub 5 2"), "7\n"; got != want {
+		t.Errorf("output = %q, want the alias to take precedence", got)
+	}
+}
+
+func TestAliasCycle(t *testing.T) {
+	r := DefaultRegistry()
+	if err := r.Alias("a", "print"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Alias("b", "a"); err != nil {
+		t.Fatal(err)
+	}
+	for _, alias := range [][2]string{{"a", "b"}, {"print", "b"}, {"c", "c"}} {
+		err := r.Alias(alias[0], alias[1])
+		if want := fmt.Sprintf(AliasCycleError, alias[0]); err == nil || err.Error() != want {
+			t.Errorf("Alias(%q, %q) = %v, want %q", alias[0], alias[1], err, want)
+		}
+	}
+	if got, want := runScriptWith(t, r, "b hi"), "hi\n"; got != want {
+		t.Errorf("output = %q, want the aliases kept as they were", got)
+	}
+}
@@ -0,0 +1,185 @@
+package eventloop
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const InvalidRetryCountError string = "SYNTAX ERROR: retry count '%v' must be between 1 and %v"
+
+// MaxRetries is the largest count accepted by retry.
+const MaxRetries = 100
+
+// MaxRetryBackoff is as long as doubling the backoff of retry makes it.
+const MaxRetryBackoff = time.Hour
+
+// MARK: - Retry
+
+// retryCommand executes cmd in place and, as long as it reports an error,
+// executes it again, up to n more times. With a backoff the worker waits
+// that long before the first retry, and twice as long before every further
+// one, up to MaxRetryBackoff. The errors of an attempt are only reported if
+// it is the last one; anything else the failed attempts posted, such as
+// prints, stays posted. It gives up early once the loop stops, even while
+// waiting.
+type retryCommand struct {
+	n       int
+	backoff time.Duration
+	cmd     Command
+}
+
+func (r *retryCommand) attrs() []any {
+	return []any{"retries", r.n, "backoff", r.backoff}
+}
+
+func (r *retryCommand) Execute(handler Handler) {
+	h, found := findHandler[workerHandler](handler)
+	backoff := r.backoff
+	for i := 0; ; i++ {
+		attempt := &retryHandler{Handler: handler}
+		r.cmd.Execute(attempt)
+		errs := attempt.failures()
+		if len(errs) == 0 {
+			return
+		}
+		if i == r.n || (found && h.Stopped()) || !r.wait(h, found, backoff) {
+			for _, e := range errs {
+				handler.Post(e)
+			}
+			return
+		}
+		backoff = nextBackoff(backoff)
+	}
+}
+
+// wait waits out backoff before a retry, on the loop's halt if the command
+// runs on a worker, and reports whether the loop is still running.
+func (r *retryCommand) wait(h workerHandler, found bool, backoff time.Duration) bool {
+	if backoff <= 0 {
+		return true
+	}
+	if !found {
+		time.Sleep(backoff)
+		return true
+	}
+	return h.halt.wait(backoff)
+}
+
+// nextBackoff doubles backoff up to MaxRetryBackoff; one already longer,
+// given as such, stays as it is.
+func nextBackoff(backoff time.Duration) time.Duration {
+	if backoff >= MaxRetryBackoff {
+		return backoff
+	}
+	return min(2*backoff, MaxRetryBackoff)
+}
+
+// retryHandler keeps back the errors posted by an attempt of retry.
+type retryHandler struct {
+	Handler
+	errors []Command
+	mu     sync.Mutex
+}
+
+func (h *retryHandler) unwrap() Handler {
+	return h.Handler
+}
+
+func (h *retryHandler) Post(cmd Command) {
+	if _, ok := cmd.(*errorCommand); !ok {
+		h.Handler.Post(cmd)
+		return
+	}
+	// An abandoned timeout may post from a goroutine of its own.
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.errors = append(h.errors, cmd)
+}
+
+func (h *retryHandler) failures() []Command {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.errors
+}
+
+// halt is closed once the loop stops, so that a command waiting out a delay
+// on the worker, like the backoff of retry, can give up on it.
+type halt struct {
+	done   chan struct{}
+	closed bool
+	mu     sync.Mutex
+}
+
+func newHalt() *halt {
+	return &halt{done: make(chan struct{})}
+}
+
+// wait blocks for d and reports whether it did so without the halt closing
+// meanwhile.
+func (h *halt) wait(d time.Duration) bool {
+	h.mu.Lock()
+	done := h.done
+	h.mu.Unlock()
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-done:
+		return false
+	}
+}
+
+func (h *halt) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !h.closed {
+		h.closed = true
+		close(h.done)
+	}
+}
+
+// reset opens a closed halt again.
+func (h *halt) reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		h.closed = false
+		h.done = make(chan struct{})
+	}
+}
+
+// parseRetry accepts "retry <n> [backoff] <command...>": no command name is
+// a number, so a number ahead of the command is the backoff in milliseconds.
+func (r *Registry) parseRetry(args []string) (Command, error) {
+	if len(args) < 2 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "retry")
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 1 || n > MaxRetries {
+		return nil, fmt.Errorf(InvalidRetryCountError, args[0], MaxRetries)
+	}
+	args = args[1:]
+	var backoff time.Duration
+	if _, err := strconv.ParseInt(args[0], 10, 64); err == nil {
+		if backoff, err = parseMillis(args[0]); err != nil {
+			return nil, err
+		}
+		if args = args[1:]; len(args) == 0 {
+			return nil, fmt.Errorf(AmbiguousArgsNumberError, "retry")
+		}
+	}
+	cmd, err := r.parseFields(args)
+	if err != nil {
+		return nil, err
+	}
+	return &retryCommand{n: n, backoff: backoff, cmd: cmd}, nil
+}
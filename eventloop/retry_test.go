@@ -0,0 +1,109 @@
+package eventloop
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// flakyCommand fails its first fails executions and prints ok after that,
+// counting them all in calls.
+type flakyCommand struct {
+	fails int
+	calls *int
+}
+
+func (c flakyCommand) Execute(handler Handler) {
+	*c.calls++
+	if *c.calls <= c.fails {
+		handler.Post(&errorCommand{msg: fmt.Sprintf("attempt %d failed", *c.calls)})
+		return
+	}
+	fmt.Fprintln(handler.Output(), "ok")
+}
+
+func runRetry(t *testing.T, cmd *retryCommand) (out, errs string) {
+	t.Helper()
+
+	var outBuf, errsBuf syncBuffer
+	l := newTestLoop(&outBuf, &errsBuf)
+	l.Start()
+	l.Post(cmd)
+	l.AwaitFinish()
+	return outBuf.String(), errsBuf.String()
+}
+
+func TestRetry(t *testing.T) {
+	var calls int
+	out, errs := runRetry(t, &retryCommand{n: 3, cmd: flakyCommand{fails: 2, calls: &calls}})
+	if calls != 3 {
+		t.Errorf("executed %d times, want 3", calls)
+	}
+	if out != "ok\n" || errs != "" {
+		t.Errorf("output = %q, errors = %q, want only ok", out, errs)
+	}
+}
+
+func TestRetryExhausted(t *testing.T) {
+	var calls int
+	out, errs := runRetry(t, &retryCommand{n: 2, cmd: flakyCommand{fails: 10, calls: &calls}})
+	if calls != 3 {
+		t.Errorf("executed %d times, want 3", calls)
+	}
+	// Only the errors of the last attempt are reported.
+	if out != "" || errs != "attempt 3 failed\n" {
+		t.Errorf("output = %q, errors = %q, want the error of attempt 3", out, errs)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	var calls int
+	start := time.Now()
+	runRetry(t, &retryCommand{n: 2, backoff: 10 * time.Millisecond, cmd: flakyCommand{fails: 10, calls: &calls}})
+	// 10ms before the first retry and 20ms before the second.
+	if d := time.Since(start); d < 30*time.Millisecond {
+		t.Errorf("retries took %v, want at least 30ms", d)
+	}
+}
+
+func TestRetryScript(t *testing.T) {
+	checkOutput(t, "retry 2 5 add 1 2\nretry 2 div 1 0", "3\n", "line 2: "+DivisionByZeroError+"\n")
+}
+
+func TestRetryStopDuringBackoff(t *testing.T) {
+	var calls int
+	var out, errs syncBuffer
+	l := newTestLoop(&out, &errs)
+	l.Start()
+	l.Post(&retryCommand{n: 2, backoff: time.Hour, cmd: flakyCommand{fails: 10, calls: &calls}})
+	start := time.Now()
+	time.Sleep(20 * time.Millisecond)
+	l.Stop()
+	l.AwaitFinish()
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Stop took %v to end the backoff", d)
+	}
+	if calls != 1 {
+		t.Errorf("executed %d times, want no retry after Stop", calls)
+	}
+}
+
+func TestNextBackoff(t *testing.T) {
+	for _, tt := range []struct{ backoff, want time.Duration }{
+		{time.Second, 2 * time.Second},
+		{40 * time.Minute, MaxRetryBackoff},
+		{MaxRetryBackoff, MaxRetryBackoff},
+		{2 * MaxRetryBackoff, 2 * MaxRetryBackoff},
+	} {
+		if got := nextBackoff(tt.backoff); got != tt.want {
+			t.Errorf("nextBackoff(%v) = %v, want %v", tt.backoff, got, tt.want)
+		}
+	}
+	backoff := time.Millisecond
+	for range MaxRetries {
+		backoff = nextBackoff(backoff)
+	}
+	if backoff != MaxRetryBackoff {
+		t.Errorf("backoff after %d retries = %v, want %v", MaxRetries, backoff, MaxRetryBackoff)
+	}
+}
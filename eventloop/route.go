@@ -0,0 +1,63 @@
+package eventloop
+
+import "fmt"
+
+const UnknownRouteError string = "error: route: no loop named %v"
+
+// MARK: - Routes
+
+// WithRoute lets the route command post to child under the given name, e.g.
+// to pass work on to the next stage of a pipeline. The child has its own
+// queue, variables and output, and must be started separately.
+func WithRoute(name string, child *EventLoop) Option {
+	return func(l *EventLoop) {
+		if l.routes == nil {
+			l.routes = make(map[string]*EventLoop)
+		}
+		l.routes[name] = child
+	}
+}
+
+// WithAwaitRoutes makes AwaitFinish wait for the loops added by WithRoute to
+// finish as well, after the loop itself has, so that the commands it routed
+// to them have executed. The children must not route back to the loop.
+func WithAwaitRoutes(wait bool) Option {
+	return func(l *EventLoop) {
+		l.awaitRoutes = wait
+	}
+}
+
+// routeCommand posts cmd to another loop instead of the current one. Posting
+// blocks while the other loop's queue is full.
+type routeCommand struct {
+	loop string
+	cmd  Command
+}
+
+func (r *routeCommand) attrs() []any {
+	return []any{"loop", r.loop}
+}
+
+func (r *routeCommand) Execute(handler Handler) {
+	h, ok := findHandler[workerHandler](handler)
+	if !ok {
+		return
+	}
+	child, ok := h.routes[r.loop]
+	if !ok {
+		handler.Post(&errorCommand{msg: fmt.Sprintf(UnknownRouteError, r.loop)})
+		return
+	}
+	child.Post(r.cmd)
+}
+
+func (r *Registry) parseRoute(args []string) (Command, error) {
+	if len(args) < 2 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "route")
+	}
+	cmd, err := r.parseFields(args[1:])
+	if err != nil {
+		return nil, err
+	}
+	return &routeCommand{loop: args[0], cmd: cmd}, nil
+}
@@ -0,0 +1,30 @@
+package eventloop
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRoute(t *testing.T) {
+	var outA, errsA, outB, errsB syncBuffer
+	b := newTestLoop(&outB, &errsB)
+	a := newTestLoop(&outA, &errsA, WithRoute("b", b), WithAwaitRoutes(true))
+	b.Start()
+	a.Start()
+	postScript(t, a, "print from-a\nroute b print from-b\nroute b add 1 2\nroute c print lost")
+	a.AwaitFinish()
+
+	if got, want := outA.String(), "from-a\n"; got != want {
+		t.Errorf("output of a = %q, want %q", got, want)
+	}
+	if got, want := errsA.String(), "line 4: "+fmt.Sprintf(UnknownRouteError, "c")+"\n"; got != want {
+		t.Errorf("errors of a = %q, want %q", got, want)
+	}
+	// AwaitFinish of a waited for b to run what was routed to it.
+	if got, want := outB.String(), "from-b\n3\n"; got != want {
+		t.Errorf("output of b = %q, want %q", got, want)
+	}
+	if errsB.String() != "" {
+		t.Errorf("errors of b = %q", errsB.String())
+	}
+}
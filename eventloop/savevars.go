@@ -0,0 +1,88 @@
+package eventloop
+
+import (
+	"fmt"
+	"maps"
+	"sync"
+)
+
+const UnknownSnapshotError string = "error: no saved variables named %v"
+
+// MARK: - Saved variables
+
+// savedVars holds the copies of the variable store taken by savevars, by
+// name. Values hold no references, so a copy of the map is a deep copy.
+type savedVars struct {
+	vars map[string]map[string]Value
+	mu   sync.Mutex
+}
+
+func newSavedVars() *savedVars {
+	return &savedVars{vars: make(map[string]map[string]Value)}
+}
+
+func (s *savedVars) save(name string, vars map[string]Value) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.vars[name] = vars
+}
+
+// load returns a copy of the variables saved as name, so that the saved ones
+// stay as they were whatever happens to the copy.
+func (s *savedVars) load(name string) (map[string]Value, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	vars, ok := s.vars[name]
+	return maps.Clone(vars), ok
+}
+
+// savevarsCommand saves a copy of every variable as name, replacing anything
+// saved as name before.
+type savevarsCommand struct {
+	name string
+}
+
+func (s *savevarsCommand) attrs() []any {
+	return []any{"name", s.name}
+}
+
+func (s *savevarsCommand) Execute(handler Handler) {
+	if h, ok := findHandler[workerHandler](handler); ok {
+		h.saved.save(s.name, handler.Vars().Snapshot())
+	}
+}
+
+// loadvarsCommand replaces the variables with those saved as name: the
+// variables defined since are removed and the others get their saved value
+// back. The saved copy stays, so that it can be loaded again.
+type loadvarsCommand struct {
+	name string
+}
+
+func (l *loadvarsCommand) attrs() []any {
+	return []any{"name", l.name}
+}
+
+func (l *loadvarsCommand) Execute(handler Handler) {
+	h, ok := findHandler[workerHandler](handler)
+	var vars map[string]Value
+	if ok {
+		vars, ok = h.saved.load(l.name)
+	}
+	if !ok {
+		handler.Post(&errorCommand{msg: fmt.Sprintf(UnknownSnapshotError, l.name)})
+		return
+	}
+	handler.Vars().replace(vars)
+}
+
+func parseSavevars(command string, build func(name string) Command) ParseFunc {
+	return func(args []string) (Command, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf(AmbiguousArgsNumberError, command)
+		}
+		return build(args[0]), nil
+	}
+}
@@ -0,0 +1,19 @@
+package eventloop
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSaveLoadVars(t *testing.T) {
+	script := "set a 1\nset s x\nsavevars cp\nset a 2\nset b 3\nunset s\nloadvars cp\ndumpvars"
+	checkOutput(t, script, "a=1\ns=x\n", "")
+
+	// A snapshot can be restored more than once, and saving again replaces it.
+	script = "set a 1\nsavevars cp\ninc a\nloadvars cp\ninc a\nloadvars cp\nget a\nset a 5\nsavevars cp\nset a 6\nloadvars cp\nget a"
+	checkOutput(t, script, "1\n5\n", "")
+}
+
+func TestLoadVarsUnknown(t *testing.T) {
+	checkOutput(t, "set a 1\nloadvars nope\nget a", "1\n", "line 2: "+fmt.Sprintf(UnknownSnapshotError, "nope")+"\n")
+}
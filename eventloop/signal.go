@@ -0,0 +1,167 @@
+package eventloop
+
+import (
+	"fmt"
+	"sync"
+)
+
+const WaitsignalDeadlockError = "error: waitsignal %v: only a signal queued behind it could release it, and no worker is left to run it"
+
+// MARK: - Signals
+
+// signals counts the signals sent to each name that no waitsignal has taken
+// yet, and the waitsignal commands waiting for one.
+type signals struct {
+	pending map[string]int
+	waiting int
+	mu      sync.Mutex
+	sent    *sync.Cond
+}
+
+func newSignals() *signals {
+	s := &signals{pending: make(map[string]int)}
+	s.sent = sync.NewCond(&s.mu)
+	return s
+}
+
+func (s *signals) send(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pending[name]++
+	s.sent.Broadcast()
+}
+
+// wait takes a signal sent to name, waiting for one if there is none yet,
+// and reports whether it did. It gives up once stopped reports true, which it
+// checks whenever woken up, and without waiting if stuck reports true for
+// the number of waiters including this one.
+func (s *signals) wait(name string, stopped func() bool, stuck func(waiting int) bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.pending[name] == 0 && stuck(s.waiting+1) {
+		return false
+	}
+	s.waiting++
+	defer func() { s.waiting-- }()
+	for s.pending[name] == 0 {
+		if stopped() {
+			return false
+		}
+		s.sent.Wait()
+	}
+	if s.pending[name]--; s.pending[name] == 0 {
+		delete(s.pending, name)
+	}
+	return true
+}
+
+// wake has the waiters check whether the loop has stopped.
+func (s *signals) wake() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sent.Broadcast()
+}
+
+// Signal sends a signal to name, releasing a waitsignal command waiting on
+// it. Signals are never dropped: one sent while no command waits is kept
+// for the next waitsignal on name, which then returns at once, and every
+// signal releases a single waitsignal. It is safe to call from any
+// goroutine.
+func (l *EventLoop) Signal(name string) {
+	l.signals.send(name)
+}
+
+// waitsignalCommand blocks the worker until a signal is sent to name, by
+// Signal or a signal command, taking it. As the worker executes nothing
+// meanwhile, a signal command queued behind it can only release it while
+// another worker is free, so with every worker waiting it reports an error
+// instead of blocking on such a signal. It also returns if the loop is
+// stopped.
+type waitsignalCommand struct {
+	name string
+}
+
+func (w *waitsignalCommand) attrs() []any {
+	return []any{"name", w.name}
+}
+
+func (w *waitsignalCommand) Execute(handler Handler) {
+	h, ok := findHandler[workerHandler](handler)
+	if !ok {
+		return
+	}
+	flushOutput(handler)
+	stuck := func(waiting int) bool {
+		return waiting >= h.workers && signalQueued(handler, h, w.name)
+	}
+	if !h.signals.wait(w.name, h.Stopped, stuck) && !h.Stopped() {
+		handler.Post(&errorCommand{msg: fmt.Sprintf(WaitsignalDeadlockError, w.name)})
+	}
+}
+
+// signalQueued reports whether a signal command for name is queued or still
+// to come in the program the waiting command is part of.
+func signalQueued(handler Handler, h workerHandler, name string) bool {
+	if ph, ok := findHandler[*programHandler](handler); ok {
+		cmds, posted := ph.rest()
+		if sendsSignal(cmds, name) || sendsSignal(posted, name) {
+			return true
+		}
+	}
+	return sendsSignal(h.queue.snapshot(), name)
+}
+
+func sendsSignal(cmds []Command, name string) bool {
+	for _, cmd := range cmds {
+		switch c := cmd.(type) {
+		case *signalCommand:
+			if c.name == name {
+				return true
+			}
+		case *fileCommand:
+			if sendsSignal([]Command{c.cmd}, name) {
+				return true
+			}
+		case *resultCommand:
+			if sendsSignal([]Command{c.cmd}, name) {
+				return true
+			}
+		case *postedCommand:
+			if sendsSignal([]Command{c.cmd}, name) {
+				return true
+			}
+		case *programCommand:
+			if sendsSignal(c.prog.cmds[min(c.ip, len(c.prog.cmds)):], name) || sendsSignal(c.posted, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// signalCommand sends a signal to name, like Signal.
+type signalCommand struct {
+	name string
+}
+
+func (s *signalCommand) attrs() []any {
+	return []any{"name", s.name}
+}
+
+func (s *signalCommand) Execute(handler Handler) {
+	if h, ok := findHandler[workerHandler](handler); ok {
+		h.Signal(s.name)
+	}
+}
+
+func parseSignal(command string, build func(name string) Command) ParseFunc {
+	return func(args []string) (Command, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf(AmbiguousArgsNumberError, command)
+		}
+		return build(args[0]), nil
+	}
+}
@@ -0,0 +1,78 @@
+package eventloop
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWaitsignal(t *testing.T) {
+	var out, errs syncBuffer
+	l := newTestLoop(&out, &errs)
+	l.Start()
+	postScript(t, l, "print before\nwaitsignal go\nprint after")
+
+	start := time.Now()
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		l.Signal("go")
+	}()
+	time.Sleep(10 * time.Millisecond)
+	// The output before the wait is flushed, but nothing after it runs yet.
+	if got := out.String(); got != "before\n" {
+		t.Errorf("output while waiting = %q, want %q", got, "before\n")
+	}
+	l.AwaitFinish()
+
+	if d := time.Since(start); d < 30*time.Millisecond {
+		t.Errorf("finished after %v, want the wait to last until the signal", d)
+	}
+	if got := out.String(); got != "before\nafter\n" || errs.String() != "" {
+		t.Errorf("output = %q, errors = %q, want the loop to go on after the signal", got, errs.String())
+	}
+}
+
+func TestSignalKept(t *testing.T) {
+	// Every signal sent with no one waiting releases one later waitsignal.
+	checkOutput(t, "signal s\nsignal s\nwaitsignal s\nwaitsignal s\nprint ok", "ok\n", "")
+
+	var out, errs syncBuffer
+	l := newTestLoop(&out, &errs)
+	l.Signal("early")
+	l.Start()
+	postScript(t, l, "waitsignal early\nprint ok")
+	l.AwaitFinish()
+	if out.String() != "ok\n" || errs.String() != "" {
+		t.Errorf("output = %q, errors = %q, want a signal sent before Start kept", out.String(), errs.String())
+	}
+}
+
+func TestWaitsignalDeadlock(t *testing.T) {
+	// The only worker is waiting, so it could never run the signal.
+	checkOutput(t, "waitsignal s\nsignal s\nprint after", "after\n", "line 1: "+fmt.Sprintf(WaitsignalDeadlockError, "s")+"\n")
+	// Another worker can.
+	checkOutput(t, "waitsignal s\nsignal s", "", "", WithWorkers(2, false))
+}
+
+func TestWaitsignalStop(t *testing.T) {
+	var out, errs syncBuffer
+	l := newTestLoop(&out, &errs)
+	l.Start()
+	postScript(t, l, "waitsignal never\nprint after")
+	time.Sleep(10 * time.Millisecond)
+
+	stopped := make(chan struct{})
+	go func() {
+		l.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Stop did not release a waiting waitsignal")
+	}
+	if strings.Contains(out.String(), "after") || errs.String() != "" {
+		t.Errorf("output = %q, errors = %q, want nothing more once stopped", out.String(), errs.String())
+	}
+}
@@ -0,0 +1,181 @@
+package eventloop
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+const StackUnderflowError string = "error: stack underflow"
+
+// MARK: - Stack
+
+// stack is the loop's operand stack for the RPN commands push, pop and op. It
+// is safe for concurrent use.
+type stack struct {
+	vals []int64
+	mu   sync.Mutex
+}
+
+func (s *stack) push(val int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.vals = append(s.vals, val)
+}
+
+func (s *stack) pop() (int64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.vals) == 0 {
+		return 0, false
+	}
+	val := s.vals[len(s.vals)-1]
+	s.vals = s.vals[:len(s.vals)-1]
+	return val, true
+}
+
+// apply replaces the two topmost values, a below b, with op(a, b). On an
+// error the stack is left as it was.
+func (s *stack) apply(op func(a, b int64) (int64, error)) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := len(s.vals)
+	if n < 2 {
+		return 0, errors.New(StackUnderflowError)
+	}
+	res, err := op(s.vals[n-2], s.vals[n-1])
+	if err != nil {
+		return 0, err
+	}
+	s.vals[n-2] = res
+	s.vals = s.vals[:n-1]
+	return res, nil
+}
+
+// stackOps are the operators of the op command, with the same semantics as
+// the arithmetic commands.
+var stackOps = map[string]func(a, b int64) (int64, error){
+	"+": checkedOp(checkedAdd),
+	"-": checkedOp(checkedSub),
+	"*": checkedOp(checkedMul),
+	"/": func(a, b int64) (int64, error) {
+		if b == 0 {
+			return 0, errors.New(DivisionByZeroError)
+		}
+		return checkedOp(checkedDiv)(a, b)
+	},
+}
+
+func checkedOp(op func(a, b int64) (int64, bool)) func(a, b int64) (int64, error) {
+	return func(a, b int64) (int64, error) {
+		res, ok := op(a, b)
+		if !ok {
+			return 0, errors.New(IntegerOverflowError)
+		}
+		return res, nil
+	}
+}
+
+func stackOf(handler Handler) (*stack, bool) {
+	h, ok := findHandler[workerHandler](handler)
+	if !ok {
+		return nil, false
+	}
+	return h.stack, true
+}
+
+// pushCommand pushes a value onto the loop's stack.
+type pushCommand struct {
+	arg operand
+}
+
+func (p *pushCommand) attrs() []any {
+	return []any{"arg", p.arg}
+}
+
+func (p *pushCommand) Execute(handler Handler) {
+	val, ok := p.arg.resolve(handler)
+	if !ok {
+		return
+	}
+	if s, ok := stackOf(handler); ok {
+		s.push(val)
+	}
+}
+
+// popCommand moves the top of the loop's stack into a variable.
+type popCommand struct {
+	name string
+}
+
+func (p *popCommand) attrs() []any {
+	return []any{"var", p.name}
+}
+
+func (p *popCommand) Execute(handler Handler) {
+	s, ok := stackOf(handler)
+	if !ok {
+		return
+	}
+	val, ok := s.pop()
+	if !ok {
+		handler.Post(&errorCommand{msg: StackUnderflowError})
+		return
+	}
+	handler.Vars().Set(p.name, IntValue(val))
+	returnResult(handler, val)
+}
+
+// opCommand replaces the two topmost values of the loop's stack with the
+// result of an operator; "push 7, push 2, op -" leaves 5.
+type opCommand struct {
+	op string
+}
+
+func (o *opCommand) attrs() []any {
+	return []any{"op", o.op}
+}
+
+func (o *opCommand) Execute(handler Handler) {
+	s, ok := stackOf(handler)
+	if !ok {
+		return
+	}
+	res, err := s.apply(stackOps[o.op])
+	if err != nil {
+		handler.Post(&errorCommand{msg: err.Error()})
+		return
+	}
+	returnResult(handler, res)
+}
+
+func parsePush(args []string) (Command, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "push")
+	}
+	arg, err := parseOperand(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return &pushCommand{arg: arg}, nil
+}
+
+func parsePop(args []string) (Command, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "pop")
+	}
+	return &popCommand{name: args[0]}, nil
+}
+
+func parseOp(args []string) (Command, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "op")
+	}
+	if _, ok := stackOps[args[0]]; !ok {
+		return nil, fmt.Errorf(UnknownOperatorError, args[0])
+	}
+	return &opCommand{op: args[0]}, nil
+}
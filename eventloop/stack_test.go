@@ -0,0 +1,19 @@
+package eventloop
+
+import "testing"
+
+func TestStackCalculator(t *testing.T) {
+	checkOutput(t, "push 3\npush 4\nop +\npop x\nprint $x", "7\n", "")
+	// (2 + 3) * (10 - 4) / 5
+	checkOutput(t, "push 2\npush 3\nop +\npush 10\npush 4\nop -\nop *\npush 5\nop /\npop x\nprint $x", "6\n", "")
+}
+
+func TestStackUnderflow(t *testing.T) {
+	checkOutput(t, "push 2\nop *\npush 3\nop *\npop x\nprint $x", "6\n", "line 2: "+StackUnderflowError+"\n")
+	checkOutput(t, "pop x", "", "line 1: "+StackUnderflowError+"\n")
+	checkOutput(t, "push 7\npush 0\nop /\nop +\npop x\nprint $x", "7\n", "line 3: "+DivisionByZeroError+"\n")
+}
+
+func TestStackWithVariables(t *testing.T) {
+	checkOutput(t, "set a 5\npush a\npush 2\nop -\npop b\nadd b 1", "4\n", "")
+}
@@ -0,0 +1,161 @@
+package eventloop
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// MARK: - State
+
+// state is the JSON form of a loop's queue and variables.
+type state struct {
+	Queue []queuedCommand  `json:"queue"`
+	Vars  map[string]Value `json:"vars"`
+}
+
+// queuedCommand is a queued instruction, or, for a program with labels, its
+// instructions and the index of the one to execute next.
+type queuedCommand struct {
+	Command string   `json:"command,omitempty"`
+	Program []string `json:"program,omitempty"`
+	Next    int      `json:"next,omitempty"`
+	Jumps   int      `json:"jumps,omitempty"`
+}
+
+// DumpState returns the queued commands and the variables as JSON, for
+// inspecting a run or resuming it with LoadState. The queue is written as
+// instruction text, so it fails if a command isn't a built-in one. The
+// loop's bookkeeping, such as the marker of a pending drain, and commands
+// scheduled by after for later are left out.
+func (l *EventLoop) DumpState() ([]byte, error) {
+	s := state{Queue: []queuedCommand{}, Vars: l.vars.Snapshot()}
+	for _, cmd := range l.queue.snapshot() {
+		if isInternal(cmd) {
+			continue
+		}
+		qs, err := dumpCommand(cmd)
+		if err != nil {
+			return nil, err
+		}
+		s.Queue = append(s.Queue, qs...)
+	}
+	return json.Marshal(s)
+}
+
+// dumpCommand dumps a queued command. A program step is dumped as its
+// program, followed by the commands it holds back.
+func dumpCommand(cmd Command) ([]queuedCommand, error) {
+	if f, ok := cmd.(*fileCommand); ok {
+		if p, ok := f.cmd.(*programCommand); ok {
+			cmd = p
+		}
+	}
+	if p, ok := cmd.(*programCommand); ok {
+		q := queuedCommand{Next: p.ip, Jumps: p.jumps}
+		for _, cmd := range p.prog.cmds {
+			text, err := dumpText(cmd)
+			if err != nil {
+				return nil, err
+			}
+			q.Program = append(q.Program, text)
+		}
+		qs := []queuedCommand{q}
+		for _, cmd := range p.posted {
+			posted, err := dumpCommand(cmd)
+			if err != nil {
+				return nil, err
+			}
+			qs = append(qs, posted...)
+		}
+		return qs, nil
+	}
+	text, err := dumpText(cmd)
+	return []queuedCommand{{Command: text}}, err
+}
+
+// dumpText returns the instruction of cmd, checking that it parses back.
+func dumpText(cmd Command) (string, error) {
+	text := textOf(cmd)
+	if _, err := parseInstruction(builtins, text); text == "" || err != nil {
+		return "", fmt.Errorf("eventloop: can't dump %v command", commandName(cmd))
+	}
+	return text, nil
+}
+
+// parseInstruction parses the text of a single instruction, which may be a
+// block of several lines.
+func parseInstruction(r *Registry, text string) (Command, error) {
+	parser := r.LineParser()
+	var cmd Command
+	for _, line := range strings.Split(text, "\n") {
+		c, err := parser.Parse(line)
+		if err != nil {
+			return nil, err
+		}
+		if c != nil && cmd != nil {
+			return nil, errors.New("eventloop: more than one instruction")
+		}
+		if c != nil {
+			cmd = c
+		}
+	}
+	if err := parser.Close(); err != nil {
+		return nil, err
+	}
+	if cmd == nil {
+		return nil, errors.New("eventloop: no instruction")
+	}
+	return cmd, nil
+}
+
+// LoadState restores a state returned by DumpState: it replaces the
+// variables with the dumped ones and posts the dumped commands, which are
+// parsed using the built-in commands. Nothing changes if data can't be
+// parsed.
+func (l *EventLoop) LoadState(data []byte) error {
+	var s state
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("eventloop: invalid state: %w", err)
+	}
+	cmds := make([]Command, 0, len(s.Queue))
+	for _, q := range s.Queue {
+		cmd, err := loadCommand(q)
+		if err != nil {
+			return fmt.Errorf("eventloop: invalid state: %w", err)
+		}
+		cmds = append(cmds, cmd)
+	}
+
+	l.vars.Clear()
+	for name, val := range s.Vars {
+		l.vars.Set(name, val)
+	}
+	for _, cmd := range cmds {
+		l.Post(cmd)
+	}
+	return nil
+}
+
+func loadCommand(q queuedCommand) (Command, error) {
+	if q.Program == nil {
+		return parseInstruction(builtins, q.Command)
+	}
+	cmds := make([]Command, len(q.Program))
+	for i, text := range q.Program {
+		cmd, err := parseInstruction(builtins, text)
+		if err != nil {
+			return nil, err
+		}
+		cmds[i] = cmd
+	}
+	prog, err := NewProgram(cmds)
+	if err != nil {
+		return nil, err
+	}
+	if q.Next < 0 || q.Next > len(cmds) {
+		return nil, fmt.Errorf("instruction %d out of range", q.Next)
+	}
+	return &programCommand{prog: prog, ip: q.Next, jumps: q.Jumps}, nil
+}
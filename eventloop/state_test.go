@@ -0,0 +1,75 @@
+package eventloop
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// runQueued starts l, waits for it to finish and returns what it printed to
+// out.
+func runQueued(l *EventLoop, out *syncBuffer) string {
+	l.Start()
+	l.AwaitFinish()
+	return out.String()
+}
+
+func TestDumpLoadState(t *testing.T) {
+	for _, script := range []string{
+		"set x 2\nprint a\nadd x 3\nmul x 4",
+		"set i 0\nlabel top\nprint $i\ninc i\nif i lt 3 goto top\nprint done",
+	} {
+		var out, errs syncBuffer
+		l := newTestLoop(&out, &errs)
+		postScript(t, l, script)
+		data, err := l.DumpState()
+		if err != nil {
+			t.Fatalf("DumpState of %q: %v", script, err)
+		}
+		want := runQueued(l, &out)
+
+		var loadedOut, loadedErrs syncBuffer
+		loaded := newTestLoop(&loadedOut, &loadedErrs)
+		if err := loaded.LoadState(data); err != nil {
+			t.Fatalf("LoadState(%s): %v", data, err)
+		}
+		if got := runQueued(loaded, &loadedOut); got != want {
+			t.Errorf("reloaded %q printed %q, want %q", script, got, want)
+		}
+	}
+}
+
+func TestDumpStateVars(t *testing.T) {
+	var out, errs syncBuffer
+	l := newTestLoop(&out, &errs)
+	l.Vars().Set("n", IntValue(7))
+	l.Vars().Set("s", StringValue("hi"))
+	data, err := l.DumpState()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := newTestLoop(&out, &errs)
+	loaded.Vars().Set("stale", IntValue(1))
+	if err := loaded.LoadState(data); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := json.Marshal(loaded.Vars().Snapshot())
+	want, _ := json.Marshal(l.Vars().Snapshot())
+	if string(got) != string(want) {
+		t.Errorf("loaded variables %s, want %s", got, want)
+	}
+}
+
+func TestLoadStateInvalid(t *testing.T) {
+	var out, errs syncBuffer
+	l := newTestLoop(&out, &errs)
+	l.Vars().Set("kept", IntValue(1))
+	for _, data := range []string{`not json`, `{"queue": [{"command": "frob"}]}`} {
+		if err := l.LoadState([]byte(data)); err == nil {
+			t.Errorf("LoadState(%s) succeeded", data)
+		}
+	}
+	if _, ok := l.Vars().Get("kept"); !ok || l.QueueLen() != 0 {
+		t.Error("a failed LoadState changed the loop")
+	}
+}
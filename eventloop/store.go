@@ -0,0 +1,291 @@
+package eventloop
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const NotNumberValueError string = "error: variable %v is not a number: %q"
+const NotIntegerValueError string = "error: variable %v is a float, not an integer: %v"
+
+// MARK: - Values
+
+// Value is the content of a variable: an integer, a float or a string.
+//
+// Integer commands take an integer, or a string spelling a base-10 integer;
+// a float is an error rather than being truncated. Float commands take any
+// number, or a string spelling one. Commands working on text, like print and
+// concat, take numbers in their shortest decimal form, with a float always
+// showing a decimal point or an exponent, as in 2.0, so that it doesn't read
+// back as an integer.
+type Value struct {
+	kind valueKind
+	num  int64
+	flt  float64
+	str  string
+}
+
+type valueKind int
+
+const (
+	intKind valueKind = iota
+	floatKind
+	stringKind
+)
+
+var kindNames = [...]string{intKind: "int", floatKind: "float", stringKind: "string"}
+
+// IntValue returns the integer value n.
+func IntValue(n int64) Value {
+	return Value{num: n}
+}
+
+// FloatValue returns the float value f.
+func FloatValue(f float64) Value {
+	return Value{kind: floatKind, flt: f}
+}
+
+// StringValue returns the string value s.
+func StringValue(s string) Value {
+	return Value{kind: stringKind, str: s}
+}
+
+// Type returns "int", "float" or "string".
+func (v Value) Type() string {
+	return kindNames[v.kind]
+}
+
+// IsString reports whether v was created from a string.
+func (v Value) IsString() bool {
+	return v.kind == stringKind
+}
+
+// Int returns v as an integer. The second result is false for a float and
+// for a string that isn't a base-10 integer.
+func (v Value) Int() (int64, bool) {
+	switch v.kind {
+	case intKind:
+		return v.num, true
+	case stringKind:
+		n, err := strconv.ParseInt(v.str, 10, 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// Float returns v as a float. The second result is false for a string that
+// isn't a number.
+func (v Value) Float() (float64, bool) {
+	switch v.kind {
+	case intKind:
+		return float64(v.num), true
+	case floatKind:
+		return v.flt, true
+	}
+	f, err := strconv.ParseFloat(v.str, 64)
+	return f, err == nil
+}
+
+// toInt is Int with an error naming the variable v was read from.
+func (v Value) toInt(name string) (int64, error) {
+	n, ok := v.Int()
+	switch {
+	case ok:
+		return n, nil
+	case v.kind == floatKind:
+		return 0, fmt.Errorf(NotIntegerValueError, name, v)
+	}
+	return 0, fmt.Errorf(NotNumberValueError, name, v.str)
+}
+
+// toFloat is Float with an error naming the variable v was read from.
+func (v Value) toFloat(name string) (float64, error) {
+	f, ok := v.Float()
+	if !ok {
+		return 0, fmt.Errorf(NotNumberValueError, name, v.str)
+	}
+	return f, nil
+}
+
+// String returns v as text.
+func (v Value) String() string {
+	switch v.kind {
+	case floatKind:
+		s := strconv.FormatFloat(v.flt, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".eEnN") {
+			s += ".0"
+		}
+		return s
+	case stringKind:
+		return v.str
+	}
+	return strconv.FormatInt(v.num, 10)
+}
+
+// MarshalJSON writes v as a JSON number or string. A float is written like
+// String does, with a decimal point, so that it reads back as a float.
+func (v Value) MarshalJSON() ([]byte, error) {
+	if v.kind == floatKind {
+		return json.Marshal(json.Number(v.String()))
+	}
+	return json.Marshal(v.native())
+}
+
+// UnmarshalJSON reads a JSON number or string into v. A number is an integer
+// unless it has a fraction or an exponent.
+func (v *Value) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*v = StringValue(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("variable value %s is neither a number nor a string", data)
+	}
+	if i, err := n.Int64(); err == nil {
+		*v = IntValue(i)
+		return nil
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return fmt.Errorf("variable value %s is out of range", data)
+	}
+	*v = FloatValue(f)
+	return nil
+}
+
+// native returns the int64, float64 or string held by v.
+func (v Value) native() any {
+	switch v.kind {
+	case floatKind:
+		return v.flt
+	case stringKind:
+		return v.str
+	}
+	return v.num
+}
+
+// MARK: - Store
+
+// Store holds the named variables of a loop. It is safe for concurrent use.
+type Store struct {
+	vars map[string]Value
+	mu   sync.Mutex
+}
+
+func newStore() *Store {
+	return &Store{vars: make(map[string]Value)}
+}
+
+// Get returns the value of name and whether it is defined.
+func (s *Store) Get(name string) (Value, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	val, ok := s.vars[name]
+	return val, ok
+}
+
+// Set defines or overwrites name.
+func (s *Store) Set(name string, val Value) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.vars[name] = val
+}
+
+// Delete removes name, if it is defined, and reports whether it was.
+func (s *Store) Delete(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.vars[name]
+	delete(s.vars, name)
+	return ok
+}
+
+// Copy sets dest to the value of src, which must be defined. With move, src
+// is removed afterwards, unless it is dest itself. Both happen in a single
+// step.
+func (s *Store) Copy(dest, src string, move bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	val, ok := s.vars[src]
+	if !ok {
+		return fmt.Errorf(UndefinedVariableError, src)
+	}
+	s.vars[dest] = val
+	if move && dest != src {
+		delete(s.vars, src)
+	}
+	return nil
+}
+
+// Swap exchanges the values of a and b in a single step. Both must be
+// defined; otherwise neither changes and an error is returned.
+func (s *Store) Swap(a, b string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	valA, ok := s.vars[a]
+	if !ok {
+		return fmt.Errorf(UndefinedVariableError, a)
+	}
+	valB, ok := s.vars[b]
+	if !ok {
+		return fmt.Errorf(UndefinedVariableError, b)
+	}
+	s.vars[a], s.vars[b] = valB, valA
+	return nil
+}
+
+// Snapshot returns a copy of the variables, which later changes to the store
+// leave alone.
+func (s *Store) Snapshot() map[string]Value {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return maps.Clone(s.vars)
+}
+
+// replace makes vars, which the store takes over, its variables.
+func (s *Store) replace(vars map[string]Value) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.vars = vars
+}
+
+// Clear removes every variable.
+func (s *Store) Clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	clear(s.vars)
+}
+
+// Add adds delta to name in a single step, treating an undefined variable as
+// zero, and returns the new value. If name holds a string that isn't a number
+// or the sum overflows, name is left as it was and an error is returned.
+func (s *Store) Add(name string, delta int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cur, err := s.vars[name].toInt(name)
+	if err != nil {
+		return 0, err
+	}
+	val, ok := checkedAdd(cur, delta)
+	if !ok {
+		return 0, errors.New(IntegerOverflowError)
+	}
+	s.vars[name] = IntValue(val)
+	return val, nil
+}
@@ -0,0 +1,113 @@
+package eventloop
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestSwap(t *testing.T) {
+	checkOutput(t, "set a 1\nset b hello\nswap a b\nget a\nget b", "hello\n1\n", "")
+
+	want := "line 3: " + fmt.Sprintf(UndefinedVariableError, "z") + "\n"
+	checkOutput(t, "set a 1\nset b 2\nswap a z\nget a", "1\n", want)
+	checkOutput(t, "set a 1\nset b 2\nswap z a\nget a", "1\n", want)
+}
+
+func TestSwapAtomic(t *testing.T) {
+	s := newStore()
+	s.Set("a", IntValue(1))
+	s.Set("b", IntValue(2))
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for range 10000 {
+			s.Swap("a", "b")
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for range 10000 {
+			vars := s.Snapshot()
+			if a, b := vars["a"], vars["b"]; a == b {
+				t.Errorf("a and b both %v, want a swap seen whole or not at all", a)
+				return
+			}
+		}
+	}()
+	wg.Wait()
+}
+
+func TestCopyMove(t *testing.T) {
+	checkOutput(t, "set a hello\ncp b a\nget b\nget a", "hello\nhello\n", "")
+	checkOutput(t, "set a 1\nset b 9\ncp b a\nget b", "1\n", "")
+	checkOutput(t, "set a 1\nmv b a\nget b\nget a", "1\n", "line 4: "+fmt.Sprintf(UndefinedVariableError, "a")+"\n")
+
+	for _, cmd := range []string{"cp", "mv"} {
+		checkOutput(t, "set b 9\n"+cmd+" b zz\nget b", "9\n", "line 2: "+fmt.Sprintf(UndefinedVariableError, "zz")+"\n")
+	}
+}
+
+func TestValueCoercion(t *testing.T) {
+	for _, c := range []struct {
+		val      Value
+		typ, str string
+		n        int64
+		nOK      bool
+		f        float64
+		fOK      bool
+	}{
+		{IntValue(-7), "int", "-7", -7, true, -7, true},
+		{FloatValue(2), "float", "2.0", 0, false, 2, true},
+		{FloatValue(1.5e30), "float", "1.5e+30", 0, false, 1.5e30, true},
+		{StringValue("42"), "string", "42", 42, true, 42, true},
+		{StringValue("2.5"), "string", "2.5", 0, false, 2.5, true},
+		{StringValue("abc"), "string", "abc", 0, false, 0, false},
+	} {
+		if got := c.val.Type(); got != c.typ {
+			t.Errorf("Type of %v = %q, want %q", c.val, got, c.typ)
+		}
+		if got := c.val.String(); got != c.str {
+			t.Errorf("String of %v = %q, want %q", c.val, got, c.str)
+		}
+		if n, ok := c.val.Int(); n != c.n || ok != c.nOK {
+			t.Errorf("Int of %s %v = %v, %v, want %v, %v", c.typ, c.val, n, ok, c.n, c.nOK)
+		}
+		if f, ok := c.val.Float(); f != c.f || ok != c.fOK {
+			t.Errorf("Float of %s %v = %v, %v, want %v, %v", c.typ, c.val, f, ok, c.f, c.fOK)
+		}
+	}
+}
+
+func TestTypedVariables(t *testing.T) {
+	checkOutput(t, "set n 12\nset f 2.5\nset s abc\nget n\nget f\nget s", "12\n2.5\nabc\n", "")
+	checkOutput(t, "set f 3.0\nget f\nset n 0x10\nadd n 1", "3.0\n17\n", "")
+	// Strings spelling numbers take part in arithmetic.
+	checkOutput(t, "set s 7\nconcat t $s 0\nadd t 1", "71\n", "")
+
+	checkOutput(t, "set s abc\nadd s 1", "", "line 2: "+fmt.Sprintf(NotNumberValueError, "s", "abc")+"\n")
+	checkOutput(t, "set f 1.5\ninc f", "", "line 2: "+fmt.Sprintf(NotIntegerValueError, "f", "1.5")+"\n")
+}
+
+func TestAddAtomic(t *testing.T) {
+	s := newStore()
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 1000 {
+				if _, err := s.Add("n", 1); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if got, _ := s.Get("n"); got != IntValue(8000) {
+		t.Errorf("n = %v after 8000 concurrent adds of 1, want 8000", got)
+	}
+}
@@ -0,0 +1,372 @@
+package eventloop
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const NotStringValueError string = "error: variable %v is not a string: %v"
+const InvalidBaseError string = "SYNTAX ERROR: base '%v' must be between 2 and 36"
+const NotInBaseError string = "error: frombase: %v is not a base %v integer"
+const UnknownHashError string = "SYNTAX ERROR: unknown hash '%v', expected one of %v"
+const UnknownSortOrderError string = "SYNTAX ERROR: unknown sort order '%v'"
+const NegativeCountError string = "error: variable %v is a negative count: %v"
+
+// MARK: - Text
+
+// textOps are the commands transforming the text of a string variable.
+var textOps = map[string]func(s string) string{
+	"upper":   strings.ToUpper,
+	"lower":   strings.ToLower,
+	"reverse": reverseRunes,
+}
+
+// reverseRunes reverses s character by character, so that a multi-byte UTF-8
+// character stays intact.
+func reverseRunes(s string) string {
+	r := []rune(s)
+	for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+		r[i], r[j] = r[j], r[i]
+	}
+	return string(r)
+}
+
+// textCommand stores the text of a string variable transformed by one of
+// textOps in another variable. A number is an error rather than taken as
+// text.
+type textCommand struct {
+	op        string
+	dest, src string
+}
+
+func (t *textCommand) attrs() []any {
+	return []any{"dest", t.dest, "src", t.src}
+}
+
+func (t *textCommand) Execute(handler Handler) {
+	val, ok := lookupVar(handler, t.src)
+	if !ok {
+		return
+	}
+	if !val.IsString() {
+		handler.Post(&errorCommand{msg: fmt.Sprintf(NotStringValueError, t.src, val)})
+		return
+	}
+	res := textOps[t.op](val.String())
+	handler.Vars().Set(t.dest, StringValue(res))
+	returnResult(handler, res)
+}
+
+func parseText(op string) ParseFunc {
+	return func(args []string) (Command, error) {
+		if len(args) != 2 {
+			return nil, fmt.Errorf(AmbiguousArgsNumberError, op)
+		}
+		return &textCommand{op: op, dest: args[0], src: args[1]}, nil
+	}
+}
+
+// splitCommand splits the text of a string variable at every sep, storing
+// the pieces in prefix0, prefix1 and so on, and their number in prefixN.
+// Empty pieces are kept, so "a,,b" has three, but an empty string has none.
+// An empty sep splits after every character. Variables left from splitting
+// into more pieces before aren't removed.
+type splitCommand struct {
+	prefix, src, sep string
+}
+
+func (s *splitCommand) attrs() []any {
+	return []any{"prefix", s.prefix, "src", s.src, "sep", s.sep}
+}
+
+func (s *splitCommand) Execute(handler Handler) {
+	val, ok := lookupVar(handler, s.src)
+	if !ok {
+		return
+	}
+	if !val.IsString() {
+		handler.Post(&errorCommand{msg: fmt.Sprintf(NotStringValueError, s.src, val)})
+		return
+	}
+	var pieces []string
+	if text := val.String(); text != "" {
+		pieces = strings.Split(text, s.sep)
+	}
+	vars := handler.Vars()
+	for i, piece := range pieces {
+		vars.Set(s.prefix+strconv.Itoa(i), StringValue(piece))
+	}
+	n := int64(len(pieces))
+	vars.Set(s.prefix+"N", IntValue(n))
+	returnResult(handler, n)
+}
+
+func parseSplit(args []string) (Command, error) {
+	if len(args) != 3 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "split")
+	}
+	return &splitCommand{prefix: args[0], src: args[1], sep: args[2]}, nil
+}
+
+// joinCommand stores the text of variables joined by sep in a variable.
+// Numbers are taken in their text form; no variables join to "".
+type joinCommand struct {
+	dest, sep string
+	names     []string
+}
+
+func (j *joinCommand) attrs() []any {
+	return []any{"dest", j.dest, "sep", j.sep, "vars", j.names}
+}
+
+func (j *joinCommand) Execute(handler Handler) {
+	texts := make([]string, len(j.names))
+	for i, name := range j.names {
+		val, ok := lookupVar(handler, name)
+		if !ok {
+			return
+		}
+		texts[i] = val.String()
+	}
+	res := strings.Join(texts, j.sep)
+	handler.Vars().Set(j.dest, StringValue(res))
+	returnResult(handler, res)
+}
+
+func parseJoin(args []string) (Command, error) {
+	if len(args) < 2 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "join")
+	}
+	return &joinCommand{dest: args[0], sep: args[1], names: args[2:]}, nil
+}
+
+// sortOrders are the orders of the sort command, comparing two values. Values
+// are taken apart by cmpNumeric, and must all be numbers, or by their text.
+var sortOrders = map[string]func(a, b Value) int{
+	"numeric": cmpNumeric,
+	"text":    func(a, b Value) int { return strings.Compare(a.String(), b.String()) },
+}
+
+// cmpNumeric compares two numbers, either of which may be a string spelling
+// one. Two integers are compared exactly, anything else as floats.
+func cmpNumeric(a, b Value) int {
+	if m, ok := a.Int(); ok {
+		if n, ok := b.Int(); ok {
+			return cmp.Compare(m, n)
+		}
+	}
+	f, _ := a.Float()
+	g, _ := b.Float()
+	return cmp.Compare(f, g)
+}
+
+// sortCommand sorts the variables prefix0 to prefixN-1 in ascending order,
+// the first prefixN of them, as left by split. Values are moved as they are,
+// so a string stays a string and an integer an integer, whatever the order.
+// In numeric order every value has to be a number or a string spelling one,
+// and values that compare equal, like 2 and 2.0, keep their order; in text
+// order numbers compare by their text, so 10 comes before 9.
+type sortCommand struct {
+	prefix, order string
+}
+
+func (s *sortCommand) attrs() []any {
+	return []any{"prefix", s.prefix, "order", s.order}
+}
+
+func (s *sortCommand) Execute(handler Handler) {
+	countName := s.prefix + "N"
+	count, ok := lookupVar(handler, countName)
+	if !ok {
+		return
+	}
+	n, err := count.toInt(countName)
+	if err == nil && n < 0 {
+		err = fmt.Errorf(NegativeCountError, countName, n)
+	}
+	if err != nil {
+		handler.Post(&errorCommand{msg: err.Error()})
+		return
+	}
+	// The values are collected one by one rather than allocated up front, so
+	// that a bogus count fails on the first undefined variable.
+	var vals []Value
+	for i := int64(0); i < n; i++ {
+		name := s.prefix + strconv.FormatInt(i, 10)
+		val, ok := lookupVar(handler, name)
+		if !ok {
+			return
+		}
+		if _, err := val.toFloat(name); err != nil && s.order == "numeric" {
+			handler.Post(&errorCommand{msg: err.Error()})
+			return
+		}
+		vals = append(vals, val)
+	}
+	slices.SortStableFunc(vals, sortOrders[s.order])
+	for i, val := range vals {
+		handler.Vars().Set(s.prefix+strconv.Itoa(i), val)
+	}
+	returnResult(handler, n)
+}
+
+// parseSort accepts "sort <prefix> [numeric|text]"; the order defaults to
+// numeric.
+func parseSort(args []string) (Command, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "sort")
+	}
+	order := "numeric"
+	if len(args) == 2 {
+		order = args[1]
+	}
+	if _, ok := sortOrders[order]; !ok {
+		return nil, fmt.Errorf(UnknownSortOrderError, order)
+	}
+	return &sortCommand{prefix: args[0], order: order}, nil
+}
+
+// MARK: - Bases
+
+// tobaseCommand stores the digits of an integer in a base between 2 and 36 as
+// a string; digits above 9 are the letters a to z.
+type tobaseCommand struct {
+	dest string
+	src  operand
+	base int
+}
+
+func (t *tobaseCommand) attrs() []any {
+	return []any{"dest", t.dest, "src", t.src, "base", t.base}
+}
+
+func (t *tobaseCommand) Execute(handler Handler) {
+	n, ok := t.src.resolve(handler)
+	if !ok {
+		return
+	}
+	res := strconv.FormatInt(n, t.base)
+	handler.Vars().Set(t.dest, StringValue(res))
+	returnResult(handler, res)
+}
+
+// frombaseCommand parses the text of a string variable as an integer in a
+// base between 2 and 36, in either case, with an optional sign.
+type frombaseCommand struct {
+	dest, src string
+	base      int
+}
+
+func (f *frombaseCommand) attrs() []any {
+	return []any{"dest", f.dest, "src", f.src, "base", f.base}
+}
+
+func (f *frombaseCommand) Execute(handler Handler) {
+	val, ok := lookupVar(handler, f.src)
+	if !ok {
+		return
+	}
+	if !val.IsString() {
+		handler.Post(&errorCommand{msg: fmt.Sprintf(NotStringValueError, f.src, val)})
+		return
+	}
+	n, err := strconv.ParseInt(val.String(), f.base, 64)
+	if err != nil {
+		handler.Post(&errorCommand{msg: fmt.Sprintf(NotInBaseError, strconv.Quote(val.String()), f.base)})
+		return
+	}
+	handler.Vars().Set(f.dest, IntValue(n))
+	returnResult(handler, n)
+}
+
+func parseBase(arg string) (int, error) {
+	base, err := strconv.Atoi(arg)
+	if err != nil || base < 2 || base > 36 {
+		return 0, fmt.Errorf(InvalidBaseError, arg)
+	}
+	return base, nil
+}
+
+func parseTobase(args []string) (Command, error) {
+	if len(args) != 3 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "tobase")
+	}
+	src, err := parseOperand(args[1])
+	if err != nil {
+		return nil, err
+	}
+	base, err := parseBase(args[2])
+	if err != nil {
+		return nil, err
+	}
+	return &tobaseCommand{dest: args[0], src: src, base: base}, nil
+}
+
+func parseFrombase(args []string) (Command, error) {
+	if len(args) != 3 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "frombase")
+	}
+	base, err := parseBase(args[2])
+	if err != nil {
+		return nil, err
+	}
+	return &frombaseCommand{dest: args[0], src: args[1], base: base}, nil
+}
+
+// MARK: - Hashes
+
+// hashes are the algorithms of the hash command, by name.
+var hashes = map[string]func() hash.Hash{
+	"crc32":  func() hash.Hash { return crc32.NewIEEE() },
+	"sha256": sha256.New,
+}
+
+// hashCommand stores the hex digest of the text of a string variable in
+// another variable.
+type hashCommand struct {
+	dest, src string
+	algo      string
+}
+
+func (h *hashCommand) attrs() []any {
+	return []any{"dest", h.dest, "src", h.src, "algo", h.algo}
+}
+
+func (h *hashCommand) Execute(handler Handler) {
+	val, ok := lookupVar(handler, h.src)
+	if !ok {
+		return
+	}
+	if !val.IsString() {
+		handler.Post(&errorCommand{msg: fmt.Sprintf(NotStringValueError, h.src, val)})
+		return
+	}
+	sum := hashes[h.algo]()
+	io.WriteString(sum, val.String())
+	res := hex.EncodeToString(sum.Sum(nil))
+	handler.Vars().Set(h.dest, StringValue(res))
+	returnResult(handler, res)
+}
+
+func parseHash(args []string) (Command, error) {
+	if len(args) != 3 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "hash")
+	}
+	if _, ok := hashes[args[2]]; !ok {
+		names := make([]string, 0, len(hashes))
+		for name := range hashes {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		return nil, fmt.Errorf(UnknownHashError, args[2], strings.Join(names, ", "))
+	}
+	return &hashCommand{dest: args[0], src: args[1], algo: args[2]}, nil
+}
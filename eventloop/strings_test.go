@@ -0,0 +1,142 @@
+package eventloop
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestConcat(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   string
+	}{
+		{"literals", "concat s foo bar\nget s", "foobar\n"},
+		{"variables", "set a 1\nset b \"two\"\nconcat s $a $b\nget s", "1two\n"},
+		{"mixed", "set a 4\nconcat s $a th\nget s", "4th\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkOutput(t, tt.script, tt.want, "")
+		})
+	}
+	t.Run("undefined", func(t *testing.T) {
+		checkOutput(t, "concat s $nope x", "", "line 1: error: undefined variable nope\n")
+	})
+}
+
+func TestLen(t *testing.T) {
+	for _, c := range []struct {
+		val  string
+		want string
+	}{
+		{"hello", "5"},
+		// Runes rather than bytes: the string is 17 bytes long.
+		{`"héllo wörld ✓"`, "13"},
+		{`""`, "0"},
+		{"123", "3"},
+	} {
+		checkOutput(t, "set s "+c.val+"\nlen n s\nget n", c.want+"\n", "")
+	}
+	checkOutput(t, "len n zz", "", "line 1: "+fmt.Sprintf(UndefinedVariableError, "zz")+"\n")
+}
+
+func TestReverse(t *testing.T) {
+	for _, c := range []struct{ val, want string }{
+		{"hello", "olleh"},
+		{`"héllo ✓"`, "✓ olléh"},
+		{`""`, ""},
+	} {
+		checkOutput(t, "set s "+c.val+"\nreverse r s\nprint <$r>", "<"+c.want+">\n", "")
+	}
+	checkOutput(t, "set n 123\nreverse r n", "", "line 2: "+fmt.Sprintf(NotStringValueError, "n", 123)+"\n")
+}
+
+func TestUpperLower(t *testing.T) {
+	checkOutput(t, "set s \"Hello Wörld 42\"\nupper u s\nlower l s\nprint $u $l", "HELLO WÖRLD 42 hello wörld 42\n", "")
+	checkOutput(t, "set n 12\nupper u n", "", "line 2: "+fmt.Sprintf(NotStringValueError, "n", 12)+"\n")
+	checkOutput(t, "set f 1.5\nlower l f", "", "line 2: "+fmt.Sprintf(NotStringValueError, "f", 1.5)+"\n")
+}
+
+func TestSplit(t *testing.T) {
+	checkOutput(t, "set s \"a,b,,c\"\nsplit p s ,\nprint $pN: $p0 $p1 <$p2> $p3", "4: a b <> c\n", "")
+	checkOutput(t, "set s abc\nsplit p s ,\nprint $pN: $p0", "1: abc\n", "")
+	checkOutput(t, "set s \"a::b\"\nsplit p s ::\nprint $pN: $p0 $p1", "2: a b\n", "")
+	checkOutput(t, "set s \"\"\nsplit p s ,\nget pN\nget p0", "0\n", "line 4: "+fmt.Sprintf(UndefinedVariableError, "p0")+"\n")
+
+	checkOutput(t, "set n 12\nsplit p n ,", "", "line 2: "+fmt.Sprintf(NotStringValueError, "n", 12)+"\n")
+}
+
+func TestJoin(t *testing.T) {
+	checkOutput(t, "set a x\nset b y\njoin d , a b\nprint <$d>", "<x,y>\n", "")
+	checkOutput(t, "set a x\nset n 3\nset f 1.5\njoin d \"-\" a n f\nprint <$d>", "<x-3-1.5>\n", "")
+	checkOutput(t, "set d old\njoin d ,\nprint <$d>", "<>\n", "")
+	checkOutput(t, "set a x\njoin d , a q", "", "line 2: "+fmt.Sprintf(UndefinedVariableError, "q")+"\n")
+}
+
+func TestBases(t *testing.T) {
+	checkOutput(t, "set x 255\ntobase h x 16\ntobase b x 2\nprint $h $b", "ff 11111111\n", "")
+	checkOutput(t, "set n -10\ntobase m n 36\nprint $m", "-a\n", "")
+	// Parsing the digits back gives the number again.
+	checkOutput(t, "set x 48879\ntobase h x 16\nfrombase y h 16\nprint $h $y", "beef 48879\n", "")
+	checkOutput(t, "set x 1000\ntobase b x 2\nfrombase y b 2\nget y", "1000\n", "")
+	checkOutput(t, "set s -FF\nfrombase d s 16\nget d", "-255\n", "")
+
+	for _, line := range []string{"tobase d x 1", "tobase d x 37", "frombase d s 0", "frombase d s x"} {
+		base := strings.Fields(line)[3]
+		if _, err := Parse(line); err == nil || err.Error() != fmt.Sprintf(InvalidBaseError, base) {
+			t.Errorf("Parse(%q) = %v, want %q", line, err, fmt.Sprintf(InvalidBaseError, base))
+		}
+	}
+	checkOutput(t, "set s zz\nfrombase d s 10", "", "line 2: "+fmt.Sprintf(NotInBaseError, `"zz"`, 10)+"\n")
+	checkOutput(t, "set n 10\nfrombase d n 2", "", "line 2: "+fmt.Sprintf(NotStringValueError, "n", 10)+"\n")
+	checkOutput(t, "tobase d q 2", "", "line 1: "+fmt.Sprintf(UndefinedVariableError, "q")+"\n")
+}
+
+func TestSort(t *testing.T) {
+	checkOutput(t, "set s \"10,9,2.5,-1\"\nsplit p s ,\nsort p\nprint $p0 $p1 $p2 $p3", "-1 2.5 9 10\n", "")
+	// In text order numbers compare by their text.
+	checkOutput(t, "set s \"10,9,2.5,-1\"\nsplit p s ,\nsort p text\nprint $p0 $p1 $p2 $p3", "-1 10 2.5 9\n", "")
+	checkOutput(t, "set s \"pear,apple,fig\"\nsplit p s ,\nsort p text\nprint $p0 $p1 $p2", "apple fig pear\n", "")
+	// Only the first pN values are sorted.
+	checkOutput(t, "set p0 5\nset p1 3\nset p2 1\nset pN 2\nsort p\nprint $p0 $p1 $p2", "3 5 1\n", "")
+	checkOutput(t, "set pN 0\nsort p", "", "")
+
+	checkOutput(t, "set s \"b,a\"\nsplit p s ,\nsort p", "", "line 3: "+fmt.Sprintf(NotNumberValueError, "p0", "b")+"\n")
+	checkOutput(t, "set pN 2\nset p0 1\nsort p", "", "line 3: "+fmt.Sprintf(UndefinedVariableError, "p1")+"\n")
+	checkOutput(t, "set pN -1\nsort p", "", "line 2: "+fmt.Sprintf(NegativeCountError, "pN", -1)+"\n")
+	checkOutput(t, "sort p", "", "line 1: "+fmt.Sprintf(UndefinedVariableError, "pN")+"\n")
+	if _, err := Parse("sort p bogus"); err == nil || err.Error() != fmt.Sprintf(UnknownSortOrderError, "bogus") {
+		t.Errorf("Parse of an unknown order = %v, want %q", err, fmt.Sprintf(UnknownSortOrderError, "bogus"))
+	}
+}
+
+func TestSortKeepsTypes(t *testing.T) {
+	var out, errs syncBuffer
+	l := newTestLoop(&out, &errs)
+	l.Vars().Set("x1", StringValue("2"))
+	l.Start()
+	postScript(t, l, "set x0 3\nset x2 1.5\nset xN 3\nsort x")
+	l.AwaitFinish()
+	if errs.String() != "" {
+		t.Fatalf("errors = %q", errs.String())
+	}
+
+	for name, want := range map[string]Value{"x0": FloatValue(1.5), "x1": StringValue("2"), "x2": IntValue(3)} {
+		if got, _ := l.Vars().Get(name); got != want {
+			t.Errorf("%s = %#v, want %#v", name, got, want)
+		}
+	}
+}
+
+func TestHash(t *testing.T) {
+	checkOutput(t, "set s hello\nhash c s crc32\nprint $c", "3610a686\n", "")
+	checkOutput(t, "set s hello\nhash h s sha256\nprint $h", "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824\n", "")
+	checkOutput(t, "set s \"\"\nhash c s crc32\nprint $c", "00000000\n", "")
+
+	if _, err := Parse("hash d s md5"); err == nil || err.Error() != fmt.Sprintf(UnknownHashError, "md5", "crc32, sha256") {
+		t.Errorf("Parse of an unknown hash = %v, want %q", err, fmt.Sprintf(UnknownHashError, "md5", "crc32, sha256"))
+	}
+	checkOutput(t, "set n 5\nhash d n crc32", "", "line 2: "+fmt.Sprintf(NotStringValueError, "n", 5)+"\n")
+}
@@ -0,0 +1,486 @@
+package eventloop
+
+import (
+	"strconv"
+	"strings"
+)
+
+// MARK: - Instruction text
+
+// The String methods below give the instruction a built-in command was
+// parsed from, such as "add x 2", so that parsing it again yields an
+// equivalent command. A block spans several lines. Commands posted by the
+// loop itself, like the prints of results and errors, read as the print of
+// the same text.
+
+// instruction joins fields into an instruction line, quoting those that
+// wouldn't otherwise read back as a single field.
+func instruction(fields ...string) string {
+	quoted := make([]string, len(fields))
+	for i, f := range fields {
+		quoted[i] = quoteField(f)
+	}
+	return strings.Join(quoted, " ")
+}
+
+func operandFields(ops []operand) []string {
+	fields := make([]string, len(ops))
+	for i, o := range ops {
+		fields[i] = o.String()
+	}
+	return fields
+}
+
+func quoteField(f string) string {
+	if f != "" && !strings.ContainsAny(f, " \t\r\n\v\f\"") && f[0] != '#' {
+		return f
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(f) + `"`
+}
+
+// wrapped appends the instruction of the command taken by a wrapping command,
+// which is already quoted, to the wrapping command's own fields.
+func wrapped(cmd Command, fields ...string) string {
+	return instruction(fields...) + " " + textOf(cmd)
+}
+
+// block gives the lines of a block: its first line, the instructions of
+// body and its end.
+func block(first, end string, body []Command) string {
+	lines := []string{first}
+	for _, cmd := range body {
+		lines = append(lines, textOf(cmd))
+	}
+	return strings.Join(append(lines, end), "\n")
+}
+
+// textOf returns the instruction of cmd, or "" for a command without one.
+func textOf(cmd Command) string {
+	if s, ok := cmd.(interface{ String() string }); ok {
+		return s.String()
+	}
+	return ""
+}
+
+func (p *printCommand) String() string {
+	arg := p.arg
+	if !p.expand {
+		arg = strings.ReplaceAll(arg, "$", "$$")
+	}
+	if arg == "" {
+		return "print"
+	}
+	return instruction("print", arg)
+}
+
+func (p *printfCommand) String() string {
+	fields := []string{"printf", p.format}
+	for _, arg := range p.args {
+		fields = append(fields, arg.String())
+	}
+	return instruction(fields...)
+}
+
+func (e *errorCommand) String() string {
+	return instruction("error", e.msg)
+}
+
+func (add *addCommand) String() string {
+	return instruction(append([]string{"add"}, operandFields(add.args)...)...)
+}
+
+func (sub *subCommand) String() string {
+	return instruction("sub", sub.arg1.String(), sub.arg2.String())
+}
+
+func (mul *mulCommand) String() string {
+	return instruction("mul", mul.arg1.String(), mul.arg2.String())
+}
+
+func (div *divCommand) String() string {
+	return instruction("div", div.arg1.String(), div.arg2.String())
+}
+
+func (mod *modCommand) String() string {
+	return instruction("mod", mod.arg1.String(), mod.arg2.String())
+}
+
+func (pow *powCommand) String() string {
+	return instruction("pow", pow.arg1.String(), pow.arg2.String())
+}
+
+func (neg *negCommand) String() string {
+	return instruction("neg", neg.arg.String())
+}
+
+func (m *minCommand) String() string {
+	return instruction("min", m.dest, m.arg1.String(), m.arg2.String())
+}
+
+func (m *maxCommand) String() string {
+	return instruction("max", m.dest, m.arg1.String(), m.arg2.String())
+}
+
+func (sum *sumCommand) String() string {
+	return instruction(append([]string{"sum", sum.dest}, operandFields(sum.args)...)...)
+}
+
+func (a *absCommand) String() string {
+	return instruction("abs", a.dest, a.arg.String())
+}
+
+func (add *addfCommand) String() string {
+	return instruction("addf", add.arg1.String(), add.arg2.String())
+}
+
+func (sub *subfCommand) String() string {
+	return instruction("subf", sub.arg1.String(), sub.arg2.String())
+}
+
+func (mul *mulfCommand) String() string {
+	return instruction("mulf", mul.arg1.String(), mul.arg2.String())
+}
+
+func (div *divfCommand) String() string {
+	return instruction("divf", div.arg1.String(), div.arg2.String())
+}
+
+func (s *sleepCommand) String() string {
+	return instruction("sleep", strconv.FormatInt(s.d.Milliseconds(), 10))
+}
+
+func (w *waitsignalCommand) String() string {
+	return instruction("waitsignal", w.name)
+}
+
+func (s *signalCommand) String() string {
+	return instruction("signal", s.name)
+}
+
+func (a *afterCommand) String() string {
+	return wrapped(a.cmd, "after", strconv.FormatInt(a.d.Milliseconds(), 10))
+}
+
+func (t *timeoutCommand) String() string {
+	return wrapped(t.cmd, "timeout", strconv.FormatInt(t.d.Milliseconds(), 10))
+}
+
+func (r *retryCommand) String() string {
+	fields := []string{"retry", strconv.Itoa(r.n)}
+	if r.backoff > 0 {
+		fields = append(fields, strconv.FormatInt(r.backoff.Milliseconds(), 10))
+	}
+	return wrapped(r.cmd, fields...)
+}
+
+func (r *repeatCommand) String() string {
+	return wrapped(r.cmd, "repeat", strconv.FormatInt(r.n, 10))
+}
+
+func (f *foreachCommand) String() string {
+	return wrapped(f.cmd, "foreach", f.name, strconv.FormatInt(f.start, 10), strconv.FormatInt(f.end, 10))
+}
+
+func (r *reduceCommand) String() string {
+	return instruction("reduce", r.dest, strconv.FormatInt(r.start, 10), strconv.FormatInt(r.end, 10), r.op, strconv.FormatInt(r.init, 10))
+}
+
+func (c *condition) fields() []string {
+	return []string{c.name, c.op, c.value.String()}
+}
+
+func (i *ifCommand) String() string {
+	return wrapped(i.cmd, append([]string{"if"}, i.cond.fields()...)...)
+}
+
+func (w *whendefCommand) String() string {
+	return wrapped(w.cmd, "whendef", w.name)
+}
+
+func (c *cmpCommand) String() string {
+	return instruction("cmp", c.dest, c.arg1.String(), c.op, c.arg2.String())
+}
+
+func (l *logicCommand) String() string {
+	return instruction(l.op, l.dest, l.arg1.String(), l.arg2.String())
+}
+
+func (n *notCommand) String() string {
+	return instruction("not", n.dest, n.arg.String())
+}
+
+func (d *definedCommand) String() string {
+	return instruction("defined", d.dest, d.name)
+}
+
+func (s *selectCommand) String() string {
+	return instruction("select", s.dest, s.cond.String(), s.a.String(), s.b.String())
+}
+
+func (s *stopifCommand) String() string {
+	return instruction(append([]string{"stopif"}, s.cond.fields()...)...)
+}
+
+func (a *assertCommand) String() string {
+	return instruction(append([]string{"assert"}, a.cond.fields()...)...)
+}
+
+func (r *requireCommand) String() string {
+	fields := []string{"require"}
+	for _, req := range r.reqs {
+		fields = append(fields, req.name+":"+req.typ)
+	}
+	return instruction(fields...)
+}
+
+func (a *assertemptyCommand) String() string {
+	return "assertempty"
+}
+
+func (w *whileCommand) String() string {
+	return block(instruction(append([]string{"while"}, w.cond.fields()...)...), "endwhile", w.body)
+}
+
+func (d *defCommand) String() string {
+	return block(instruction("def", d.name), "enddef", d.body)
+}
+
+func (p *parallelCommand) String() string {
+	return block("parallel", "endparallel", p.cmds)
+}
+
+func (b *batchCommand) String() string {
+	return block("batch", "endbatch", b.cmds)
+}
+
+func (c *callCommand) String() string {
+	return instruction("call", c.name)
+}
+
+func (l *labelCommand) String() string {
+	return instruction("label", l.name)
+}
+
+func (g *gotoCommand) String() string {
+	return instruction("goto", g.label)
+}
+
+func (inc *includeCommand) String() string {
+	return instruction("include", inc.path)
+}
+
+func (e *evalCommandsCommand) String() string {
+	return instruction("eval-commands", e.name)
+}
+
+func (e *execCommand) String() string {
+	if e.name != "" {
+		return instruction(append([]string{"capture", e.name, e.prog}, e.args...)...)
+	}
+	return instruction(append([]string{"exec", e.prog}, e.args...)...)
+}
+
+func (r *readfileCommand) String() string {
+	return instruction("readfile", r.name, r.path)
+}
+
+func (w *writefileCommand) String() string {
+	return instruction("writefile", w.path, w.name)
+}
+
+func (p *pushCommand) String() string {
+	return instruction("push", p.arg.String())
+}
+
+func (p *popCommand) String() string {
+	return instruction("pop", p.name)
+}
+
+func (o *opCommand) String() string {
+	return instruction("op", o.op)
+}
+
+func (e *evalCommand) String() string {
+	return instruction("eval", e.name, e.src)
+}
+
+func (n *nowCommand) String() string {
+	return instruction("now", n.name, n.format)
+}
+
+func (tic *ticCommand) String() string {
+	return instruction("tic", tic.label)
+}
+
+func (toc *tocCommand) String() string {
+	return instruction("toc", toc.label)
+}
+
+func (p *priorityCommand) String() string {
+	return wrapped(p.cmd, "priority", strconv.Itoa(p.n))
+}
+
+func (r *routeCommand) String() string {
+	return wrapped(r.cmd, "route", r.loop)
+}
+
+func (set *setCommand) String() string {
+	return instruction("set", set.name, set.val.String())
+}
+
+func (inc *incCommand) String() string {
+	if inc.delta < 0 {
+		return instruction("dec", inc.name)
+	}
+	return instruction("inc", inc.name)
+}
+
+func (a *addtoCommand) String() string {
+	return instruction("addto", a.name, a.amount.String())
+}
+
+func (r *randCommand) String() string {
+	return instruction("rand", r.name, r.min.String(), r.max.String())
+}
+
+func (g *getenvCommand) String() string {
+	return instruction("getenv", g.name, g.env)
+}
+
+func (c *concatCommand) String() string {
+	return instruction("concat", c.name, c.arg1, c.arg2)
+}
+
+func (l *lenCommand) String() string {
+	return instruction("len", l.dest, l.src)
+}
+
+func (t *textCommand) String() string {
+	return instruction(t.op, t.dest, t.src)
+}
+
+func (s *splitCommand) String() string {
+	return instruction("split", s.prefix, s.src, s.sep)
+}
+
+func (j *joinCommand) String() string {
+	return instruction(append([]string{"join", j.dest, j.sep}, j.names...)...)
+}
+
+func (s *sortCommand) String() string {
+	return instruction("sort", s.prefix, s.order)
+}
+
+func (h *hashCommand) String() string {
+	return instruction("hash", h.dest, h.src, h.algo)
+}
+
+func (t *tobaseCommand) String() string {
+	return instruction("tobase", t.dest, t.src.String(), strconv.Itoa(t.base))
+}
+
+func (f *frombaseCommand) String() string {
+	return instruction("frombase", f.dest, f.src, strconv.Itoa(f.base))
+}
+
+func (r *readCommand) String() string {
+	return instruction("read", r.name)
+}
+
+func (get *getCommand) String() string {
+	return instruction("get", get.name)
+}
+
+func (u *unsetCommand) String() string {
+	return instruction("unset", u.name)
+}
+
+func (d *dumpvarsCommand) String() string {
+	return "dumpvars"
+}
+
+func (s *savevarsCommand) String() string {
+	return instruction("savevars", s.name)
+}
+
+func (l *loadvarsCommand) String() string {
+	return instruction("loadvars", l.name)
+}
+
+func (c *copyCommand) String() string {
+	if c.move {
+		return instruction("mv", c.dest, c.src)
+	}
+	return instruction("cp", c.dest, c.src)
+}
+
+func (s *swapCommand) String() string {
+	return instruction("swap", s.a, s.b)
+}
+
+func (c *clearCommand) String() string {
+	return "clear"
+}
+
+func (n *nopCommand) String() string {
+	return "nop"
+}
+
+func (b *barrierCommand) String() string {
+	return "barrier"
+}
+
+func (c *cancelCommand) String() string {
+	return instruction("cancel", strconv.FormatUint(c.id, 10))
+}
+
+func (c *cancelscheduledCommand) String() string {
+	return "cancelscheduled"
+}
+
+func (f *flushCommand) String() string {
+	return "flush"
+}
+
+func (q *qdepthCommand) String() string {
+	return "qdepth"
+}
+
+func (t *traceCommand) String() string {
+	return "trace"
+}
+
+func (t *throughputCommand) String() string {
+	return instruction("throughput", strconv.FormatInt(t.d.Milliseconds(), 10))
+}
+
+func (s *statsCommand) String() string {
+	return "stats"
+}
+
+func (e *exitCommand) String() string {
+	return instruction("exit", strconv.Itoa(e.code))
+}
+
+func (a *aliasCommand) String() string {
+	return instruction("alias", a.name, a.target)
+}
+
+func (h *helpCommand) String() string {
+	if h.name == "" {
+		return "help"
+	}
+	return instruction("help", h.name)
+}
+
+func (r *resultCommand) String() string {
+	return textOf(r.cmd)
+}
+
+func (p *postedCommand) String() string {
+	return textOf(p.cmd)
+}
+
+func (f *fileCommand) String() string {
+	return textOf(f.cmd)
+}
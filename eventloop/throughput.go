@@ -0,0 +1,66 @@
+package eventloop
+
+import (
+	"fmt"
+	"time"
+)
+
+const InvalidWindowError string = "SYNTAX ERROR: throughput window '%v' must be a positive number of milliseconds"
+
+// MARK: - Throughput
+
+// throughputCommand measures how many commands the loop executes during the
+// window that follows it, and prints the count and the rate per second. It
+// doesn't block the loop meanwhile: the commands executed are counted by the
+// loop's metrics before the window and once its timer fires, so the count
+// includes the throughput command itself, and the window is timed on the
+// loop's clock. A draining loop waits for the window to end, but Stop drops
+// it; resetting the stats during the window spoils the count.
+type throughputCommand struct {
+	d time.Duration
+}
+
+func (t *throughputCommand) attrs() []any {
+	return []any{"window", t.d}
+}
+
+func (t *throughputCommand) Execute(handler Handler) {
+	h, ok := findHandler[workerHandler](handler)
+	if !ok {
+		return
+	}
+	start := h.clock()
+	before := h.metrics.executed()
+	h.timers.schedule(t.d, func() {
+		if h.isStopped.Load() {
+			return
+		}
+		n := max(h.metrics.executed()-before, 0)
+		elapsed := h.clock().Sub(start)
+		rate := 0.0
+		if elapsed > 0 {
+			rate = float64(n) / elapsed.Seconds()
+		}
+		msg := fmt.Sprintf("throughput: %v commands in %v, %v/s", n, elapsed, formatFloat(handler, rate))
+		h.queue.push(&printCommand{arg: msg})
+	})
+}
+
+// executed returns the number of commands executed.
+func (m *metrics) executed() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.stats.Executed
+}
+
+func parseThroughput(args []string) (Command, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "throughput")
+	}
+	d, err := parseMillis(args[0])
+	if err != nil || d == 0 {
+		return nil, fmt.Errorf(InvalidWindowError, args[0])
+	}
+	return &throughputCommand{d: d}, nil
+}
@@ -0,0 +1,50 @@
+package eventloop
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var throughputLine = regexp.MustCompile(`^throughput: (\d+) commands in (\S+), (\S+)/s\n$`)
+
+func TestThroughput(t *testing.T) {
+	const n = 500
+	script := "throughput 50" + strings.Repeat("\nnop", n)
+	out, errs := runScript(t, script)
+	if errs != "" {
+		t.Fatalf("errors = %q, want none", errs)
+	}
+
+	m := throughputLine.FindStringSubmatch(out)
+	if m == nil {
+		t.Fatalf("output = %q, want the throughput", out)
+	}
+	// The nops are queued already, so they all run within the window, and
+	// the count includes throughput itself.
+	if count, _ := strconv.Atoi(m[1]); count != n+1 {
+		t.Errorf("counted %s commands, want %d", m[1], n+1)
+	}
+	if elapsed, err := time.ParseDuration(m[2]); err != nil || elapsed < 50*time.Millisecond {
+		t.Errorf("window of %s, want at least 50ms", m[2])
+	}
+	if rate, err := strconv.ParseFloat(m[3], 64); err != nil || rate <= 0 || rate > float64(n+1)/0.05 {
+		t.Errorf("rate of %s/s, want a positive one of at most %d commands over 50ms", m[3], n+1)
+	}
+}
+
+func TestThroughputClock(t *testing.T) {
+	// The window is timed on the loop's clock, here read once at either end.
+	checkOutput(t, "throughput 10\nnop", "throughput: 2 commands in 2s, 1/s\n", "", WithClock(steppingClock(2*time.Second)))
+}
+
+func TestThroughputInvalidWindow(t *testing.T) {
+	for _, arg := range []string{"0", "-5", "x"} {
+		if _, err := Parse("throughput " + arg); err == nil || err.Error() != fmt.Sprintf(InvalidWindowError, arg) {
+			t.Errorf("Parse of a window of %s = %v, want %q", arg, err, fmt.Sprintf(InvalidWindowError, arg))
+		}
+	}
+}
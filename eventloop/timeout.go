@@ -0,0 +1,113 @@
+package eventloop
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+const CommandTimeoutError string = "error: %v command timed out after %v"
+
+// MARK: - Timeout
+
+// timeoutCommand executes cmd in place, but gives up on it with an error once
+// it has run for d. cmd executes on a goroutine of its own so that the worker
+// can stop waiting for it. Go has no way to stop a goroutine, though, so an
+// abandoned command goes on running and may still set variables and post
+// commands while the loop runs; only its result is dropped. Once the loop
+// has stopped, its posts and output are dropped too, and AwaitFinish waits
+// for it to return. A panic of a command that finishes in time is raised
+// again on the worker, as if it had run there; that of an abandoned one is
+// dropped.
+type timeoutCommand struct {
+	d   time.Duration
+	cmd Command
+}
+
+func (t *timeoutCommand) attrs() []any {
+	return []any{"timeout", t.d}
+}
+
+func (t *timeoutCommand) Execute(handler Handler) {
+	// Both are buffered, so that an abandoned command never blocks on them.
+	results := make(chan any, 1)
+	done := make(chan any, 1)
+	inner := &timeoutHandler{Handler: handler}
+	if h, ok := findHandler[workerHandler](handler); ok {
+		inner.loop = h.EventLoop
+		h.abandoned.Add(1)
+	}
+	go func() {
+		defer func() {
+			if inner.loop != nil {
+				inner.loop.abandoned.Done()
+			}
+			done <- recover()
+		}()
+		t.cmd.Execute(&resultHandler{Handler: inner, results: results})
+	}()
+	timer := time.NewTimer(t.d)
+	defer timer.Stop()
+	select {
+	case r := <-done:
+		if r != nil {
+			panic(r)
+		}
+		select {
+		case val := <-results:
+			returnResult(handler, val)
+		default:
+		}
+	case <-timer.C:
+		handler.Post(&errorCommand{msg: fmt.Sprintf(CommandTimeoutError, commandName(t.cmd), t.d)})
+	}
+}
+
+// timeoutHandler drops what the command of a timeout posts and prints once
+// the loop has stopped, which only a command abandoned by it still does.
+type timeoutHandler struct {
+	Handler
+	loop *EventLoop
+}
+
+func (h *timeoutHandler) unwrap() Handler {
+	return h.Handler
+}
+
+func (h *timeoutHandler) stopped() bool {
+	return h.loop != nil && h.loop.Stopped()
+}
+
+func (h *timeoutHandler) Post(cmd Command) {
+	if !h.stopped() {
+		h.Handler.Post(cmd)
+	}
+}
+
+func (h *timeoutHandler) Schedule(d time.Duration, cmd Command) {
+	if !h.stopped() {
+		h.Handler.Schedule(d, cmd)
+	}
+}
+
+func (h *timeoutHandler) Output() io.Writer {
+	if h.stopped() {
+		return io.Discard
+	}
+	return h.Handler.Output()
+}
+
+func (r *Registry) parseTimeout(args []string) (Command, error) {
+	if len(args) < 2 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "timeout")
+	}
+	d, err := parseMillis(args[0])
+	if err != nil {
+		return nil, err
+	}
+	cmd, err := r.parseFields(args[1:])
+	if err != nil {
+		return nil, err
+	}
+	return &timeoutCommand{d: d, cmd: cmd}, nil
+}
@@ -0,0 +1,34 @@
+package eventloop
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimeout(t *testing.T) {
+	var out, errs syncBuffer
+	l := newTestLoop(&out, &errs)
+	l.Start()
+	start := time.Now()
+	postScript(t, l, "timeout 20 sleep 500\nprint after")
+	// The loop goes on while the sleep it abandoned runs, though AwaitFinish
+	// waits for it.
+	for !strings.Contains(out.String(), "after") {
+		if time.Since(start) >= 400*time.Millisecond {
+			t.Fatal("the timeout did not cut the sleep short")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	l.AwaitFinish()
+
+	want := "line 1: " + fmt.Sprintf(CommandTimeoutError, "sleep", 20*time.Millisecond) + "\n"
+	if got := errs.String(); got != want {
+		t.Errorf("errors = %q, want %q", got, want)
+	}
+}
+
+func TestTimeoutNotReached(t *testing.T) {
+	checkOutput(t, "timeout 500 sleep 1\ntimeout 500 add 1 2", "3\n", "")
+}
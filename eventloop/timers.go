@@ -0,0 +1,74 @@
+package eventloop
+
+import (
+	"sync"
+	"time"
+)
+
+// MARK: - timers
+
+// timers tracks the commands scheduled by after that have not fired yet.
+type timers struct {
+	pending map[*time.Timer]struct{}
+	mu      sync.Mutex
+	idle    *sync.Cond
+}
+
+func newTimers() *timers {
+	t := &timers{pending: make(map[*time.Timer]struct{})}
+	t.idle = sync.NewCond(&t.mu)
+	return t
+}
+
+// schedule runs fn after d unless the timer is cancelled first.
+func (t *timers) schedule(d time.Duration, fn func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var timer *time.Timer
+	timer = time.AfterFunc(d, func() {
+		t.mu.Lock()
+		_, ok := t.pending[timer]
+		t.mu.Unlock()
+		if !ok {
+			return
+		}
+		fn()
+		t.remove(timer)
+	})
+	t.pending[timer] = struct{}{}
+}
+
+func (t *timers) remove(timer *time.Timer) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.pending, timer)
+	if len(t.pending) == 0 {
+		t.idle.Broadcast()
+	}
+}
+
+// wait blocks until no timer is pending.
+func (t *timers) wait() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for len(t.pending) > 0 {
+		t.idle.Wait()
+	}
+}
+
+// cancelAll stops every pending timer and returns how many there were.
+func (t *timers) cancelAll() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	n := len(t.pending)
+	for timer := range t.pending {
+		timer.Stop()
+		delete(t.pending, timer)
+	}
+	t.idle.Broadcast()
+	return n
+}
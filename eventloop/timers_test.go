@@ -0,0 +1,64 @@
+package eventloop
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCancelScheduled(t *testing.T) {
+	var out, errs syncBuffer
+	l := newTestLoop(&out, &errs)
+	l.Start()
+	postScript(t, l, "after 30 print late\nafter 40 add 1 2\nafter 50 after 10 print later\ncancelscheduled\nprint now")
+	start := time.Now()
+	l.AwaitFinish()
+
+	// Nothing is left for AwaitFinish to wait for.
+	if d := time.Since(start); d >= 30*time.Millisecond {
+		t.Errorf("AwaitFinish took %v, want the timers gone", d)
+	}
+	time.Sleep(80 * time.Millisecond)
+	if got := out.String(); got != "now\n" {
+		t.Errorf("output = %q, want none of the cancelled commands run", got)
+	}
+	if got := errs.String(); got != "" {
+		t.Errorf("errors = %q, want none", got)
+	}
+}
+
+func TestCancelScheduledCount(t *testing.T) {
+	var out, errs syncBuffer
+	var n atomic.Int64
+	l := newTestLoop(&out, &errs)
+	l.Start()
+	for range 3 {
+		l.Schedule(20*time.Millisecond, countCommand{&n})
+	}
+	if got := <-l.PostWithResult(mustParse(t, "cancelscheduled")); got != 3 {
+		t.Errorf("cancelscheduled cancelled %v, want 3", got)
+	}
+	if got := l.CancelScheduled(); got != 0 {
+		t.Errorf("CancelScheduled cancelled %d once none was left, want 0", got)
+	}
+	l.AwaitFinish()
+	time.Sleep(40 * time.Millisecond)
+	if got := n.Load(); got != 0 {
+		t.Errorf("%d cancelled commands executed, want none", got)
+	}
+}
+
+func TestCancelScheduledStopped(t *testing.T) {
+	var out, errs syncBuffer
+	var n atomic.Int64
+	l := newTestLoop(&out, &errs)
+	l.Start()
+	l.Schedule(10*time.Millisecond, countCommand{&n})
+	l.Schedule(time.Hour, countCommand{&n})
+	l.Stop()
+	l.CancelScheduled()
+	time.Sleep(30 * time.Millisecond)
+	if got := n.Load(); got != 0 {
+		t.Errorf("%d commands executed after Stop, want none", got)
+	}
+}
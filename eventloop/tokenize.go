@@ -0,0 +1,124 @@
+package eventloop
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const UnterminatedQuoteError string = "SYNTAX ERROR: unterminated quote"
+
+// MARK: - Tokenizer
+
+// tokenize splits line into whitespace-separated fields. A double-quoted
+// segment is part of one field even if it contains spaces; inside it \" and
+// \\ stand for a literal quote and backslash. An unquoted field starting with
+// '#' begins a comment, which runs to the end of the line.
+func tokenize(line string) ([]string, error) {
+	fields, _, err := tokenizeInstruction(line)
+	return fields, err
+}
+
+// tokenizeInstruction is tokenize, also returning the indexes of the fields
+// that are an unquoted parallelSeparator, which separate the commands of a
+// parallel on one line. A quoted ";" is a field like any other.
+func tokenizeInstruction(line string) ([]string, []int, error) {
+	var fields []string
+	var seps []int
+	var field strings.Builder
+	inField, inQuotes, quoted, escaped := false, false, false, false
+	endField := func() {
+		if !quoted && field.String() == parallelSeparator {
+			seps = append(seps, len(fields))
+		}
+		fields = append(fields, field.String())
+		field.Reset()
+		inField, quoted = false, false
+	}
+
+	for _, r := range line {
+		switch {
+		case escaped:
+			field.WriteRune(r)
+			escaped = false
+		case inQuotes && r == '\\':
+			escaped = true
+		case r == '"':
+			inQuotes = !inQuotes
+			inField, quoted = true, true
+		case inQuotes:
+			field.WriteRune(r)
+		case unicode.IsSpace(r):
+			if inField {
+				endField()
+			}
+		case r == '#' && !inField:
+			return fields, seps, nil
+		default:
+			field.WriteRune(r)
+			inField = true
+		}
+	}
+	if inQuotes {
+		return nil, nil, errors.New(UnterminatedQuoteError)
+	}
+	if inField {
+		endField()
+	}
+	return fields, seps, nil
+}
+
+// SplitInstructions splits line into the instructions separated by sep, which
+// doesn't separate anything inside a double-quoted segment or a comment. A
+// trailing separator yields an empty instruction, which parses as nothing.
+// If sep is ';', an instruction starting with parallel, or an alias of it,
+// takes the rest of the line, whose ';' separate the commands it runs. It
+// knows the built-in commands only; see LineParser.SplitInstructions.
+func SplitInstructions(line string, sep rune) []string {
+	return builtins.splitInstructions(line, sep)
+}
+
+// SplitInstructions is the package-level SplitInstructions, knowing the
+// commands of p and the aliases defined by the lines it parsed so far.
+func (p *LineParser) SplitInstructions(line string, sep rune) []string {
+	return p.registry.splitInstructions(line, sep)
+}
+
+func (r *Registry) splitInstructions(line string, sep rune) []string {
+	var parts []string
+	start := 0
+	atFieldStart, inQuotes, escaped := true, false, false
+
+	for i, c := range line {
+		if atFieldStart && start == i && string(sep) == parallelSeparator && r.startsParallel(line[i:]) {
+			return append(parts, line[start:])
+		}
+		switch {
+		case escaped:
+			escaped = false
+		case inQuotes && c == '\\':
+			escaped = true
+		case c == '"':
+			inQuotes = !inQuotes
+			atFieldStart = false
+		case inQuotes:
+		case c == sep:
+			parts = append(parts, line[start:i])
+			start = i + utf8.RuneLen(c)
+			atFieldStart = true
+		case c == '#' && atFieldStart:
+			return append(parts, line[start:])
+		default:
+			atFieldStart = unicode.IsSpace(c)
+		}
+	}
+	return append(parts, line[start:])
+}
+
+// startsParallel reports whether the instruction s is a parallel with
+// commands on its line.
+func (r *Registry) startsParallel(s string) bool {
+	fields := strings.Fields(s)
+	return len(fields) > 1 && r.isParallel(fields[0]) && !strings.HasPrefix(fields[1], "#")
+}
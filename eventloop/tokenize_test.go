@@ -0,0 +1,103 @@
+package eventloop
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want []string
+	}{
+		{"plain", "add 1 2", []string{"add", "1", "2"}},
+		{"quoted words", `print "hello big world" x`, []string{"print", "hello big world", "x"}},
+		{"empty quotes", `concat s "" b`, []string{"concat", "s", "", "b"}},
+		{"escaped quotes", `print "say \"hi\"" "back\\slash"`, []string{"print", `say "hi"`, `back\slash`}},
+		{"quoted part of a field", `print ab"c d"e`, []string{"print", "abc de"}},
+		{"comment", `print a # "not a field"`, []string{"print", "a"}},
+		{"quoted hash", `print "# no comment"`, []string{"print", "# no comment"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tokenize(tt.line)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("tokenize(%q) = %q, want %q", tt.line, got, tt.want)
+			}
+		})
+	}
+
+	if _, err := tokenize(`print "open`); err == nil || err.Error() != UnterminatedQuoteError {
+		t.Errorf("tokenize of an unterminated quote: error %v, want %q", err, UnterminatedQuoteError)
+	}
+}
+
+func TestTokenizeSeparators(t *testing.T) {
+	tests := []struct {
+		line string
+		want []int
+	}{
+		{"parallel print a ; print b", []int{3}},
+		{`parallel print ";" ; print b`, []int{3}},
+		{`parallel print a";" ; print b;`, []int{3}},
+		{"parallel a ; b ; c # ; d", []int{2, 4}},
+		{"print a", nil},
+	}
+	for _, tt := range tests {
+		_, seps, err := tokenizeInstruction(tt.line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(seps, tt.want) {
+			t.Errorf("separators of %q = %v, want %v", tt.line, seps, tt.want)
+		}
+	}
+}
+
+func TestSplitInstructions(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		sep  rune
+		want []string
+	}{
+		{"several", "set x 1; add x 2; print done", ';', []string{"set x 1", " add x 2", " print done"}},
+		{"trailing separator", "print a;", ';', []string{"print a", ""}},
+		{"empty instruction", "print a;;print b", ';', []string{"print a", "", "print b"}},
+		{"quoted separator", `print "a;b"; print c`, ';', []string{`print "a;b"`, " print c"}},
+		{"escaped quote", `print "a\";b"; print c`, ';', []string{`print "a\";b"`, " print c"}},
+		{"comment", "print a # b; print c", ';', []string{"print a # b; print c"}},
+		{"other separator", "print a | print b;c", '|', []string{"print a ", " print b;c"}},
+		{"parallel", "parallel sleep 10 ; print a", ';', []string{"parallel sleep 10 ; print a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SplitInstructions(tt.line, tt.sep); !slices.Equal(got, tt.want) {
+				t.Errorf("SplitInstructions(%q, %q) = %q, want %q", tt.line, tt.sep, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitInstructionsAlias(t *testing.T) {
+	r := DefaultRegistry()
+	if err := r.Alias("par", "parallel"); err != nil {
+		t.Fatal(err)
+	}
+	line := "par sleep 10 ; print a"
+	if got, want := r.LineParser().SplitInstructions(line, ';'), []string{line}; !slices.Equal(got, want) {
+		t.Errorf("SplitInstructions(%q) = %q, want the alias of parallel to take the line", line, got)
+	}
+	// An alias defined by a line parsed before counts too.
+	p := NewLineParser()
+	if _, err := p.Parse("alias par parallel"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := p.SplitInstructions(line, ';'), []string{line}; !slices.Equal(got, want) {
+		t.Errorf("SplitInstructions(%q) after alias = %q, want %q", line, got, want)
+	}
+}
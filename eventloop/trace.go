@@ -0,0 +1,93 @@
+package eventloop
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+const TraceOffError string = "error: trace: the loop isn't recording a trace"
+
+// MARK: - Trace
+
+// WithTrace makes the loop record the instruction of every command it
+// executes, for Trace and the trace command. The trace grows with every
+// command, so recording is off by default.
+func WithTrace(enabled bool) Option {
+	return func(l *EventLoop) {
+		if enabled {
+			l.trace = &trace{}
+		} else {
+			l.trace = nil
+		}
+	}
+}
+
+// trace holds the instructions executed so far, in the order they finished.
+type trace struct {
+	cmds []string
+	mu   sync.Mutex
+}
+
+func (t *trace) record(cmd Command) {
+	cmd, _ = sourceLine(cmd)
+	text := textOf(cmd)
+	if text == "" {
+		text = commandName(cmd)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.cmds = append(t.cmds, text)
+}
+
+func (t *trace) snapshot() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([]string(nil), t.cmds...)
+}
+
+// Trace returns the instructions of the commands the loop has executed, in
+// the order they finished, or nil unless it was created with WithTrace. The
+// loop's bookkeeping, like the commands of Wait, is left out; the commands
+// executed in place by another, like those of repeat, are part of its
+// instruction.
+func (l *EventLoop) Trace() []string {
+	if l.trace == nil {
+		return nil
+	}
+	return l.trace.snapshot()
+}
+
+// traceCommand prints the trace of the loop, one numbered instruction per
+// line, as in "1: add x 2". It isn't part of the trace it prints.
+type traceCommand struct{}
+
+func (t *traceCommand) Execute(handler Handler) {
+	h, ok := findHandler[workerHandler](handler)
+	if !ok {
+		return
+	}
+	if h.trace == nil {
+		handler.Post(&errorCommand{msg: TraceOffError})
+		return
+	}
+	cmds := h.trace.snapshot()
+	if len(cmds) == 0 {
+		return
+	}
+	returnResult(handler, cmds)
+	lines := make([]string, len(cmds))
+	for i, text := range cmds {
+		lines[i] = fmt.Sprintf("%d: %s", i+1, text)
+	}
+	handler.Post(&printCommand{arg: strings.Join(lines, "\n")})
+}
+
+func parseTrace(args []string) (Command, error) {
+	if len(args) != 0 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "trace")
+	}
+	return &traceCommand{}, nil
+}
@@ -0,0 +1,39 @@
+package eventloop
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestTrace(t *testing.T) {
+	var out, errs syncBuffer
+	l := newTestLoop(&out, &errs, WithTrace(true))
+	l.Start()
+	postScript(t, l, "set x 4\nadd x 2\nrepeat 2 print hi\nprint x")
+	l.AwaitFinish()
+
+	// The print of the sum is posted behind the instructions already queued.
+	want := []string{"set x 4", "add x 2", "repeat 2 print hi", "print x", "print 6"}
+	if got := l.Trace(); !slices.Equal(got, want) {
+		t.Errorf("trace = %q, want %q", got, want)
+	}
+}
+
+func TestTraceCommand(t *testing.T) {
+	checkOutput(t, "set x 4\nprint x\ntrace", "x\n1: set x 4\n2: print x\n", "", WithTrace(true))
+}
+
+func TestTraceOff(t *testing.T) {
+	var out, errs syncBuffer
+	l := newTestLoop(&out, &errs)
+	l.Start()
+	postScript(t, l, "print a\ntrace")
+	l.AwaitFinish()
+
+	if got := l.Trace(); got != nil {
+		t.Errorf("trace = %q, want none", got)
+	}
+	if got, want := errs.String(), "line 2: "+TraceOffError+"\n"; got != want {
+		t.Errorf("errors = %q, want %q", got, want)
+	}
+}
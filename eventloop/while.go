@@ -0,0 +1,55 @@
+package eventloop
+
+import "fmt"
+
+const IterationLimitError string = "error: while: iteration limit of %v exceeded"
+
+// MARK: - While
+
+// whileCommand executes its body in place for as long as the condition holds,
+// checking it before every iteration. It gives up with an error after the
+// loop's iteration limit, if it has one, and stops early if a command of the
+// body stops the loop.
+type whileCommand struct {
+	cond *condition
+	body []Command
+}
+
+func (w *whileCommand) attrs() []any {
+	return []any{"var", w.cond.name, "op", w.cond.op, "commands", len(w.body)}
+}
+
+func (w *whileCommand) Execute(handler Handler) {
+	h, ok := findHandler[workerHandler](handler)
+	if !ok {
+		return
+	}
+	for n := 0; ; n++ {
+		if holds, _ := w.cond.eval(handler); !holds || h.Stopped() {
+			return
+		}
+		if h.maxIterations > 0 && n == h.maxIterations {
+			handler.Post(&errorCommand{msg: fmt.Sprintf(IterationLimitError, h.maxIterations)})
+			return
+		}
+		for _, cmd := range w.body {
+			if h.Stopped() {
+				return
+			}
+			cmd.Execute(handler)
+		}
+	}
+}
+
+func parseWhile(args []string) (func(body []Command) Command, error) {
+	cond, err := parseCondition("while", args)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) != 3 {
+		return nil, fmt.Errorf(AmbiguousArgsNumberError, "while")
+	}
+	return func(body []Command) Command {
+		return &whileCommand{cond: cond, body: body}
+	}, nil
+}
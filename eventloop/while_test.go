@@ -0,0 +1,20 @@
+package eventloop
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestWhile(t *testing.T) {
+	checkOutput(t, "set i 0\nwhile i lt 3\nprint $i\ninc i\nendwhile\nprint done", "0\n1\n2\ndone\n", "")
+	// A condition false from the start skips the body.
+	checkOutput(t, "set i 5\nwhile i lt 3\nprint $i\nendwhile\nprint done", "done\n", "")
+	// Loops nest.
+	checkOutput(t, "set i 0\nwhile i lt 2\nset j 0\nwhile j lt 2\nprint $i$j\ninc j\nendwhile\ninc i\nendwhile",
+		"00\n01\n10\n11\n", "")
+}
+
+func TestWhileIterationLimit(t *testing.T) {
+	checkOutput(t, "set i 0\nwhile i ge 0\ninc i\nendwhile\nget i", "5\n",
+		"line 2: "+fmt.Sprintf(IterationLimitError, 5)+"\n", WithMaxIterations(5))
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/Beaxhem/architecture-lab-4/eventloop"
+)
+
+// export is the file written by -export: the variables a run left and its
+// execution stats, the same as GET /stats returns.
+type export struct {
+	Vars     map[string]eventloop.Value `json:"vars"`
+	Stats    eventloop.Stats            `json:"stats"`
+	ExitCode int                        `json:"exitCode"`
+}
+
+// writeExport writes the final state of a finished loop to path as JSON,
+// replacing the file if it exists.
+func writeExport(path string, loop *eventloop.EventLoop) error {
+	data, err := json.MarshalIndent(export{
+		Vars:     loop.Vars().Snapshot(),
+		Stats:    loop.Stats(),
+		ExitCode: loop.ExitCode(),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// exportRun writes the file named by -export, if any, once loop has
+// finished, reporting a failure on stderr. It returns false if the file
+// couldn't be written.
+func exportRun(loop *eventloop.EventLoop) bool {
+	if *exportPath == "" {
+		return true
+	}
+	if err := writeExport(*exportPath, loop); err != nil {
+		fmt.Fprintf(stderr, "-export: %v\n", err)
+		return false
+	}
+	return true
+}
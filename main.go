@@ -2,177 +2,691 @@ package main
 
 import (
 	"bufio"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"math/rand"
 	"os"
-	"strconv"
+	"os/signal"
+	"sort"
 	"strings"
-	"sync"
+	"syscall"
+	"unicode/utf8"
+
+	"github.com/Beaxhem/architecture-lab-4/eventloop"
 )
 
-const AmbiguousArgsNumberError string = "SYNTAX ERROR: number of arguments is ambiguous"
-const NotNumberError string = "SYNTAX ERROR: '%v' is not a number"
-const UnknownCommandError string = "SYNTAX ERROR: unknown command '%v'"
+var inputPath = flag.String("f", "", "Comma-separated paths to files with instructions")
+var inputFD = flag.Int("fd", -1, "Read instructions from this open file descriptor instead of stdin, like 3 for one left open by the parent process")
+var interactive = flag.Bool("i", false, "Run an interactive prompt even if stdin is not a terminal")
+var maxJumps = flag.Int("max-jumps", 0, "Stop a program after this many goto jumps (0 means no limit)")
+var maxIterations = flag.Int("max-iterations", 0, "Stop a while loop after this many iterations (0 means no limit)")
+var maxCommands = flag.Int64("max-commands", 0, "Stop after executing this many commands (0 means no limit)")
+var precision = flag.Int("precision", eventloop.DefaultFloatPrecision, "Digits printed after the decimal point by float commands (-1 prints as many as needed)")
+var seed = flag.Int64("seed", 0, "Seed for the rand command, to get the same numbers on every run (0 picks a random seed)")
+var serveAddr = flag.String("serve", "", "Accept instructions over HTTP at this address, like :8080, instead of reading input")
+var parserName = flag.String("parser", "text", "Instruction language: text, json for one JSON object per line, or another registered parser")
+var format = flag.String("format", "", "Same as -parser, which it predates")
+var dryRun = flag.Bool("dry-run", false, "Only check the input for syntax errors, without executing it")
+var verbose = flag.Bool("v", false, "Report how long each command took on stderr")
+var maxDepth = flag.Int("max-depth", 0, "Reject commands posted while this many are queued (0 means no limit)")
+var dedupe = flag.Bool("dedupe", false, "Skip a command identical to the one queued right before it")
+var watch = flag.Bool("watch", false, "Run the -f files again whenever they change, until interrupted")
+var keepState = flag.Bool("keep-state", false, "In watch mode, keep the variables of the previous run")
+var allowExec = flag.Bool("allow-exec", false, "Let the exec and capture commands run external programs")
+var execTimeout = flag.Duration("exec-timeout", 0, "Kill programs started by exec or capture after this long (0 means no limit)")
+var fileRoot = flag.String("file-root", ".", "Directory readfile and writefile are confined to")
+var rate = flag.Float64("rate", 0, "Execute at most this many commands per second (0 means no limit)")
+var aliases aliasFlags
+var defines = defineFlags{}
+var maxLine = flag.Int("max-line", 1<<20, "Longest instruction line accepted, in bytes")
+var journalPath = flag.String("journal", "", "Append every executed instruction to this file")
+var replayPath = flag.String("replay", "", "Run the instructions journaled by -journal in this file instead of -f, skipping damaged lines")
+var inputFile = flag.String("input", "", "File the read command reads lines from; by default stdin, unless instructions are read from it")
+var separator = flag.String("separator", ";", "Character separating several instructions on one line (empty allows one per line)")
+var color = flag.String("color", "auto", "Show error messages in red: auto (if writing to a terminal), always or never")
+var echo = flag.Bool("echo", false, "Print every instruction of the input on stderr, after its line number, before it executes")
+var printTo = flag.String("print-to", "stdout", "Stream print commands write to: stdout or stderr")
+var idleTimeout = flag.Duration("idle-timeout", 0, "Stop once no command has executed for this long, shutting down -serve too (0 means never)")
+var traceRun = flag.Bool("trace", false, "Record every executed command for the trace command")
+var exportPath = flag.String("export", "", "Write the final variables and execution stats to this file as JSON once the run is over")
+var hold = flag.Bool("hold", false, "Queue the input without executing it until SIGUSR1 is received, or POST /trigger with -serve")
+var strict = flag.Bool("strict", false, "Stop at the first syntax error or failing assert and exit with a non-zero status")
+
+func init() {
+	flag.Var(defines, "D", "Define name for the whendef command, as name=value or just name; may be repeated")
+	flag.Var(&aliases, "alias", "Define name as another name for a command, as name=command; may be repeated")
+}
 
-// MARK: - commandsQueue
+// defineFlags collects the -D flags, by name. A later define of a name
+// replaces an earlier one.
+type defineFlags map[string]string
 
-type commandsQueue struct {
-	queue []Command
-	mu    sync.Mutex
+func (d defineFlags) String() string {
+	fields := make([]string, 0, len(d))
+	for name, value := range d {
+		fields = append(fields, name+"="+value)
+	}
+	sort.Strings(fields)
+	return strings.Join(fields, ",")
 }
 
-func (q *commandsQueue) pull() Command {
-	q.mu.Lock()
-	defer q.mu.Unlock()
+func (d defineFlags) Set(define string) error {
+	name, value, _ := strings.Cut(define, "=")
+	if name == "" {
+		return fmt.Errorf("expected name=value, got %q", define)
+	}
+	d[name] = value
+	return nil
+}
 
-	cmd := q.queue[0]
-	q.queue = q.queue[1:]
-	return cmd
+// aliasFlags collects the -alias flags.
+type aliasFlags []string
+
+func (a *aliasFlags) String() string {
+	return strings.Join(*a, ",")
 }
 
-func (q *commandsQueue) peek() Command {
-	if len(q.queue) == 0 {
-		return nil
+func (a *aliasFlags) Set(value string) error {
+	name, target, ok := strings.Cut(value, "=")
+	if !ok || name == "" || target == "" {
+		return fmt.Errorf("expected name=command, got %q", value)
 	}
-	return q.queue[len(q.queue)-1]
+	*a = append(*a, value)
+	return nil
 }
 
-func (q *commandsQueue) push(cmd Command) {
-	q.mu.Lock()
-	defer q.mu.Unlock()
+// exit terminates the process; replaced in tests.
+var exit = os.Exit
 
-	last := q.peek()
-	if stop, ok := last.(*stopCommand); ok && stop != nil {
-		q.queue[len(q.queue)-1] = cmd
-		q.queue = append(q.queue, last)
-		return
+// exitWith exits with code unless it is 0, in which case main returns
+// normally and runs its deferred cleanup.
+func exitWith(code int) {
+	if code != 0 {
+		exit(code)
 	}
-	q.queue = append(q.queue, cmd)
 }
 
-// MARK: - EventLoop
+// lineParser is what reading instructions takes of a parser. A LineParser
+// has it all; plainParser gives any other Parser the rest.
+type lineParser interface {
+	eventloop.Parser
+	Continue(instruction string) (eventloop.Command, error)
+	SplitInstructions(line string, sep rune) []string
+	Line() int
+	Pending() bool
+	Close() error
+}
+
+// plainParser is a Parser that parses every line on its own.
+type plainParser struct {
+	eventloop.Parser
+	lineNo int
+}
+
+func (p *plainParser) Parse(line string) (eventloop.Command, error) {
+	p.lineNo++
+	return p.Parser.Parse(line)
+}
+
+func (p *plainParser) Continue(instruction string) (eventloop.Command, error) {
+	return p.Parser.Parse(instruction)
+}
+
+func (p *plainParser) SplitInstructions(line string, sep rune) []string {
+	return eventloop.SplitInstructions(line, sep)
+}
+
+func (p *plainParser) Line() int {
+	return p.lineNo
+}
 
-type EventLoop struct {
-	queue      *commandsQueue
-	stopSignal chan struct{}
-	isStopped  bool
+func (p *plainParser) Pending() bool {
+	return false
 }
 
-func NewEventLoop() EventLoop {
-	return EventLoop{
-		queue:      &commandsQueue{queue: make([]Command, 0)},
-		stopSignal: make(chan struct{}),
-		isStopped:  false,
+func (p *plainParser) Close() error {
+	return nil
+}
+
+// newParser returns a parser for instructions in the language selected by
+// -parser, which main has checked.
+func newParser() lineParser {
+	p, _ := eventloop.NewParser(*parserName)
+	if lp, ok := p.(lineParser); ok {
+		return lp
 	}
+	return &plainParser{Parser: p}
 }
 
-func (l *EventLoop) Start() {
-	go func() {
-		for !l.isStopped {
-			if len(l.queue.queue) == 0 {
-				continue
-			}
-			cmd := l.queue.pull()
-			cmd.Execute(l)
+// errIsDirectory rejects a -f path naming a directory, or a symlink to one.
+var errIsDirectory = errors.New("is a directory")
+
+// instructions is where instructions are read from without -f: stdin, or the
+// descriptor of -fd.
+var instructions = os.Stdin
+
+// openFD returns the descriptor of -fd, checking that it is open.
+func openFD(fd int) (*os.File, error) {
+	f := os.NewFile(uintptr(fd), fmt.Sprintf("fd %d", fd))
+	if f == nil {
+		return nil, fmt.Errorf("-fd %d is not a file descriptor", fd)
+	}
+	if _, err := f.Stat(); err != nil {
+		return nil, fmt.Errorf("-fd %d can't be read: %w", fd, err)
+	}
+	return f, nil
+}
+
+// openInput returns the instruction source: the file at path, or
+// instructions when path is empty.
+func openInput(path string) (io.ReadCloser, error) {
+	if path == "" {
+		return io.NopCloser(instructions), nil
+	}
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return nil, fmt.Errorf("error: %s %w", path, errIsDirectory)
+	}
+	return os.Open(path)
+}
+
+// openJournal opens the -journal file for appending, refusing the journal
+// being replayed.
+func openJournal(path string) (*os.File, error) {
+	if *replayPath != "" {
+		if same, err := sameFile(path, *replayPath); err == nil && same {
+			return nil, fmt.Errorf("-journal %s is the journal being replayed", path)
 		}
-		l.stopSignal <- struct{}{}
-	}()
+	}
+	return os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
 }
 
-func (l *EventLoop) Stop() {
-	l.isStopped = true
+func sameFile(a, b string) (bool, error) {
+	infoA, err := os.Stat(a)
+	if err != nil {
+		return false, err
+	}
+	infoB, err := os.Stat(b)
+	if err != nil {
+		return false, err
+	}
+	return os.SameFile(infoA, infoB), nil
 }
 
-func (l *EventLoop) Post(cmd Command) {
-	l.queue.push(cmd)
+func inputIsTerminal() bool {
+	return isTerminal(instructions)
 }
 
-func (l *EventLoop) AwaitFinish() {
-	l.Post(&stopCommand{})
-	<-l.stopSignal
+func isTerminal(f *os.File) bool {
+	stat, err := f.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
 }
 
-type Command interface {
-	Execute(handler Handler)
+// printStreams are the streams -print-to selects from.
+var printStreams = map[string]io.Writer{"stdout": os.Stdout, "stderr": os.Stderr}
+
+// stderr receives the diagnostics of the command; it colors them with -color.
+var stderr io.Writer = os.Stderr
+
+// useColor applies the -color mode to the output file f.
+func useColor(f *os.File) (bool, error) {
+	switch *color {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "auto":
+		return isTerminal(f), nil
+	}
+	return false, fmt.Errorf("unknown -color mode %q", *color)
 }
 
-type Handler interface {
-	Post(cmd Command)
-	Stop()
+// colorWriter writes every message red.
+type colorWriter struct {
+	w io.Writer
 }
 
-// MARK: - Commands
+func (c colorWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(c.w, eventloop.ColorError(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
 
-type stopCommand struct{}
+// readCommands parses every line of input, reporting syntax errors and read
+// errors on stderr. name identifies the input in error messages. With
+// stopEarly it gives up at the first syntax error. It returns the commands,
+// the lines they start on, false if any line was rejected, and false if input
+// couldn't be read to the end.
+func readCommands(name string, input io.Reader, stopEarly bool) ([]eventloop.Command, []int, bool, bool) {
+	var cmds []eventloop.Command
+	var lines []int
+	valid := true
+	parser := newParser()
+	scanner := newScanner(input)
+	lineNo := 1
+	for ; scanner.Scan(); lineNo++ {
+		// Files written on Windows end their lines in \r\n.
+		commandLine := strings.TrimSuffix(scanner.Text(), "\r")
+		lineCmds, cmdLines, err := parseLine(parser, commandLine)
+		if err != nil && stopEarly {
+			fmt.Fprintf(stderr, "%s: line %d: %q: %v\n", name, lineNo, commandLine, err)
+			return nil, nil, false, true
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: line %d: %v\n", name, lineNo, err)
+			valid = false
+		}
+		cmds = append(cmds, lineCmds...)
+		lines = append(lines, cmdLines...)
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintf(stderr, "%s: line %d: %v\n", name, lineNo, scanError(err))
+		return nil, nil, false, false
+	}
+	if err := parser.Close(); err != nil {
+		fmt.Fprintf(stderr, "%s: %v\n", name, err)
+		return cmds, lines, false, true
+	}
+	return cmds, lines, valid, true
+}
+
+// parseLine parses the instructions on a line, separated by -separator in the
+// text format. It returns the commands of those that parsed, in order, the
+// lines they start on and the first error.
+func parseLine(parser lineParser, line string) ([]eventloop.Command, []int, error) {
+	parts := []string{line}
+	if sep, _ := utf8.DecodeRuneInString(*separator); *separator != "" && *parserName == "text" {
+		parts = parser.SplitInstructions(line, sep)
+	}
+	var cmds []eventloop.Command
+	var lines []int
+	var firstErr error
+	for i, part := range parts {
+		parse := parser.Parse
+		if i > 0 {
+			parse = parser.Continue
+		}
+		cmd, err := parse(part)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		if cmd != nil {
+			cmds = append(cmds, cmd)
+			lines = append(lines, parser.Line())
+		}
+	}
+	return cmds, lines, firstErr
+}
 
-func (s *stopCommand) Execute(handler Handler) {
-	handler.Stop()
+// newScanner splits input into lines of up to -max-line bytes.
+func newScanner(input io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 0, min(64<<10, *maxLine)), *maxLine)
+	return scanner
 }
 
-type printCommand struct {
-	arg string
+func scanError(err error) error {
+	if err == bufio.ErrTooLong {
+		return fmt.Errorf("line longer than %d bytes (see -max-line)", *maxLine)
+	}
+	return err
 }
 
-func (p *printCommand) Execute(handler Handler) {
-	fmt.Println(p.arg)
+// postCommands parses input, read from path or stdin if path is empty, into a
+// program and posts it to the loop. It returns false without posting
+// anything if input couldn't be read to the end, or was rejected by a syntax
+// error in strict mode. In dry-run mode nothing is posted, every error is
+// reported, and the result is false if there were any.
+func postCommands(path string, input io.Reader, loop *eventloop.EventLoop) bool {
+	name := inputName(path)
+	// A replayed journal may end in a torn line if its run crashed, so the
+	// lines that don't parse are skipped even in strict mode.
+	strictInput := *strict && *replayPath == ""
+	cmds, lines, valid, complete := readCommands(name, input, strictInput && !*dryRun)
+	if !complete || (!valid && strictInput && !*dryRun) {
+		return false
+	}
+
+	prog, err := eventloop.NewProgram(cmds)
+	if err != nil {
+		fmt.Fprintf(stderr, "%s: %v\n", name, err)
+		return !*strict && !*dryRun
+	}
+	if *dryRun {
+		return valid
+	}
+	prog.MaxJumps = *maxJumps
+	prog.Path = path
+	prog.Lines = lines
+	prog.PostTo(loop)
+	return true
 }
 
-type addCommand struct {
-	arg1, arg2 int
+// inputPaths splits the -f flag into the files to run in order, or returns
+// the -replay journal. An empty flag yields a single empty path, which
+// selects stdin.
+func inputPaths() []string {
+	if *replayPath != "" {
+		return []string{*replayPath}
+	}
+	if *inputPath == "" {
+		return []string{""}
+	}
+	return strings.Split(*inputPath, ",")
 }
 
-func (add *addCommand) Execute(handler Handler) {
-	res := add.arg1 + add.arg2
-	handler.Post(&printCommand{arg: strconv.Itoa(res)})
+func inputName(path string) string {
+	if path != "" {
+		return path
+	}
+	if instructions != os.Stdin {
+		return instructions.Name()
+	}
+	return "stdin"
 }
 
-func parse(line string) Command {
-	parts := strings.Fields(line)
-	command, args := parts[0], parts[1:]
+const prompt = "> "
 
-	switch command {
-	case "print":
-		if len(args) != 1 {
-			return &printCommand{arg: AmbiguousArgsNumberError}
+// blockPrompt asks for the next line of a block such as def ... enddef.
+const blockPrompt = "... "
+
+// repl executes commands as they are typed, waiting for each one to finish
+// before prompting again. It returns on "quit", "exit", the end of input or
+// once a command such as "exit 1" has stopped the loop.
+func repl(input io.Reader, output io.Writer, loop *eventloop.EventLoop) {
+	parser := newParser()
+	scanner := newScanner(input)
+	nextPrompt := func() string {
+		if parser.Pending() {
+			return blockPrompt
 		}
-		return &printCommand{arg: args[0]}
-	case "add":
-		if len(args) != 2 {
-			return &printCommand{arg: AmbiguousArgsNumberError}
+		return prompt
+	}
+	for fmt.Fprint(output, prompt); scanner.Scan(); fmt.Fprint(output, nextPrompt()) {
+		line := strings.TrimSpace(scanner.Text())
+		switch line {
+		case "":
+			continue
+		case "quit", "exit":
+			return
 		}
-		arg1, err := strconv.Atoi(args[0])
+		cmds, _, err := parseLine(parser, line)
 		if err != nil {
-			return &printCommand{arg: fmt.Sprintf(NotNumberError, args[0])}
+			fmt.Fprintln(stderr, err)
 		}
-		arg2, _ := strconv.Atoi(args[1])
-		if err != nil {
-			return &printCommand{arg: fmt.Sprintf(NotNumberError, args[1])}
+		if len(cmds) == 0 {
+			continue
+		}
+		for _, cmd := range cmds {
+			loop.Post(cmd)
 		}
-		return &addCommand{arg1, arg2}
+		loop.Wait()
+		if loop.Stopped() {
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintln(stderr, scanError(err))
+	}
+	if err := parser.Close(); err != nil {
+		fmt.Fprintln(stderr, err)
 	}
+	fmt.Fprintln(output)
+}
 
-	return &printCommand{arg: fmt.Sprintf(UnknownCommandError, command)}
+// handleSignals calls interrupt on the first signal and exits at once on the
+// second. It returns when done is closed.
+func handleSignals(signals <-chan os.Signal, interrupt func(), done <-chan struct{}) {
+	interrupted := false
+	for {
+		select {
+		case <-signals:
+			if interrupted {
+				exit(130)
+				return
+			}
+			interrupted = true
+			interrupt()
+		case <-done:
+			return
+		}
+	}
 }
 
-var inputPath = flag.String("f", "", "Path to file with instructions")
+// triggerOnSignal releases the loop held by -hold on the first signal. It
+// returns when done is closed.
+func triggerOnSignal(signals <-chan os.Signal, loop *eventloop.EventLoop, done <-chan struct{}) {
+	select {
+	case <-signals:
+		loop.Trigger()
+	case <-done:
+	}
+}
 
 func main() {
 	flag.Parse()
-	input, err := os.Open(*inputPath)
+	colorErrors, err := useColor(os.Stderr)
 	if err != nil {
-		fmt.Println(err)
+		fmt.Fprintln(stderr, err)
+		exit(2)
 		return
 	}
-
-	eventLoop := NewEventLoop()
+	if colorErrors {
+		stderr = colorWriter{os.Stderr}
+	}
+	if *format != "" {
+		*parserName = *format
+	}
+	if _, known := eventloop.NewParser(*parserName); !known {
+		fmt.Fprintf(stderr, "unknown parser %q, expected one of %s\n", *parserName, strings.Join(eventloop.ParserNames(), ", "))
+		exit(2)
+		return
+	}
+	printOutput, known := printStreams[*printTo]
+	if !known {
+		fmt.Fprintf(stderr, "unknown -print-to stream %q\n", *printTo)
+		exit(2)
+		return
+	}
+	for _, alias := range aliases {
+		name, target, _ := strings.Cut(alias, "=")
+		if err := eventloop.Alias(name, target); err != nil {
+			fmt.Fprintf(stderr, "-alias %s: %v\n", alias, err)
+			exit(2)
+			return
+		}
+	}
+	if utf8.RuneCountInString(*separator) > 1 {
+		fmt.Fprintf(stderr, "-separator %q must be a single character\n", *separator)
+		exit(2)
+		return
+	}
+	if *replayPath != "" && (*inputPath != "" || *watch || *serveAddr != "") {
+		fmt.Fprintln(stderr, "-replay can't be combined with -f, -watch or -serve")
+		exit(2)
+		return
+	}
+	if *inputFD >= 0 {
+		if *inputPath != "" || *replayPath != "" || *serveAddr != "" {
+			fmt.Fprintln(stderr, "-fd can't be combined with -f, -replay or -serve")
+			exit(2)
+			return
+		}
+		if instructions, err = openFD(*inputFD); err != nil {
+			fmt.Fprintln(stderr, err)
+			exit(2)
+			return
+		}
+	}
+	if *watch && *inputPath == "" {
+		fmt.Fprintln(stderr, "-watch needs the files to watch in -f")
+		exit(2)
+		return
+	}
+	opts := []eventloop.Option{
+		eventloop.WithOutput(printOutput),
+		eventloop.WithFailFast(*strict),
+		eventloop.WithFloatPrecision(*precision),
+		eventloop.WithDedupe(*dedupe),
+		eventloop.WithMaxDepth(*maxDepth),
+		eventloop.WithFileRoot(*fileRoot),
+		eventloop.WithRate(*rate),
+		eventloop.WithMaxIterations(*maxIterations),
+		eventloop.WithMaxCommands(*maxCommands),
+		eventloop.WithBufferedOutput(true),
+		eventloop.WithColor(colorErrors),
+		eventloop.WithIdleTimeout(*idleTimeout),
+		eventloop.WithTrace(*traceRun),
+		eventloop.WithHold(*hold),
+		eventloop.WithDefines(defines),
+	}
+	if *verbose {
+		opts = append(opts, eventloop.WithTimings(os.Stderr))
+	}
+	if *echo {
+		opts = append(opts, eventloop.WithEcho(os.Stderr))
+	}
+	if *allowExec {
+		opts = append(opts, eventloop.WithExec(*execTimeout))
+	}
+	if *seed != 0 {
+		opts = append(opts, eventloop.WithRand(rand.New(rand.NewSource(*seed))))
+	}
+	switch {
+	case *inputFile != "":
+		input, err := os.Open(*inputFile)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			exit(1)
+			return
+		}
+		defer input.Close()
+		opts = append(opts, eventloop.WithInput(input))
+	case *inputPath != "" || *replayPath != "" || *serveAddr != "" || instructions != os.Stdin:
+		opts = append(opts, eventloop.WithInput(os.Stdin))
+	}
+	if *journalPath != "" {
+		journal, err := openJournal(*journalPath)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			exit(1)
+			return
+		}
+		defer journal.Close()
+		opts = append(opts, eventloop.WithJournal(journal))
+	}
+	if *replayPath != "" {
+		opts = append(opts, eventloop.WithReplay(true))
+	}
+	eventLoop := eventloop.NewEventLoop(opts...)
 	eventLoop.Start()
 
-	scanner := bufio.NewScanner(input)
-	for scanner.Scan() {
-		commandLine := scanner.Text()
-		cmd := parse(commandLine)
-		eventLoop.Post(cmd)
+	// The first signal drains the loop, or in server mode stops accepting
+	// commands, after which the loop is drained as well. In watch mode it
+	// also ends the watch. A server also stops accepting commands once the
+	// loop has stopped on its own, as with -idle-timeout.
+	interrupt := eventLoop.StopAndDrain
+	var srv *server
+	if *serveAddr != "" {
+		srv = newServer(*serveAddr, eventLoop)
+		interrupt = srv.shutdown
+		go func() {
+			<-eventLoop.Done()
+			srv.shutdown()
+		}()
+	}
+	stopWatching := make(chan struct{})
+	if *watch {
+		interrupt = func() {
+			close(stopWatching)
+			eventLoop.StopAndDrain()
+		}
+	}
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	go handleSignals(signals, interrupt, done)
+	defer func() {
+		signal.Stop(signals)
+		close(done)
+	}()
+	if *hold && len(triggerSignals) > 0 {
+		triggers := make(chan os.Signal, 1)
+		signal.Notify(triggers, triggerSignals...)
+		go triggerOnSignal(triggers, eventLoop, done)
+		defer signal.Stop(triggers)
+	}
+
+	if srv != nil {
+		err := srv.run()
+		eventLoop.AwaitFinish()
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			exit(1)
+		}
+		if !exportRun(eventLoop) {
+			exit(1)
+		}
+		exitWith(eventLoop.ExitCode())
+		return
+	}
+
+	if !*dryRun && (*interactive || (*inputPath == "" && *replayPath == "" && inputIsTerminal())) {
+		repl(instructions, os.Stdout, eventLoop)
+		eventLoop.AwaitFinish()
+		if !exportRun(eventLoop) {
+			exit(1)
+		}
+		exitWith(eventLoop.ExitCode())
+		return
 	}
-	input.Close()
+
+	ok := runInputs(eventLoop)
 	eventLoop.AwaitFinish()
+	if *watch {
+		watchFiles(inputPaths(), watchInterval, stopWatching, func() {
+			if !*keepState {
+				eventLoop.Vars().Clear()
+			}
+			eventLoop.Start()
+			ok = runInputs(eventLoop)
+			eventLoop.AwaitFinish()
+		})
+	}
+	if !exportRun(eventLoop) || !ok {
+		exit(1)
+	}
+	exitWith(eventLoop.ExitCode())
+}
+
+// runInputs posts the files named by -f, or stdin, to the loop. It returns
+// false if an input was rejected because of -strict or -dry-run.
+func runInputs(loop *eventloop.EventLoop) bool {
+	ok := true
+	for _, path := range inputPaths() {
+		if loop.Stopped() {
+			break
+		}
+		input, err := openInput(path)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			if *strict || *dryRun || errors.Is(err, errIsDirectory) {
+				ok = false
+			}
+			if !ok && !*dryRun {
+				break
+			}
+			continue
+		}
+		if !postCommands(path, input, loop) {
+			ok = false
+		}
+		input.Close()
+		if !ok && !*dryRun {
+			break
+		}
+	}
+	return ok
 }
@@ -0,0 +1,648 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/Beaxhem/architecture-lab-4/eventloop"
+)
+
+// runMainEnv makes the test binary run main instead of the tests, so that
+// tests can run the command as a process of its own.
+const runMainEnv = "EVENTLOOP_RUN_MAIN"
+
+func TestMain(m *testing.M) {
+	eventloop.RegisterParser("upper", func() eventloop.Parser { return upperParser{} })
+	if os.Getenv(runMainEnv) != "" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// upperParser reads instructions written in capitals, for the tests of
+// -parser with a parser of a program's own.
+type upperParser struct{}
+
+func (upperParser) Parse(line string) (eventloop.Command, error) {
+	return eventloop.Parse(strings.ToLower(line))
+}
+
+// runMain runs the command with args, feeding it stdin, and returns what it
+// wrote to stdout and stderr and its exit status.
+func runMain(t *testing.T, stdin string, args ...string) (string, string, int) {
+	t.Helper()
+
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), runMainEnv+"=1")
+	cmd.Stdin = strings.NewReader(stdin)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		t.Fatal(err)
+	}
+	return stdout.String(), stderr.String(), cmd.ProcessState.ExitCode()
+}
+
+func TestStrictStopsAtSyntaxError(t *testing.T) {
+	input := "print a\nfrob\nprint b\n"
+
+	stdout, stderr, code := runMain(t, input, "-strict")
+	if code == 0 {
+		t.Errorf("exit status = 0 with -strict, want non-zero")
+	}
+	if stdout != "" {
+		t.Errorf("stdout = %q with -strict, want nothing executed", stdout)
+	}
+	if !strings.Contains(stderr, "line 2") || !strings.Contains(stderr, "unknown command 'frob'") {
+		t.Errorf("stderr = %q, want the error on line 2", stderr)
+	}
+
+	stdout, _, code = runMain(t, input)
+	if code != 0 || stdout != "a\nb\n" {
+		t.Errorf("without -strict got %q, status %d, want the valid lines run and status 0", stdout, code)
+	}
+}
+
+func TestExitWith(t *testing.T) {
+	var codes []int
+	defer func(old func(int)) { exit = old }(exit)
+	exit = func(code int) { codes = append(codes, code) }
+
+	exitWith(0)
+	exitWith(3)
+	if len(codes) != 1 || codes[0] != 3 {
+		t.Errorf("exit called with %v, want [3]", codes)
+	}
+}
+
+// postInput posts the instructions read from input to a new loop, runs them
+// and returns what they printed.
+func postInput(t *testing.T, path, input string) string {
+	t.Helper()
+
+	var out bytes.Buffer
+	loop := eventloop.NewEventLoop(eventloop.WithOutput(&out))
+	loop.Start()
+	if !postCommands(path, strings.NewReader(input), loop) {
+		t.Errorf("postCommands rejected %q", input)
+	}
+	loop.AwaitFinish()
+	return out.String()
+}
+
+func TestPostCommandsFromReader(t *testing.T) {
+	// add prints its sum with a command it posts, behind print b.
+	if got, want := postInput(t, "", "print a\nadd 1 2\nprint b\n"), "a\nb\n3\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
+
+// writeFile writes data to name in dir and returns its path.
+func writeFile(t *testing.T, dir, name, data string) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestMultipleInputFiles(t *testing.T) {
+	dir := t.TempDir()
+	first := writeFile(t, dir, "first.txt", "print a\nprint b\n")
+	second := writeFile(t, dir, "second.txt", "print c\n")
+
+	stdout, stderr, code := runMain(t, "", "-f", first+","+second)
+	if code != 0 || stderr != "" {
+		t.Fatalf("status %d, stderr %q", code, stderr)
+	}
+	if want := "a\nb\nc\n"; stdout != want {
+		t.Errorf("stdout = %q, want %q", stdout, want)
+	}
+}
+
+func TestREPL(t *testing.T) {
+	var out, prompts bytes.Buffer
+	loop := eventloop.NewEventLoop(eventloop.WithOutput(&out))
+	loop.Start()
+	repl(strings.NewReader("print hi\nadd 1 2\nquit\nprint never\n"), &prompts, loop)
+	loop.AwaitFinish()
+
+	if got, want := out.String(), "hi\n3\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+	if got, want := prompts.String(), strings.Repeat(prompt, 3); got != want {
+		t.Errorf("prompts = %q, want %q", got, want)
+	}
+}
+
+func TestCommentsAndBlankLines(t *testing.T) {
+	input := "# a comment\n\nprint a\n   \n  # an indented comment\nprint b # a trailing comment\n\n"
+	if got, want := postInput(t, "", input), "a\nb\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
+
+func TestHandleSignals(t *testing.T) {
+	var exited []int
+	defer func(old func(int)) { exit = old }(exit)
+	exit = func(code int) { exited = append(exited, code) }
+
+	signals := make(chan os.Signal)
+	interrupted := make(chan struct{}, 2)
+	done := make(chan struct{})
+	returned := make(chan struct{})
+	go func() {
+		handleSignals(signals, func() { interrupted <- struct{}{} }, done)
+		close(returned)
+	}()
+
+	signals <- os.Interrupt
+	<-interrupted
+	signals <- os.Interrupt
+	<-returned
+	close(done)
+
+	if len(interrupted) != 0 {
+		t.Error("the second signal interrupted again instead of exiting")
+	}
+	if len(exited) != 1 || exited[0] != 130 {
+		t.Errorf("exit called with %v, want [130]", exited)
+	}
+}
+
+func TestHandleSignalsDone(t *testing.T) {
+	done := make(chan struct{})
+	returned := make(chan struct{})
+	go func() {
+		handleSignals(make(chan os.Signal), func() { t.Error("interrupted without a signal") }, done)
+		close(returned)
+	}()
+	close(done)
+	<-returned
+}
+
+func TestExitCodePropagated(t *testing.T) {
+	stdout, _, code := runMain(t, "print a\nexit 3\nprint b\n")
+	if code != 3 {
+		t.Errorf("exit status = %d, want 3", code)
+	}
+	if stdout != "a\n" {
+		t.Errorf("stdout = %q, want %q", stdout, "a\n")
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	path := writeFile(t, t.TempDir(), "bad.txt", "print a\nfrob\nprint b\n")
+
+	stdout, stderr, code := runMain(t, "", "-dry-run", "-f", path)
+	if stdout != "" {
+		t.Errorf("stdout = %q, want nothing executed", stdout)
+	}
+	if want := path + ": line 2: SYNTAX ERROR: unknown command 'frob'\n"; stderr != want {
+		t.Errorf("stderr = %q, want %q", stderr, want)
+	}
+	if code == 0 {
+		t.Error("exit status = 0 for a file with a syntax error")
+	}
+}
+
+func TestWatchRunsAgainOnChange(t *testing.T) {
+	path := writeFile(t, t.TempDir(), "watched.txt", "print first\n")
+	run := func() string {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Error(err)
+		}
+		return postInput(t, path, string(data))
+	}
+	if got := run(); got != "first\n" {
+		t.Fatalf("first run printed %q", got)
+	}
+
+	stop := make(chan struct{})
+	reruns := make(chan string, 1)
+	go watchFiles([]string{path}, 10*time.Millisecond, stop, func() {
+		reruns <- run()
+	})
+	defer close(stop)
+
+	time.Sleep(30 * time.Millisecond)
+	writeFile(t, filepath.Dir(path), "watched.txt", "print second run\n")
+	select {
+	case got := <-reruns:
+		if got != "second run\n" {
+			t.Errorf("second run printed %q, want the rewritten file's output", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no second run after the file changed")
+	}
+}
+
+func TestAllowExecFlag(t *testing.T) {
+	if _, err := exec.LookPath("echo"); err != nil {
+		t.Skip("no echo program:", err)
+	}
+
+	stdout, stderr, _ := runMain(t, "exec echo hi\n")
+	if stdout != "" || !strings.Contains(stderr, "running programs is not allowed") {
+		t.Errorf("without -allow-exec got stdout %q, stderr %q, want exec refused", stdout, stderr)
+	}
+	stdout, stderr, code := runMain(t, "exec echo hi\n", "-allow-exec")
+	if code != 0 || stdout != "hi\n" || stderr != "" {
+		t.Errorf("with -allow-exec got %q, stderr %q, status %d, want hi printed", stdout, stderr, code)
+	}
+}
+
+func TestAliasFlag(t *testing.T) {
+	stdout, stderr, code := runMain(t, "p hi\n+ 1 2\n", "-alias", "p=print", "-alias", "+=add")
+	if code != 0 || stdout != "hi\n3\n" || stderr != "" {
+		t.Errorf("got %q, stderr %q, status %d, want the aliases resolved", stdout, stderr, code)
+	}
+	if _, stderr, code := runMain(t, "", "-alias", "a=frob"); code != 2 || !strings.Contains(stderr, "-alias a=frob") {
+		t.Errorf("an alias of an unknown command exited with %d, stderr %q, want status 2", code, stderr)
+	}
+}
+
+func TestLongLines(t *testing.T) {
+	long := strings.Repeat("x", 100<<10)
+	input := "print " + long + "\nprint after\n"
+
+	stdout, stderr, code := runMain(t, input)
+	if code != 0 || stderr != "" || stdout != long+"\nafter\n" {
+		t.Errorf("got %d bytes, stderr %q, status %d, want the long line printed intact", len(stdout), stderr, code)
+	}
+
+	_, stderr, code = runMain(t, input, "-max-line", "1000")
+	if code == 0 || !strings.Contains(stderr, "line 1: line longer than 1000 bytes") {
+		t.Errorf("with -max-line 1000 got stderr %q, status %d, want the line rejected", stderr, code)
+	}
+}
+
+func TestReadErrorReported(t *testing.T) {
+	var errs bytes.Buffer
+	defer func(old io.Writer) { stderr = old }(stderr)
+	stderr = &errs
+
+	var out bytes.Buffer
+	loop := eventloop.NewEventLoop(eventloop.WithOutput(&out))
+	loop.Start()
+	input := io.MultiReader(strings.NewReader("print a\nprint b\n"), iotest.ErrReader(errors.New("disk on fire")))
+	if postCommands("", input, loop) {
+		t.Error("postCommands succeeded on input that couldn't be read to the end")
+	}
+	loop.AwaitFinish()
+	if out.String() != "" {
+		t.Errorf("output = %q, want nothing posted from truncated input", out.String())
+	}
+	if want := "stdin: line 3: disk on fire\n"; errs.String() != want {
+		t.Errorf("stderr = %q, want %q", errs.String(), want)
+	}
+}
+
+func TestInputIsDirectory(t *testing.T) {
+	dir := t.TempDir()
+	link := filepath.Join(t.TempDir(), "link")
+	if err := os.Symlink(dir, link); err != nil {
+		t.Skip("no symbolic links:", err)
+	}
+
+	for _, path := range []string{dir, link} {
+		stdout, stderr, code := runMain(t, "", "-f", path)
+		if want := "error: " + path + " is a directory\n"; code == 0 || stdout != "" || stderr != want {
+			t.Errorf("-f %s got %q, stderr %q, status %d, want stderr %q and a non-zero status", path, stdout, stderr, code, want)
+		}
+	}
+}
+
+func TestColorFlag(t *testing.T) {
+	input := "print hi\nfrob\ndiv 1 0\n"
+	plainErrs := "stdin: line 2: SYNTAX ERROR: unknown command 'frob'\nline 3: error: division by zero\n"
+
+	// Auto is never when, as here, the output isn't a terminal.
+	for _, args := range [][]string{{"-color", "never"}, {"-color", "auto"}, nil} {
+		stdout, stderr, _ := runMain(t, input, args...)
+		if stdout != "hi\n" || stderr != plainErrs {
+			t.Errorf("%v: got %q, stderr %q, want no escape codes", args, stdout, stderr)
+		}
+	}
+
+	stdout, stderr, _ := runMain(t, input, "-color", "always")
+	if want := eventloop.ColorError("stdin: line 2: SYNTAX ERROR: unknown command 'frob'\n") +
+		eventloop.ColorError("line 3: error: division by zero\n"); stdout != "hi\n" || stderr != want {
+		t.Errorf("-color always: got %q, stderr %q, want the errors in red", stdout, stderr)
+	}
+}
+
+func TestJournalReplay(t *testing.T) {
+	journal := filepath.Join(t.TempDir(), "journal.log")
+	input := "set x 2\nprint a\nadd x 3\nrepeat 2 mul x 4\n"
+
+	want, stderr, code := runMain(t, input, "-journal", journal)
+	if code != 0 || stderr != "" {
+		t.Fatalf("journaled run: status %d, stderr %q", code, stderr)
+	}
+	got, stderr, code := runMain(t, "", "-replay", journal)
+	if code != 0 || stderr != "" || got != want {
+		t.Errorf("replay printed %q, stderr %q, status %d, want %q", got, stderr, code, want)
+	}
+
+	// A run that crashed may have left a torn line at the end.
+	f, err := os.OpenFile(journal, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("ad")
+	f.Close()
+	got, stderr, code = runMain(t, "", "-replay", journal)
+	if code != 0 || got != want || !strings.Contains(stderr, "unknown command 'ad'") {
+		t.Errorf("replay of a torn journal printed %q, stderr %q, status %d, want %q", got, stderr, code, want)
+	}
+}
+
+func TestMultiCommandLines(t *testing.T) {
+	stdout, stderr, code := runMain(t, "set x 1; add x 2; print done\nprint a;\nprint \"a;b\"; print c\n")
+	if want := "done\na\na;b\nc\n3\n"; code != 0 || stderr != "" || stdout != want {
+		t.Errorf("got %q, stderr %q, status %d, want %q", stdout, stderr, code, want)
+	}
+	stdout, _, _ = runMain(t, "print a; print b\n", "-separator", "")
+	if want := "a; print b\n"; stdout != want {
+		t.Errorf("with no separator got %q, want %q", stdout, want)
+	}
+}
+
+func TestReadFromStdin(t *testing.T) {
+	path := writeFile(t, t.TempDir(), "read.txt", "read a\nread b\nprint $a-$b\n")
+
+	// The instructions come from the file, so read consumes stdin.
+	stdout, stderr, code := runMain(t, "one\ntwo\n", "-f", path)
+	if code != 0 || stderr != "" || stdout != "one-two\n" {
+		t.Errorf("got %q, stderr %q, status %d, want the lines of stdin read", stdout, stderr, code)
+	}
+}
+
+func TestPrintTo(t *testing.T) {
+	input := "print hi\ndiv 1 0\n"
+	errLine := "line 2: error: division by zero\n"
+
+	for _, args := range [][]string{nil, {"-print-to", "stdout"}} {
+		stdout, stderr, _ := runMain(t, input, args...)
+		if stdout != "hi\n" || stderr != errLine {
+			t.Errorf("%v: got stdout %q, stderr %q, want the print on stdout", args, stdout, stderr)
+		}
+	}
+	stdout, stderr, _ := runMain(t, input, "-print-to", "stderr")
+	if stdout != "" || stderr != "hi\n"+errLine {
+		t.Errorf("-print-to stderr: got stdout %q, stderr %q, want the print on stderr", stdout, stderr)
+	}
+	if _, stderr, code := runMain(t, input, "-print-to", "printer"); code != 2 || !strings.Contains(stderr, `unknown -print-to stream "printer"`) {
+		t.Errorf("-print-to printer: status %d, stderr %q, want the stream rejected", code, stderr)
+	}
+}
+
+func TestEchoFlag(t *testing.T) {
+	stdout, stderr, _ := runMain(t, "print a\nadd 1 2\n# comment\nprint b\n", "-echo")
+	if want := "a\nb\n3\n"; stdout != want {
+		t.Errorf("stdout = %q, want %q", stdout, want)
+	}
+	if want := "1: print a\n2: add 1 2\n4: print b\n"; stderr != want {
+		t.Errorf("stderr = %q, want %q", stderr, want)
+	}
+}
+
+func TestTraceFlag(t *testing.T) {
+	stdout, stderr, _ := runMain(t, "print a\nset x 1\ntrace\n", "-trace")
+	if want := "a\n1: print a\n2: set x 1\n"; stdout != want {
+		t.Errorf("stdout = %q, want %q", stdout, want)
+	}
+	if stderr != "" {
+		t.Errorf("stderr = %q, want none", stderr)
+	}
+}
+
+func TestReadFromFD(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if _, err := io.WriteString(w, "print a\nadd 1 2\n"); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	// The read end is the child's first descriptor after stderr.
+	cmd := exec.Command(os.Args[0], "-fd", "3")
+	cmd.Env = append(os.Environ(), runMainEnv+"=1")
+	cmd.Stdin = strings.NewReader("print stdin\n")
+	cmd.ExtraFiles = []*os.File{r}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("run with -fd 3: %v, stderr %q", err, stderr.String())
+	}
+	if want := "a\n3\n"; stdout.String() != want {
+		t.Errorf("stdout = %q, want %q", stdout.String(), want)
+	}
+}
+
+func TestFDErrors(t *testing.T) {
+	_, stderr, code := runMain(t, "", "-fd", "99")
+	if code != 2 || !strings.Contains(stderr, "-fd 99 can't be read") {
+		t.Errorf("-fd 99 exited %d with %q, want status 2 and an error", code, stderr)
+	}
+	_, stderr, code = runMain(t, "", "-fd", "3", "-f", "x")
+	if code != 2 || !strings.Contains(stderr, "-fd can't be combined") {
+		t.Errorf("-fd with -f exited %d with %q, want status 2 and an error", code, stderr)
+	}
+}
+
+func TestCustomParserFlag(t *testing.T) {
+	stdout, stderr, code := runMain(t, "PRINT A\nADD 1 2\n", "-parser", "upper")
+	if code != 0 || stdout != "a\n3\n" || stderr != "" {
+		t.Errorf("-parser upper got %q, %q, status %d, want the instructions run", stdout, stderr, code)
+	}
+	_, stderr, code = runMain(t, "", "-parser", "nope")
+	if code != 2 || !strings.Contains(stderr, `unknown parser "nope"`) || !strings.Contains(stderr, "upper") {
+		t.Errorf("-parser nope got %q, status %d, want status 2 and the known parsers", stderr, code)
+	}
+}
+
+func TestTriggerOnSignal(t *testing.T) {
+	var out bytes.Buffer
+	loop := eventloop.NewEventLoop(eventloop.WithOutput(&out), eventloop.WithHold(true))
+	loop.Start()
+	cmd, err := eventloop.Parse("print staged")
+	if err != nil {
+		t.Fatal(err)
+	}
+	loop.Post(cmd)
+
+	signals := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	returned := make(chan struct{})
+	go func() {
+		triggerOnSignal(signals, loop, done)
+		close(returned)
+	}()
+	signals <- os.Interrupt
+	<-returned
+	loop.AwaitFinish()
+	if got := out.String(); got != "staged\n" {
+		t.Errorf("output = %q, want the staged command run after the signal", got)
+	}
+
+	// Without a signal, it returns once done is closed.
+	close(done)
+	triggerOnSignal(make(chan os.Signal), loop, done)
+}
+
+// readExport decodes the file written by -export at path.
+func readExport(t *testing.T, path string) (vars map[string]any, executed map[string]int, code int) {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var e struct {
+		Vars  map[string]any `json:"vars"`
+		Stats struct {
+			Commands map[string]struct {
+				Executed int `json:"executed"`
+			} `json:"commands"`
+		} `json:"stats"`
+		ExitCode int `json:"exitCode"`
+	}
+	if err := json.Unmarshal(data, &e); err != nil {
+		t.Fatalf("exported %q: %v", data, err)
+	}
+	executed = make(map[string]int)
+	for name, c := range e.Stats.Commands {
+		executed[name] = c.Executed
+	}
+	return e.Vars, executed, e.ExitCode
+}
+
+func TestExportFlag(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		code     int
+		vars     map[string]any
+		executed map[string]int
+	}{
+		{"finished", "set x 5\nset s hi\nadd 1 2\n", 0,
+			map[string]any{"x": 5.0, "s": "hi"}, map[string]int{"set": 2, "add": 1, "print": 1}},
+		// Stopped early, the run is exported all the same.
+		{"exit", "set x 5\nexit 3\nprint never\n", 3,
+			map[string]any{"x": 5.0}, map[string]int{"set": 1, "exit": 1}},
+		{"stopif", "set x 5\nstopif x gt 1\nprint never\n", 0,
+			map[string]any{"x": 5.0}, map[string]int{"set": 1, "stopif": 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "export.json")
+			_, stderr, code := runMain(t, tt.input, "-export", path)
+			if code != tt.code || stderr != "" {
+				t.Fatalf("exit status %d, stderr %q, want status %d", code, stderr, tt.code)
+			}
+			vars, executed, exitCode := readExport(t, path)
+			if !maps.Equal(vars, tt.vars) {
+				t.Errorf("exported variables %v, want %v", vars, tt.vars)
+			}
+			if !maps.Equal(executed, tt.executed) {
+				t.Errorf("exported counts %v, want %v", executed, tt.executed)
+			}
+			if exitCode != tt.code {
+				t.Errorf("exported exit code %d, want %d", exitCode, tt.code)
+			}
+		})
+	}
+}
+
+func TestExportUnwritable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing", "export.json")
+	_, stderr, code := runMain(t, "print a\n", "-export", path)
+	if code != 1 || !strings.HasPrefix(stderr, "-export: ") {
+		t.Errorf("exit status %d, stderr %q, want status 1 and the error", code, stderr)
+	}
+}
+
+func TestDefineFlag(t *testing.T) {
+	input := "whendef debug print debugging\nwhendef level print leveled\nprint end\n"
+
+	stdout, stderr, code := runMain(t, input, "-D", "debug", "-D", "level=3")
+	if code != 0 || stdout != "debugging\nleveled\nend\n" || stderr != "" {
+		t.Errorf("with both defines got %q, %q, status %d", stdout, stderr, code)
+	}
+	stdout, _, _ = runMain(t, input)
+	if stdout != "end\n" {
+		t.Errorf("without defines stdout = %q, want the whendefs skipped", stdout)
+	}
+	_, stderr, code = runMain(t, input, "-D", "=3")
+	if code != 2 || !strings.Contains(stderr, `expected name=value, got "=3"`) {
+		t.Errorf("-D =3 got %q, status %d, want status 2 and the error", stderr, code)
+	}
+}
+
+func TestErrorLineNumber(t *testing.T) {
+	_, stderr, _ := runMain(t, "print a\nprint b\ndiv 1 0\n")
+	if want := "line 3: error: division by zero\n"; stderr != want {
+		t.Errorf("stderr = %q, want %q", stderr, want)
+	}
+}
+
+func TestCRLFLines(t *testing.T) {
+	input := "print \"a b\"\r\nprint c # comment\r\nset s \"x y\"\r\nprint <$s>\r\n\r\n# only a comment\r\nadd 1 2\r\n"
+	want := "a b\nc\n<x y>\n3\n"
+
+	stdout, stderr, _ := runMain(t, input)
+	if stdout != want || stderr != "" {
+		t.Errorf("from stdin got %q, %q, want %q and no errors", stdout, stderr, want)
+	}
+	path := writeFile(t, t.TempDir(), "crlf.txt", input)
+	stdout, stderr, _ = runMain(t, "", "-f", path)
+	if stdout != want || stderr != "" {
+		t.Errorf("from -f got %q, %q, want %q and no errors", stdout, stderr, want)
+	}
+}
+
+func TestRequireExitStatus(t *testing.T) {
+	stdout, _, code := runMain(t, "set n 1\nrequire n:int\nprint ok\n")
+	if code != 0 || stdout != "ok\n" {
+		t.Errorf("passing require got %q, status %d, want ok and status 0", stdout, code)
+	}
+	_, stderr, code := runMain(t, "set n 1\nrequire n:string\nprint ok\n")
+	if code != 1 || !strings.Contains(stderr, "requirement failed: n:string is int (1)") {
+		t.Errorf("failing require got %q, status %d, want status 1 and the error", stderr, code)
+	}
+}
+
+func TestParallelLine(t *testing.T) {
+	for _, input := range []string{
+		"parallel print \";\" ; print \";\"\n",
+		"alias par parallel\npar print \";\" ; print \";\"\n",
+	} {
+		stdout, stderr, code := runMain(t, input)
+		if code != 0 || stdout != ";\n;\n" || stderr != "" {
+			t.Errorf("input %q got %q, %q, status %d, want both quoted separators printed", input, stdout, stderr, code)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/Beaxhem/architecture-lab-4/eventloop"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	executedDesc = prometheus.NewDesc("eventloop_commands_executed_total",
+		"Commands executed, by command.", []string{"command"}, nil)
+	peakDepthDesc = prometheus.NewDesc("eventloop_queue_peak_depth",
+		"Largest number of commands queued at once.", nil, nil)
+	durationDesc = prometheus.NewDesc("eventloop_command_duration_seconds",
+		"Time spent executing commands, by command.", []string{"command"}, nil)
+)
+
+// statsCollector exposes the stats of a loop, taken anew on every scrape: a
+// counter of executions and a latency histogram, labeled by command, and the
+// peak depth of the queue.
+type statsCollector struct {
+	loop *eventloop.EventLoop
+}
+
+func (c statsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- executedDesc
+	ch <- peakDepthDesc
+	ch <- durationDesc
+}
+
+func (c statsCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.loop.Stats()
+	ch <- prometheus.MustNewConstMetric(peakDepthDesc, prometheus.GaugeValue, float64(stats.PeakDepth))
+	for name, cs := range stats.Commands {
+		ch <- prometheus.MustNewConstMetric(executedDesc, prometheus.CounterValue, float64(cs.Executed), name)
+
+		buckets := make(map[float64]uint64, len(eventloop.LatencyBuckets))
+		var count uint64
+		for i, bound := range eventloop.LatencyBuckets {
+			count += uint64(cs.Latency[i])
+			buckets[bound.Seconds()] = count
+		}
+		ch <- prometheus.MustNewConstHistogram(durationDesc, uint64(cs.Executed), cs.Duration.Seconds(), buckets, name)
+	}
+}
+
+// metricsHandler serves the stats of loop in the Prometheus exposition
+// format, from a registry of its own rather than the global one.
+func metricsHandler(loop *eventloop.EventLoop) http.Handler {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(statsCollector{loop})
+	return promhttp.HandlerFor(reg, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Beaxhem/architecture-lab-4/eventloop"
+)
+
+// maxCommandSize bounds the body of a POST /command request.
+const maxCommandSize = 64 << 10
+
+// newServeMux exposes the loop over HTTP:
+//
+//	POST   /command        parses the body as one line of instructions and posts them
+//	DELETE /command/{id}   cancels a posted command that is still queued
+//	POST   /trigger        releases the loop held by -hold
+//	POST   /signal/{name}  sends a signal to name for the waitsignal command
+//	GET    /stats          returns the loop's Stats as JSON
+//	GET    /metrics        returns the same in the Prometheus exposition format
+//
+// A command is answered with 202 Accepted once it is queued, before it runs,
+// and the ids of its instructions, one per line, or with 400 Bad Request if
+// the body isn't a single line of valid instructions. If the queue is at the
+// cap of -max-depth, the response is 503 Service Unavailable, with 0 for the
+// id of each rejected instruction. A cancellation is answered with 204 No
+// Content, or with 404 Not Found if the command isn't queued anymore, and a
+// trigger or a signal with 204 No Content, even if the loop was already
+// released or nothing waits on the signal.
+func newServeMux(loop *eventloop.EventLoop) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /command", func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxCommandSize))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		line := strings.TrimSpace(string(body))
+		if strings.ContainsAny(line, "\r\n") {
+			http.Error(w, "expected a single instruction", http.StatusBadRequest)
+			return
+		}
+		parser := newParser()
+		cmds, _, err := parseLine(parser, line)
+		if err == nil {
+			err = parser.Close()
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(cmds) == 0 {
+			http.Error(w, "expected an instruction", http.StatusBadRequest)
+			return
+		}
+		ids := make([]uint64, len(cmds))
+		status := http.StatusAccepted
+		for i, cmd := range cmds {
+			if ids[i] = loop.PostWithID(cmd); ids[i] == 0 {
+				status = http.StatusServiceUnavailable
+			}
+		}
+		w.WriteHeader(status)
+		for _, id := range ids {
+			fmt.Fprintln(w, id)
+		}
+	})
+	mux.HandleFunc("DELETE /command/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+		if err != nil || !loop.CancelPosted(id) {
+			http.Error(w, "no queued command with that id", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("POST /trigger", func(w http.ResponseWriter, r *http.Request) {
+		loop.Trigger()
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("POST /signal/{name}", func(w http.ResponseWriter, r *http.Request) {
+		loop.Signal(r.PathValue("name"))
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("GET /stats", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(loop.Stats())
+	})
+	mux.Handle("GET /metrics", metricsHandler(loop))
+	return mux
+}
+
+// server serves the loop at an address until shutdown is called. Calling
+// shutdown again does nothing.
+type server struct {
+	http     *http.Server
+	shutdown func()
+	closed   chan struct{}
+}
+
+func newServer(addr string, loop *eventloop.EventLoop) *server {
+	s := &server{
+		http:   &http.Server{Addr: addr, Handler: newServeMux(loop)},
+		closed: make(chan struct{}),
+	}
+	var once sync.Once
+	s.shutdown = func() {
+		once.Do(func() {
+			go func() {
+				s.http.Shutdown(context.Background())
+				close(s.closed)
+			}()
+		})
+	}
+	return s
+}
+
+// run serves until shutdown has let the requests in flight finish, so that
+// every accepted command has been posted by the time it returns.
+func (s *server) run() error {
+	err := s.http.ListenAndServe()
+	if err != http.ErrServerClosed {
+		return fmt.Errorf("serve: %w", err)
+	}
+	<-s.closed
+	return nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Beaxhem/architecture-lab-4/eventloop"
+)
+
+// newTestServer serves a started loop printing to out.
+func newTestServer(t *testing.T, out io.Writer, opts ...eventloop.Option) (*httptest.Server, *eventloop.EventLoop) {
+	t.Helper()
+
+	loop := eventloop.NewEventLoop(append([]eventloop.Option{eventloop.WithOutput(out)}, opts...)...)
+	loop.Start()
+	srv := httptest.NewServer(newServeMux(loop))
+	t.Cleanup(srv.Close)
+	return srv, loop
+}
+
+func TestServePostCommand(t *testing.T) {
+	var out bytes.Buffer
+	srv, loop := newTestServer(t, &out)
+
+	resp, err := http.Post(srv.URL+"/command", "text/plain", strings.NewReader("print hi; add 1 2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusAccepted)
+	}
+	if ids := strings.Fields(string(body)); len(ids) != 2 {
+		t.Errorf("body = %q, want the ids of both instructions", body)
+	}
+
+	loop.AwaitFinish()
+	if got, want := out.String(), "hi\n3\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
+
+func TestServeRejectsInvalidCommand(t *testing.T) {
+	var out bytes.Buffer
+	srv, loop := newTestServer(t, &out)
+	defer loop.AwaitFinish()
+
+	for _, body := range []string{"frob", "", "print a\nprint b"} {
+		resp, err := http.Post(srv.URL+"/command", "text/plain", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("POST %q: status = %d, want %d", body, resp.StatusCode, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	var out bytes.Buffer
+	srv, loop := newTestServer(t, &out)
+
+	resp, err := http.Post(srv.URL+"/command", "text/plain", strings.NewReader("print a; print b; add 1 2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	loop.AwaitFinish()
+
+	resp, err = http.Get(srv.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	// The add prints its sum with a print of its own.
+	for _, want := range []string{
+		`eventloop_commands_executed_total{command="print"} 3`,
+		`eventloop_commands_executed_total{command="add"} 1`,
+		`eventloop_command_duration_seconds_count{command="print"} 3`,
+		`eventloop_queue_peak_depth `,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("metrics lack %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestServeTrigger(t *testing.T) {
+	var out bytes.Buffer
+	srv, loop := newTestServer(t, &out, eventloop.WithHold(true))
+	cmd, err := eventloop.Parse("print staged")
+	if err != nil {
+		t.Fatal(err)
+	}
+	loop.Post(cmd)
+
+	resp, err := http.Post(srv.URL+"/trigger", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusNoContent)
+	}
+	loop.AwaitFinish()
+	if got := out.String(); got != "staged\n" {
+		t.Errorf("output = %q, want the staged command run", got)
+	}
+}
+
+func TestServeSignal(t *testing.T) {
+	var out bytes.Buffer
+	srv, loop := newTestServer(t, &out)
+	for _, line := range []string{"waitsignal go", "print released"} {
+		cmd, err := eventloop.Parse(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		loop.Post(cmd)
+	}
+
+	resp, err := http.Post(srv.URL+"/signal/go", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusNoContent)
+	}
+	loop.AwaitFinish()
+	if got := out.String(); got != "released\n" {
+		t.Errorf("output = %q, want the waiting command released", got)
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// triggerSignals release the loop held by -hold. Without SIGUSR1, only
+// POST /trigger does.
+var triggerSignals []os.Signal
@@ -0,0 +1,11 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// triggerSignals release the loop held by -hold.
+var triggerSignals = []os.Signal{syscall.SIGUSR1}
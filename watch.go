@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"time"
+)
+
+// watchInterval is how often watched files are checked for changes.
+const watchInterval = 200 * time.Millisecond
+
+// fileStamp identifies a version of a file. A file that can't be read has the
+// zero stamp.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func stampFiles(paths []string) []fileStamp {
+	stamps := make([]fileStamp, len(paths))
+	for i, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			stamps[i] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+		}
+	}
+	return stamps
+}
+
+func sameStamps(a, b []fileStamp) bool {
+	for i := range a {
+		if !a[i].modTime.Equal(b[i].modTime) || a[i].size != b[i].size {
+			return false
+		}
+	}
+	return true
+}
+
+// watchFiles polls paths every interval and calls changed once they have been
+// modified and then left alone for a whole interval, so that a burst of
+// writes, like an editor saving in several steps, triggers a single call. It
+// returns when stop is closed.
+func watchFiles(paths []string, interval time.Duration, stop <-chan struct{}, changed func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last := stampFiles(paths)
+	dirty := false
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		stamps := stampFiles(paths)
+		if !sameStamps(stamps, last) {
+			last, dirty = stamps, true
+			continue
+		}
+		if dirty {
+			dirty = false
+			changed()
+		}
+	}
+}